@@ -0,0 +1,48 @@
+package cltools
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tacusci/clover/img"
+)
+
+//SortByCaptureTime orders loaded images chronologically by when they were taken, so the outputs of tools
+//which aggregate images aren't in whatever order the filesystem listed them. Images without a capture time
+//go last ordered by file name
+func SortByCaptureTime(images []img.TiffImage) {
+	type sortKey struct {
+		captureTime *time.Time
+		name        string
+	}
+	//read each image's capture time once, rather than parsing its date/time text on every comparison
+	keys := make(map[img.TiffImage]sortKey, len(images))
+	for _, ti := range images {
+		ri := ti.GetRawImage()
+		key := sortKey{}
+		if captureTime, ok := ri.GetCaptureTime(); ok {
+			key.captureTime = &captureTime
+		}
+		if ri.File != nil {
+			key.name = filepath.Base(ri.File.Name())
+		}
+		keys[ti] = key
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		ki, kj := keys[images[i]], keys[images[j]]
+		return capturedBefore(ki.captureTime, ki.name, kj.captureTime, kj.name)
+	})
+}
+
+//capturedBefore reports whether an image taken at ti named ni sorts before one taken at tj named nj, nil times
+//sort after every time and ties are broken by name
+func capturedBefore(ti *time.Time, ni string, tj *time.Time, nj string) bool {
+	if (ti == nil) != (tj == nil) {
+		return ti != nil
+	}
+	if ti != nil && !ti.Equal(*tj) {
+		return ti.Before(*tj)
+	}
+	return ni < nj
+}
@@ -0,0 +1,67 @@
+package cltools
+
+import (
+	"image/jpeg"
+	"io"
+
+	"github.com/tacusci/clover/img"
+)
+
+//dimensionFilter skips images narrower or shorter than a minimum size, like stray thumbnails and web images, a
+//minimum of 0 doesn't check that side
+type dimensionFilter struct {
+	minWidth  int
+	minHeight int
+}
+
+//newDimensionFilter creates a filter for the minimum width and height, returning a nil filter which lets every
+//image through if neither is set
+func newDimensionFilter(minWidth int, minHeight int) *dimensionFilter {
+	if minWidth <= 0 && minHeight <= 0 {
+		return nil
+	}
+	return &dimensionFilter{minWidth: minWidth, minHeight: minHeight}
+}
+
+//include returns true if the image is at least the filter's minimum size, images whose size can't be read are
+//let through, to fail during conversion
+func (df *dimensionFilter) include(ti img.TiffImage) bool {
+	if df == nil {
+		return true
+	}
+	width, height, ok := imageDimensions(ti)
+	if !ok {
+		return true
+	}
+	return width >= df.minWidth && height >= df.minHeight
+}
+
+//imageDimensions returns the size of the image's largest IFD without decoding it, JPEGs are sized from their frame
+//header instead, as their EXIF IFDs often don't have one
+func imageDimensions(ti img.TiffImage) (int, int, bool) {
+	if _, isJpeg := ti.(*img.JpegImage); isJpeg {
+		file := ti.GetRawImage().File
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return 0, 0, false
+		}
+		config, err := jpeg.DecodeConfig(io.NewSectionReader(file, 0, fileInfo.Size()))
+		if err != nil {
+			return 0, 0, false
+		}
+		return config.Width, config.Height, true
+	}
+	if ti.Load() != nil {
+		return 0, 0, false
+	}
+	var width, height uint32
+	for _, ifd := range ti.GetRawImage().Ifds {
+		if uint64(ifd.ImageWidth)*uint64(ifd.ImageHeight) > uint64(width)*uint64(height) {
+			width, height = ifd.ImageWidth, ifd.ImageHeight
+		}
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, false
+	}
+	return int(width), int(height), true
+}
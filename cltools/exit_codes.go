@@ -0,0 +1,49 @@
+package cltools
+
+import "errors"
+
+//ExitCode is what clover exits with once a tool has finished, so scripts can tell whether every image made it
+type ExitCode int
+
+//Exit codes of the tools
+const (
+	//ExitOK is every image being converted or exported, or skipped
+	ExitOK ExitCode = 0
+	//ExitBadArguments is the options not being valid, nothing was converted or exported
+	ExitBadArguments ExitCode = 1
+	//ExitSomeFailed is some of the images failing, the rest were converted or exported, or skipped
+	ExitSomeFailed ExitCode = 2
+	//ExitAllFailed is every image failing
+	ExitAllFailed ExitCode = 3
+)
+
+//exitCodeForCounts returns the exit code of a run which found total images, of which failed couldn't be
+//converted or exported
+func exitCodeForCounts(total int, failed int) ExitCode {
+	switch {
+	case failed == 0:
+		return ExitOK
+	case failed == total:
+		return ExitAllFailed
+	}
+	return ExitSomeFailed
+}
+
+//RtcExitCode returns the exit code for what RunRtc returned, an error without any results is the options not being
+//valid, while one with results is the zip archive the outputs went into not being written, which loses all of them,
+//unless it's stopping on the first failure
+func RtcExitCode(results []ConversionResult, err error) ExitCode {
+	if err != nil && !errors.Is(err, ErrStoppedOnFailure) {
+		if results == nil {
+			return ExitBadArguments
+		}
+		return ExitAllFailed
+	}
+	var failed int
+	for _, result := range results {
+		if result.Status == ConversionFailed {
+			failed++
+		}
+	}
+	return exitCodeForCounts(len(results), failed)
+}
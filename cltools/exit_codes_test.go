@@ -0,0 +1,80 @@
+package cltools
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCodeForCounts(t *testing.T) {
+	for _, test := range []struct {
+		total    int
+		failed   int
+		expected ExitCode
+	}{
+		{0, 0, ExitOK},
+		{3, 0, ExitOK},
+		{3, 1, ExitSomeFailed},
+		{3, 2, ExitSomeFailed},
+		{3, 3, ExitAllFailed},
+	} {
+		if code := exitCodeForCounts(test.total, test.failed); code != test.expected {
+			t.Errorf("%d of %d failing exited with %d, expected %d", test.failed, test.total, code, test.expected)
+		}
+	}
+}
+
+func TestRtcExitCode(t *testing.T) {
+	converted := ConversionResult{Source: "a.nef", Status: ConversionConverted}
+	skipped := ConversionResult{Source: "b.nef", Status: ConversionSkipped}
+	failed := ConversionResult{Source: "c.nef", Status: ConversionFailed}
+	for _, test := range []struct {
+		name     string
+		results  []ConversionResult
+		err      error
+		expected ExitCode
+	}{
+		{"none found", []ConversionResult{}, nil, ExitOK},
+		{"converted or skipped", []ConversionResult{converted, skipped}, nil, ExitOK},
+		{"some failed", []ConversionResult{converted, failed}, nil, ExitSomeFailed},
+		{"all failed", []ConversionResult{failed, failed}, nil, ExitAllFailed},
+		{"bad arguments", nil, errors.New("Input type .bmp not recognised/supported"), ExitBadArguments},
+		{"zip not written", []ConversionResult{converted}, errors.New("Unable to write zip archive"), ExitAllFailed},
+		{"fail fast", []ConversionResult{converted, failed}, fmt.Errorf("Unable to convert c.nef: %w", ErrStoppedOnFailure), ExitSomeFailed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := RtcExitCode(test.results, test.err); code != test.expected {
+				t.Errorf("Exited with %d, expected %d", code, test.expected)
+			}
+		})
+	}
+}
+
+func TestRunRtcOneCorruptImageExitCode(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "good.tif"), fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+	//big enough to be read, but with no TIFF header
+	if err := ioutil.WriteFile(filepath.Join(dir, "corrupt.tif"), make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RunRtc(RtcOptions{
+		LocationPath:    dir,
+		OutputDirectory: t.TempDir(),
+		InputType:       "*.tif",
+		OutputType:      ".jpg",
+		Workers:         1,
+		IOWorkers:       1,
+	})
+	if code := RtcExitCode(results, err); code != ExitSomeFailed {
+		t.Errorf("Exited with %d, expected %d (%v)", code, ExitSomeFailed, err)
+	}
+}
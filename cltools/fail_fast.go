@@ -0,0 +1,38 @@
+package cltools
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+//ErrStoppedOnFailure is wrapped in the error returned when a run with fail fast stops at an image which failed,
+//check for it with errors.Is
+var ErrStoppedOnFailure = errors.New("stopped on first failure")
+
+//failFast is shared by the conversion goroutines to stop converting once an image fails, the images still to come
+//are drained without being converted so the searching goroutines sending them aren't left blocked
+type failFast struct {
+	enabled bool
+	once    sync.Once
+	//stopped is 1 once an image has failed, it's only accessed atomically
+	stopped int32
+	err     error
+}
+
+//fail stops the run if fail fast is enabled, only the first image to fail is kept as the reason
+func (ff *failFast) fail(result ConversionResult) {
+	if !ff.enabled {
+		return
+	}
+	ff.once.Do(func() {
+		ff.err = fmt.Errorf("%w, %s failed -> %v", ErrStoppedOnFailure, result.Source, result.Err)
+		atomic.StoreInt32(&ff.stopped, 1)
+	})
+}
+
+//isStopped returns true once an image has failed with fail fast enabled
+func (ff *failFast) isStopped() bool {
+	return atomic.LoadInt32(&ff.stopped) == 1
+}
@@ -0,0 +1,51 @@
+package cltools
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/tacusci/clover/img"
+)
+
+//teeHash is a digest of the source file which can be added to exports with -hash
+type teeHash struct {
+	//jsonKey is the key of the digest in JSON exports, and textLabel its label in text exports
+	jsonKey   string
+	textLabel string
+	newHash   func() hash.Hash
+}
+
+//teeHashes are the digests which can be picked with -hash, by name
+var teeHashes = map[string]teeHash{
+	"md5":    {jsonKey: "FileMD5", textLabel: "File MD5", newHash: md5.New},
+	"sha256": {jsonKey: "FileSHA256", textLabel: "File SHA-256", newHash: sha256.New},
+}
+
+//teeHashNames returns the sorted names of the digests which can be picked
+func teeHashNames() []string {
+	names := make([]string, 0, len(teeHashes))
+	for name := range teeHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//hashImageFile returns the hex digest of the whole of the image's file, read through once in chunks rather than
+//all at once, as raws can be hundreds of megabytes. This is a second read of the file after Load, which is accepted,
+//as Load only reads the parts it needs and out of order, so its reads can't be teed into the digest
+func hashImageFile(imageFile img.ImageFile, th teeHash) (string, error) {
+	fileInfo, err := imageFile.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := th.newHash()
+	if _, err := io.Copy(h, io.NewSectionReader(imageFile, 0, fileInfo.Size())); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
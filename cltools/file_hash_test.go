@@ -0,0 +1,56 @@
+package cltools
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTeeHash(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5Sum, sha256Sum := md5.Sum(fixture), sha256.Sum256(fixture)
+	expectedDigests := map[string]string{"md5": hex.EncodeToString(md5Sum[:]), "sha256": hex.EncodeToString(sha256Sum[:])}
+	dir := writeTestImages(t, map[string][]byte{"a.tif": fixture})
+
+	for _, hashName := range teeHashNames() {
+		for _, outputFormat := range []string{teeFormatText, teeFormatJSON} {
+			t.Run(hashName+" "+outputFormat, func(t *testing.T) {
+				outputDirectory := t.TempDir()
+				if code := RunTee(TeeOptions{
+					LocationPath:    dir,
+					OutputDirectory: outputDirectory,
+					InputType:       "*.tif",
+					OutputFormat:    outputFormat,
+					Hash:            hashName,
+				}); code != ExitOK {
+					t.Fatalf("Exited with %d", code)
+				}
+				export, err := ioutil.ReadFile(filepath.Join(outputDirectory, "a."+outputFormat))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				th, expected := teeHashes[hashName], expectedDigests[hashName]
+				if outputFormat == teeFormatJSON {
+					var fields map[string]interface{}
+					if err := json.Unmarshal(export, &fields); err != nil {
+						t.Fatal(err)
+					}
+					if fields[th.jsonKey] != expected {
+						t.Errorf("Exported %s %v, expected %s", th.jsonKey, fields[th.jsonKey], expected)
+					}
+				} else if !strings.Contains(string(export), th.textLabel+" -> "+expected+"\n") {
+					t.Errorf("Exported %q, expected %s -> %s", export, th.textLabel, expected)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cltools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tacusci/clover/img"
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+//fileListStdin is the file list path which reads the list from stdin instead
+const fileListStdin = "-"
+
+//readFileList reads the newline separated image paths in the file list, or stdin if the path is -, blank lines are
+//ignored. Every image has to exist and be a registered type, so a bad list is found before anything's converted
+func readFileList(fileListPath string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if fileListPath != fileListStdin {
+		fileList, err := os.Open(fileListPath)
+		if err != nil {
+			return nil, err
+		}
+		defer fileList.Close()
+		r = fileList
+	}
+
+	var imagePaths []string
+	var missingPaths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		imagePath := strings.TrimSpace(scanner.Text())
+		if len(imagePath) == 0 {
+			continue
+		}
+		imagePath = utils.TranslatePath(imagePath)
+		if _, err := os.Stat(imagePath); err != nil {
+			missingPaths = append(missingPaths, imagePath)
+			continue
+		}
+		if !utils.SSliceContainsFold(img.RegisteredTypes(), filepath.Ext(imagePath)) {
+			return nil, fmt.Errorf("Unable to use %s, %w", imagePath, ErrUnsupportedInputType)
+		}
+		imagePaths = append(imagePaths, imagePath)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read file list %s -> %v", fileListPath, err)
+	}
+	if len(missingPaths) > 0 {
+		return nil, fmt.Errorf("Images in file list %s don't exist: %s", fileListPath, strings.Join(missingPaths, ", "))
+	}
+	return imagePaths, nil
+}
+
+//findImagesInFileList is findImagesInDir for the images read from a file list, each is opened as the type of its
+//extension
+func findImagesInFileList(wg *sync.WaitGroup, itcc *chan img.TiffImage, imagePaths []string) {
+	defer wg.Done()
+	for _, imagePath := range imagePaths {
+		image, err := os.Open(imagePath)
+		if err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+		ti, ok := img.NewImage(filepath.Ext(imagePath), img.RawImage{File: image})
+		if !ok {
+			image.Close()
+			continue
+		}
+		*itcc <- ti
+	}
+}
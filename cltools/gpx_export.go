@@ -0,0 +1,167 @@
+package cltools
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tacusci/clover/img"
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64    `xml:"lat,attr"`
+	Lon  float64    `xml:"lon,attr"`
+	Ele  float64    `xml:"ele"`
+	Time *time.Time `xml:"time,omitempty"`
+	Name string     `xml:"name"`
+}
+
+//RunGpx runs the GPS track to GPX export tool
+func RunGpx(ts bool, sdir string, opath string, itype string, recursive bool) {
+	if len(sdir) == 0 || len(opath) == 0 || len(itype) == 0 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	fmt.Printf("Clover - Running GPX export tool...\n")
+
+	var st time.Time
+	if ts {
+		st = time.Now()
+	}
+
+	supportedInputTypes := img.RegisteredTypes()
+
+	inputTypePrefixToMatch, itype, err := parseInputOutputTypes(itype, "", supportedInputTypes, []string{})
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	var images []img.TiffImage
+
+	if isDir, err := isDirectory(sdir); isDir {
+		//closed once the searching is done, which ends the waypoint collecting goroutine
+		imagesToReadGpsChan := make(chan img.TiffImage, 32)
+		//file searching wait group
+		var fswg sync.WaitGroup
+		//images to read GPS wait group
+		var irgwg sync.WaitGroup
+		fswg.Add(1)
+		go findImagesInDir(&fswg, &imagesToReadGpsChan, sdir, inputTypePrefixToMatch, itype, recursive)
+		irgwg.Add(1)
+		go collectGpsImages(&irgwg, &imagesToReadGpsChan, &images)
+		fswg.Wait()
+		//tell the waypoint collecting goroutine there's no more images coming
+		close(imagesToReadGpsChan)
+		irgwg.Wait()
+	} else {
+		if err != nil {
+			logging.ErrorAndExit(err.Error())
+		}
+	}
+
+	//the waypoints follow the order the images were taken in, not the order they were found in
+	SortByCaptureTime(images)
+	waypoints := make([]gpxWaypoint, 0, len(images))
+	for _, ti := range images {
+		waypoints = append(waypoints, newGpxWaypoint(ti.GetRawImage()))
+	}
+
+	if err := writeGpxFile(utils.TranslatePath(opath), waypoints); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	logging.Info(fmt.Sprintf("Exported %d waypoints to %s", len(waypoints), opath))
+	if ts {
+		logging.Info(fmt.Sprintf("Time taken: %d ms", time.Since(st).Nanoseconds()/1000000))
+	}
+}
+
+func collectGpsImages(wg *sync.WaitGroup, irgc *chan img.TiffImage, images *[]img.TiffImage) {
+	defer wg.Done()
+	for ti := range *irgc {
+		if ti != nil && readGpsFix(ti) {
+			*images = append(*images, ti)
+		}
+	}
+}
+
+//readGpsFix loads the image's IFDs and closes it, returning whether it has a GPS fix, images without one are skipped
+func readGpsFix(ti img.TiffImage) bool {
+	if ti.GetRawImage().File == nil {
+		return false
+	}
+	defer ti.GetRawImage().File.Close()
+
+	if err := ti.Load(); err != nil {
+		logging.Error(fmt.Sprintf("Unable to read %s [FAILED] (%s)", ti.GetRawImage().File.Name(), err.Error()))
+		return false
+	}
+
+	ri := ti.GetRawImage()
+	if !ri.GetGpsIFD().HasFix() {
+		logging.Debug(fmt.Sprintf("Skipping %s, no GPS fix", ri.File.Name()))
+		return false
+	}
+	return true
+}
+
+//newGpxWaypoint converts a loaded image's GPS IFD into a waypoint
+func newGpxWaypoint(ri img.RawImage) gpxWaypoint {
+	gifd := ri.GetGpsIFD()
+	wpt := gpxWaypoint{
+		Lat:  gifd.Latitude(),
+		Lon:  gifd.Longitude(),
+		Ele:  gifd.Altitude(),
+		Name: filepath.Base(ri.File.Name()),
+	}
+	//prefer the GPS time as it's UTC, the camera's clock has no time zone
+	if gpsTime, ok := gifd.Time(); ok {
+		wpt.Time = &gpsTime
+	} else if captureTime, ok := ri.GetCaptureTime(); ok {
+		wpt.Time = &captureTime
+	}
+	return wpt
+}
+
+func writeGpxFile(opath string, waypoints []gpxWaypoint) error {
+	ofile, err := os.Create(opath)
+	if err != nil {
+		return err
+	}
+	defer ofile.Close()
+
+	doc := gpxDocument{
+		Version:   "1.1",
+		Creator:   "Clover",
+		Xmlns:     "http://www.topografix.com/GPX/1/1",
+		Waypoints: waypoints,
+	}
+
+	if _, err := ofile.WriteString(xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(ofile)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err = ofile.WriteString("\n")
+	return err
+}
@@ -0,0 +1,40 @@
+package cltools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tacusci/clover/img"
+)
+
+//hexDumpMaxBytes is the most of each entry's data which is dumped, MakerNotes and embedded images can be huge
+const hexDumpMaxBytes = 256
+
+//buildHexDump lists every entry of every IFD, along with their EXIF and GPS IFDs, as they're stored in the
+//file, one per line as tag=0xXXXX type=N count=M bytes=..., for inspecting formats which aren't fully supported
+func buildHexDump(ri img.RawImage) string {
+	sb := strings.Builder{}
+	for index, ifd := range ri.Ifds {
+		writeHexDumpIFD(&sb, fmt.Sprintf("IFD%d", index), ifd.Entries)
+		if ifd.ExifIFD != nil {
+			writeHexDumpIFD(&sb, fmt.Sprintf("IFD%d EXIF IFD", index), ifd.ExifIFD.Entries)
+		}
+		if ifd.GpsIFD != nil {
+			writeHexDumpIFD(&sb, fmt.Sprintf("IFD%d GPS IFD", index), ifd.GpsIFD.Entries)
+		}
+	}
+	return sb.String()
+}
+
+func writeHexDumpIFD(sb *strings.Builder, name string, entries []img.IFDEntry) {
+	sb.WriteString(fmt.Sprintf("--------- START %s HEX DUMP ---------\n", name))
+	for _, entry := range entries {
+		data := entry.Data(hexDumpMaxBytes)
+		sb.WriteString(fmt.Sprintf("tag=0x%04x type=%d count=%d bytes=% x", entry.Tag, entry.DataType, entry.Count, data))
+		if entry.Size() > uint64(len(data)) {
+			sb.WriteString(fmt.Sprintf(" ... (%d bytes)", entry.Size()))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("--------- END %s HEX DUMP ---------\n\n", name))
+}
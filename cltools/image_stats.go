@@ -0,0 +1,248 @@
+package cltools
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/logging"
+
+	"github.com/tacusci/clover/img"
+	"github.com/tacusci/clover/utils"
+)
+
+//formats the image statistics can be output as
+const (
+	statFormatText = "txt"
+	statFormatJSON = "json"
+)
+
+//statUnknown is what images without a model, lens or ISO are counted under
+const statUnknown = "Unknown"
+
+//statISOStops are the upper bounds of the ISO buckets, ISOs above the last go in a bucket of their own
+var statISOStops = []int{100, 200, 400, 800, 1600, 3200, 6400, 12800}
+
+//StatOptions holds the settings for a run of the image statistics tool
+type StatOptions struct {
+	//LocationPath is one or more comma separated directories or zip archives to scan
+	LocationPath string
+	InputType    string
+	Recursive    bool
+	//OutputFormat is how the statistics are printed, txt or json, "" is txt
+	OutputFormat string
+}
+
+//imageStats are the statistics gathered over every image of a run of the image statistics tool
+type imageStats struct {
+	Images       int            `json:"images"`
+	FailedImages int            `json:"failedImages"`
+	TotalBytes   uint64         `json:"totalBytes"`
+	Models       map[string]int `json:"models"`
+	Lenses       map[string]int `json:"lenses"`
+	ISOs         map[string]int `json:"isos"`
+	//Earliest and Latest are when the earliest and latest images were taken, nil if none of them have a capture time
+	Earliest *time.Time `json:"earliest,omitempty"`
+	Latest   *time.Time `json:"latest,omitempty"`
+}
+
+//RunStat runs the image statistics tool, which prints how many images there are per camera model, lens and ISO,
+//their total size and the range of dates they were taken over
+func RunStat(opts StatOptions) ExitCode {
+	if len(opts.LocationPath) == 0 || len(opts.InputType) == 0 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	opts.OutputFormat = strings.ToLower(strings.TrimPrefix(opts.OutputFormat, "."))
+	if len(opts.OutputFormat) == 0 {
+		opts.OutputFormat = statFormatText
+	}
+	if opts.OutputFormat != statFormatText && opts.OutputFormat != statFormatJSON {
+		logging.Error(fmt.Sprintf("Output format %s not supported, it must be %s or %s", opts.OutputFormat, statFormatText, statFormatJSON))
+		return ExitBadArguments
+	}
+
+	inputTypePrefixToMatch, inputType, err := parseInputOutputTypes(opts.InputType, "", img.RegisteredTypes(), []string{})
+	if err != nil {
+		logging.Error(err.Error())
+		return ExitBadArguments
+	}
+
+	locationPaths := parseLocationPaths(opts.LocationPath)
+	for _, locationPath := range locationPaths {
+		if isDir, err := isDirectory(locationPath); !isDir && !isZipArchive(locationPath) {
+			if err != nil {
+				logging.Error(err.Error())
+			} else {
+				logging.Error(fmt.Sprintf("Location %s isn't a directory or zip archive", locationPath))
+			}
+			return ExitBadArguments
+		}
+	}
+
+	stats := imageStats{Models: map[string]int{}, Lenses: map[string]int{}, ISOs: map[string]int{}}
+	//closed once the searching is done, which ends the stats collecting goroutine
+	imagesToStatChan := make(chan img.TiffImage, 32)
+	//file searching wait group
+	var fswg sync.WaitGroup
+	//images to stat wait group
+	var iswg sync.WaitGroup
+	for _, locationPath := range locationPaths {
+		fswg.Add(1)
+		if isZipArchive(locationPath) {
+			//the images in an archive are read straight out of it, so it's kept open until they've all been read
+			zipReader, err := zip.OpenReader(locationPath)
+			if err != nil {
+				logging.Error(err.Error())
+				fswg.Done()
+				continue
+			}
+			defer zipReader.Close()
+			go findImagesInZip(&fswg, &imagesToStatChan, &zipReader.Reader, locationPath, inputTypePrefixToMatch, inputType, opts.Recursive)
+		} else {
+			go findImagesInDir(&fswg, &imagesToStatChan, locationPath, inputTypePrefixToMatch, inputType, opts.Recursive)
+		}
+	}
+	iswg.Add(1)
+	go collectImageStats(&iswg, &imagesToStatChan, &stats)
+	fswg.Wait()
+	//tell the stats collecting goroutine there's no more images coming
+	close(imagesToStatChan)
+	iswg.Wait()
+
+	if opts.OutputFormat == statFormatJSON {
+		err = writeImageStatsJSON(os.Stdout, stats)
+	} else {
+		err = writeImageStatsText(os.Stdout, stats)
+	}
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	return exitCodeForCounts(stats.Images+stats.FailedImages, stats.FailedImages)
+}
+
+//collectImageStats adds each image received from isc to the stats, images which can't be loaded are only counted
+//as failed
+func collectImageStats(wg *sync.WaitGroup, isc *chan img.TiffImage, stats *imageStats) {
+	defer wg.Done()
+	for ti := range *isc {
+		if ti == nil || ti.GetRawImage().File == nil {
+			continue
+		}
+		if err := ti.Load(); err != nil {
+			logging.Error(fmt.Sprintf("Unable to read %s [FAILED] (%s)", ti.GetRawImage().File.Name(), err.Error()))
+			stats.FailedImages++
+			ti.GetRawImage().File.Close()
+			continue
+		}
+		stats.add(ti)
+		ti.GetRawImage().File.Close()
+	}
+}
+
+//add counts the loaded image in the stats
+func (stats *imageStats) add(ti img.TiffImage) {
+	rawImage := ti.GetRawImage()
+	exifMap := ti.GetEXIFMap()
+	stats.Images++
+	if fileInfo, err := rawImage.File.Stat(); err == nil {
+		stats.TotalBytes += uint64(fileInfo.Size())
+	}
+	stats.Models[statText(exifMap["Model"])]++
+	stats.Lenses[statText(exifMap["LensModel"])]++
+	iso, _ := exifMap["ISO"].(int)
+	stats.ISOs[isoBucket(iso)]++
+	if captureTime, ok := rawImage.GetCaptureTime(); ok {
+		if stats.Earliest == nil || captureTime.Before(*stats.Earliest) {
+			stats.Earliest = &captureTime
+		}
+		if stats.Latest == nil || captureTime.After(*stats.Latest) {
+			stats.Latest = &captureTime
+		}
+	}
+}
+
+//statText returns the EXIF map's text value, or statUnknown if the image doesn't have it
+func statText(value interface{}) string {
+	if text, ok := value.(string); ok && len(text) > 0 {
+		return text
+	}
+	return statUnknown
+}
+
+//isoBucket returns the label of the bucket the ISO falls into, from the stop above the previous one up to its own
+//stop, e.g. 101-200, or statUnknown for 0
+func isoBucket(iso int) string {
+	if iso <= 0 {
+		return statUnknown
+	}
+	lowerBound := 0
+	for _, stop := range statISOStops {
+		if iso <= stop {
+			return fmt.Sprintf("%d-%d", lowerBound, stop)
+		}
+		lowerBound = stop + 1
+	}
+	return fmt.Sprintf("%d+", lowerBound)
+}
+
+//writeImageStatsText writes the stats as a table, each distribution's values listed from most to least images
+func writeImageStatsText(w io.Writer, stats imageStats) error {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%-11s %d\n", "Images", stats.Images))
+	if stats.FailedImages > 0 {
+		sb.WriteString(fmt.Sprintf("%-11s %d\n", "Failed", stats.FailedImages))
+	}
+	sb.WriteString(fmt.Sprintf("%-11s %s\n", "Total size", utils.FormatBytes(stats.TotalBytes)))
+	if stats.Earliest != nil {
+		sb.WriteString(fmt.Sprintf("%-11s %s to %s\n", "Date range", stats.Earliest.Format("2006-01-02 15:04:05"), stats.Latest.Format("2006-01-02 15:04:05")))
+	}
+	for _, distribution := range []struct {
+		label  string
+		counts map[string]int
+	}{
+		{"Models", stats.Models},
+		{"Lenses", stats.Lenses},
+		{"ISOs", stats.ISOs},
+	} {
+		sb.WriteString(distribution.label + ":\n")
+		for _, value := range sortedByCount(distribution.counts) {
+			sb.WriteString(fmt.Sprintf("  %-40s %d\n", value, distribution.counts[value]))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+//writeImageStatsJSON writes the stats as an indented JSON object
+func writeImageStatsJSON(w io.Writer, stats imageStats) error {
+	statsJSON, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode image statistics as JSON -> %v", err)
+	}
+	_, err = w.Write(append(statsJSON, '\n'))
+	return err
+}
+
+//sortedByCount returns the keys of counts from highest to lowest count, keys with the same count in name order
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
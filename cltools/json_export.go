@@ -0,0 +1,79 @@
+package cltools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tacusci/clover/img"
+)
+
+//names the JSON export can key its fields by
+const (
+	teeNamesClover   = "clover"
+	teeNamesExifTool = "exiftool"
+)
+
+//exifToolNames maps the field names of img's GetEXIFMap to ExifTool's group:tag names, as output by
+//"exiftool -G -j", so the JSON export can stand in for it in scripts. IFD0 and EXIF IFD tags are in the EXIF
+//group, GPS IFD tags in the GPS group, and values ExifTool works out rather than reads in the Composite group.
+//Fields which aren't listed, like DPI, have no ExifTool equivalent and keep their own names
+var exifToolNames = map[string]string{
+	"Make":             "EXIF:Make",
+	"Model":            "EXIF:Model",
+	"Software":         "EXIF:Software",
+	"ModifyDate":       "EXIF:ModifyDate",
+	"DateTimeOriginal": "EXIF:DateTimeOriginal",
+	"LensModel":        "EXIF:LensModel",
+	"ImageWidth":       "EXIF:ImageWidth",
+	"ImageHeight":      "EXIF:ImageHeight",
+	"BitsPerSample":    "EXIF:BitsPerSample",
+	"Compression":      "EXIF:Compression",
+	"Orientation":      "EXIF:Orientation",
+	"XResolution":      "EXIF:XResolution",
+	"YResolution":      "EXIF:YResolution",
+	"ResolutionUnit":   "EXIF:ResolutionUnit",
+	"ExposureTime":     "EXIF:ExposureTime",
+	"FNumber":          "EXIF:FNumber",
+	"ISO":              "EXIF:ISO",
+	"FocalLength":      "EXIF:FocalLength",
+	"SerialNumber":     "EXIF:SerialNumber",
+	"LensSerialNumber": "EXIF:LensSerialNumber",
+	"GPSLatitudeRef":   "GPS:GPSLatitudeRef",
+	"GPSLatitude":      "GPS:GPSLatitude",
+	"GPSLongitudeRef":  "GPS:GPSLongitudeRef",
+	"GPSLongitude":     "GPS:GPSLongitude",
+	"GPSAltitudeRef":   "GPS:GPSAltitudeRef",
+	"GPSAltitude":      "GPS:GPSAltitude",
+	"GPSDateStamp":     "GPS:GPSDateStamp",
+	"GPSTimeStamp":     "GPS:GPSTimeStamp",
+	"GPSSatellites":    "GPS:GPSSatellites",
+	"GPSPosition":      "Composite:GPSPosition",
+}
+
+//buildJSONExport writes the image's EXIF map as an indented JSON object, keyed by clover's field names or
+//ExifTool's group:tag names, along with the path of the image as SourceFile like ExifTool does, and any extra
+//fields which aren't read from the EXIF data under their own keys. Only the picked fields are written, nil picks
+//them all
+func buildJSONExport(ti img.TiffImage, names string, picked map[string]bool, extraFields map[string]interface{}) (string, error) {
+	exifMap := ti.GetEXIFMap()
+	export := make(map[string]interface{}, len(exifMap)+len(extraFields)+1)
+	for name, value := range exifMap {
+		if !teeFieldPicked(picked, teeEXIFMapFieldKey(name)) {
+			continue
+		}
+		if exifToolName, ok := exifToolNames[name]; ok && names == teeNamesExifTool {
+			name = exifToolName
+		}
+		export[name] = value
+	}
+	for key, value := range extraFields {
+		export[key] = value
+	}
+	export["SourceFile"] = ti.GetRawImage().File.Name()
+	//encoding/json sorts the keys, so the output is the same every run
+	exportJSON, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode EXIF data as JSON -> %v", err)
+	}
+	return string(exportJSON) + "\n", nil
+}
@@ -0,0 +1,95 @@
+package cltools
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/tacusci/clover/img"
+	"github.com/tacusci/clover/utils"
+)
+
+//listImages writes the path of each image of the input type in the locations to w, one per line, without opening
+//any of them, so the images a run would pick up can be checked first. Images in zip archives are listed as the
+//archive's path joined with their entry name
+func listImages(w io.Writer, locationPaths []string, inputType string, recursive bool) error {
+	inputTypePrefixToMatch, inputType, err := parseInputOutputTypes(inputType, "", img.RegisteredTypes(), []string{})
+	if err != nil {
+		return err
+	}
+	return walkImages(locationPaths, inputTypePrefixToMatch, inputType, recursive, func(imagePath string) error {
+		_, err := fmt.Fprintln(w, imagePath)
+		return err
+	})
+}
+
+//countImages returns how many images of the already parsed input type are in the locations, without opening any
+//of them
+func countImages(locationPaths []string, inputTypePrefixToMatch string, inputType string, recursive bool) (int, error) {
+	var count int
+	err := walkImages(locationPaths, inputTypePrefixToMatch, inputType, recursive, func(string) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+//walkImages calls found with the path of each image of the input type in the locations, stopping at the first
+//error found returns
+func walkImages(locationPaths []string, inputTypePrefixToMatch string, inputType string, recursive bool, found func(imagePath string) error) error {
+	for _, locationPath := range locationPaths {
+		var err error
+		if isZipArchive(locationPath) {
+			err = walkImagesInZip(locationPath, inputTypePrefixToMatch, inputType, recursive, found)
+		} else {
+			err = walkImagesInDir(locationPath, inputTypePrefixToMatch, inputType, recursive, found)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//walkImagesInDir is findImagesInDir for walkImages, sub directories are searched in turn rather than at the same
+//time so the images are found in the same order every run
+func walkImagesInDir(locationPath string, inputTypePrefixToMatch string, inputType string, recursive bool, found func(imagePath string) error) error {
+	files, err := ioutil.ReadDir(locationPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		filePath := utils.TranslatePath(path.Join(locationPath, file.Name()))
+		if !file.IsDir() {
+			if matchesInputType(file.Name(), inputTypePrefixToMatch, inputType) {
+				if err := found(filePath); err != nil {
+					return err
+				}
+			}
+		} else if recursive {
+			if err := walkImagesInDir(filePath, inputTypePrefixToMatch, inputType, recursive, found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//walkImagesInZip is findImagesInZip for walkImages, only the archive's directory is read, none of its entries
+func walkImagesInZip(zipPath string, inputTypePrefixToMatch string, inputType string, recursive bool, found func(imagePath string) error) error {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	for _, zipFile := range zipReader.File {
+		if imagePath, ok := matchZipEntry(zipFile, zipPath, inputTypePrefixToMatch, inputType, recursive); ok {
+			if err := found(imagePath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cltools
+
+import (
+	"sync"
+
+	"github.com/tacusci/clover/img"
+)
+
+//bytes held per pixel once an image is decoded, allows for RGBA
+const decodedBytesPerPixel = 4
+
+//memoryLimiter bounds how much memory the conversion workers have reserved at once, workers block in acquire
+//until enough of the budget is free
+type memoryLimiter struct {
+	mu    sync.Mutex
+	freed *sync.Cond
+	limit uint64
+	inUse uint64
+}
+
+//newMemoryLimiter creates a limiter with the given budget in bytes, a budget of 0 doesn't limit anything
+func newMemoryLimiter(limit uint64) *memoryLimiter {
+	ml := &memoryLimiter{limit: limit}
+	ml.freed = sync.NewCond(&ml.mu)
+	return ml
+}
+
+//acquire blocks until size bytes can be reserved and returns the amount reserved, which has to be given back
+//with release, a size larger than the whole budget waits until nothing else is reserved and is then let through
+func (ml *memoryLimiter) acquire(size uint64) uint64 {
+	if ml.limit == 0 {
+		return 0
+	}
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for ml.inUse > 0 && ml.inUse+size > ml.limit {
+		ml.freed.Wait()
+	}
+	ml.inUse += size
+	return size
+}
+
+func (ml *memoryLimiter) release(size uint64) {
+	if ml.limit == 0 {
+		return
+	}
+	ml.mu.Lock()
+	ml.inUse -= size
+	ml.mu.Unlock()
+	ml.freed.Broadcast()
+}
+
+//estimateDecodeMemory loads the image's IFDs and estimates the memory needed to decode its largest image,
+//an image which can't be loaded is estimated at 0 and left to fail during conversion
+func estimateDecodeMemory(ti img.TiffImage) uint64 {
+	if ti.Load() != nil {
+		return 0
+	}
+	var largestPixelCount uint64
+	for _, ifd := range ti.GetRawImage().Ifds {
+		if pixelCount := uint64(ifd.ImageWidth) * uint64(ifd.ImageHeight); pixelCount > largestPixelCount {
+			largestPixelCount = pixelCount
+		}
+	}
+	return largestPixelCount * decodedBytesPerPixel
+}
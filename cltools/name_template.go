@@ -0,0 +1,77 @@
+package cltools
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tacusci/clover/utils"
+)
+
+//tokens which are replaced in output name templates
+const (
+	//nameTokenName is the name of the raw image without its extension
+	nameTokenName = "{name}"
+	//nameTokenSeq is the image's number in path order, starting from 1
+	nameTokenSeq = "{seq}"
+)
+
+//imageSequence numbers the images of a run in path order, so an image's number is the same every run whatever
+//order the conversion goroutines get to it in
+type imageSequence struct {
+	numbers map[string]int
+	//width is the digits of the highest number, numbers are zero padded to it so the outputs sort in order
+	width int
+}
+
+//validateNameTemplate checks the template names each output after its image, with {name} or {seq}, and doesn't
+//try to put it in another directory
+func validateNameTemplate(template string) error {
+	if !strings.Contains(template, nameTokenName) && !strings.Contains(template, nameTokenSeq) {
+		return fmt.Errorf("Name template %s must contain %s or %s, otherwise every output has the same name", template, nameTokenName, nameTokenSeq)
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return errors.New("Name template can't contain path separators")
+	}
+	return nil
+}
+
+//newImageSequence numbers the image paths in sorted order
+func newImageSequence(imagePaths []string) *imageSequence {
+	sortedPaths := append([]string(nil), imagePaths...)
+	sort.Strings(sortedPaths)
+	sequence := &imageSequence{numbers: make(map[string]int, len(sortedPaths)), width: len(fmt.Sprint(len(sortedPaths)))}
+	for i, imagePath := range sortedPaths {
+		sequence.numbers[imagePath] = i + 1
+	}
+	return sequence
+}
+
+//scanImageSequence numbers the images of the already parsed input type in the locations
+func scanImageSequence(locationPaths []string, inputTypePrefixToMatch string, inputType string, recursive bool) (*imageSequence, error) {
+	var imagePaths []string
+	err := walkImages(locationPaths, inputTypePrefixToMatch, inputType, recursive, func(imagePath string) error {
+		imagePaths = append(imagePaths, imagePath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newImageSequence(imagePaths), nil
+}
+
+//expandNameTemplate returns the output name of the image for the output type, with the template's tokens replaced,
+//or the image's own name with the output type's extension if there's no template
+func expandNameTemplate(template string, sourcePath string, outputType string, sequence *imageSequence) string {
+	if len(template) == 0 {
+		return utils.ReplaceExtension(filepath.Base(sourcePath), outputType)
+	}
+	baseName := filepath.Base(sourcePath)
+	outputName := strings.Replace(template, nameTokenName, strings.TrimSuffix(baseName, filepath.Ext(baseName)), -1)
+	if sequence != nil {
+		outputName = strings.Replace(outputName, nameTokenSeq, fmt.Sprintf("%0*d", sequence.width, sequence.numbers[sourcePath]), -1)
+	}
+	return outputName + outputType
+}
@@ -1,15 +1,26 @@
 package cltools
 
 import (
-	"flag"
+	"archive/zip"
+	"bytes"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io/ioutil"
+	"math"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/tacusci/logging"
@@ -18,78 +29,494 @@ import (
 	"github.com/tacusci/clover/utils"
 )
 
-//RunRtc runs the raw to compressed image conversion tool
-func RunRtc(timeStamp bool, locationpath string, outputDirectory string, inputType string, outputType string, showConversionOutput bool, overwrite bool, recursive bool, retainFolderStructure bool) {
-	if len(locationpath) == 0 || len(inputType) == 0 || len(outputType) == 0 {
-		flag.PrintDefaults()
-		os.Exit(1)
+//progressInterval is the least time between calls of RtcOptions.OnProgress
+const progressInterval = 100 * time.Millisecond
+
+//OnExistPolicy is what to do with an output of an image when a file is already there
+type OnExistPolicy string
+
+//Supported on exist policies
+const (
+	//OnExistSkip leaves the existing file alone and doesn't write that output, the default
+	OnExistSkip OnExistPolicy = "skip"
+	//OnExistOverwrite writes the output over the existing file
+	OnExistOverwrite OnExistPolicy = "overwrite"
+	//OnExistNewer writes the output over the existing file if it's older than the raw image, otherwise skips it
+	OnExistNewer OnExistPolicy = "newer"
+	//OnExistRename leaves the existing file alone and writes the output to <name>_1.<ext>, or the next free number
+	OnExistRename OnExistPolicy = "rename"
+	//OnExistBackup renames the existing file to <name>.bak, or <name>.<time>.bak if that's taken, then writes the output
+	OnExistBackup OnExistPolicy = "backup"
+	//OnExistSmaller encodes the output in memory first, then writes it over the existing file only if it's smaller
+	OnExistSmaller OnExistPolicy = "smaller"
+	//OnExistLarger is OnExistSmaller, replacing the existing file only if the output is larger
+	OnExistLarger OnExistPolicy = "larger"
+)
+
+var supportedOnExistPolicies = []string{string(OnExistSkip), string(OnExistOverwrite), string(OnExistNewer), string(OnExistRename), string(OnExistBackup), string(OnExistSmaller), string(OnExistLarger)}
+
+//RtcOptions holds the settings for a run of the raw to compressed image conversion tool
+type RtcOptions struct {
+	TimeStamp       bool
+	LocationPath    string
+	OutputDirectory string
+	InputType       string
+	//OutputType is one or more comma separated output types, e.g. ".jpg,.png"
+	OutputType            string
+	OutputTypes           []string
+	ShowConversionOutput  bool
+	Recursive             bool
+	RetainFolderStructure bool
+	//OnExist is what to do with outputs which already exist, "" is OnExistSkip. When writing to a zip archive it
+	//applies to the archive instead, which can only be overwritten or backed up
+	OnExist OnExistPolicy
+	//Since skips images which haven't been modified since a time, or since the time recorded in a state file
+	//which is updated at the end of the run, "" converts every image
+	Since string
+	since *sinceFilter
+	//Watch keeps converting new images as they're written to the location, instead of the ones already there,
+	//until interrupted
+	Watch bool
+	//Workers is the number of images to convert at once
+	Workers int
+	//IOWorkers is the number of images to open and read the IFDs of at once, ahead of the conversion workers, which
+	//is worth raising above Workers when the storage is slower than decoding
+	IOWorkers int
+	//MaxMemory caps the estimated decode memory of all images being converted at once, 0 is no cap
+	MaxMemory uint64
+	//Aspect center crops images to a width to height ratio, e.g. "16:9", before any other adjustments, "" leaves
+	//them uncropped
+	Aspect       string
+	aspectWidth  int
+	aspectHeight int
+	//Gray converts images to grayscale before they're encoded
+	Gray bool
+	//Brightness and Contrast adjust images before they're encoded, both from -100 to 100, 0 leaves them as they are
+	Brightness int
+	Contrast   int
+	//Rotate turns images clockwise by 0, 90, 180 or 270 degrees, then Flip mirrors them, "h" or "v", or "" for neither
+	Rotate int
+	Flip   string
+	//Border is the width in pixels of a border of BorderColor added around images after all other adjustments, 0
+	//is no border
+	Border      int
+	BorderColor string
+	borderColor color.NRGBA
+	//DPI is the resolution written into the outputs, 0 carries over the resolution of the source image if it has one
+	DPI int
+	//ZipPath is the zip archive to write the outputs into instead of the output directory, "" writes them as files
+	ZipPath string
+	zip     *zipOutput
+	//MaxSize is the largest a JPEG output can be, its quality is lowered until it fits, 0 is no limit
+	MaxSize uint64
+	//Progressive writes JPEG outputs as progressive rather than baseline
+	Progressive bool
+	//List prints the path of each image which would be converted, one per line, and converts nothing
+	List bool
+	//From is a file of newline separated images to convert, or - to read them from stdin, instead of searching
+	//LocationPath for InputType images, each image's type is its extension
+	From       string
+	imagePaths []string
+	//FailFast stops converting once an image fails, the images which haven't been started yet are left alone, and
+	//the failure is returned wrapping ErrStoppedOnFailure
+	FailFast bool
+	failFast *failFast
+	//Summary is where to write a JSON summary of the run, - for stderr, "" doesn't write one
+	Summary string
+	//NoScan skips counting the images before converting them, which for huge locations can take a while itself
+	NoScan bool
+	//VerifyOutput decodes each output after it's written, counting the image as failed if one doesn't decode or
+	//isn't the right size, after writing it again up to VerifyRetries times
+	VerifyOutput  bool
+	VerifyRetries int
+	//Name is a template the outputs are named with instead of their image's name, {name} is replaced with the
+	//image's name without its extension and {seq} with its number in path order, "" keeps the image's name
+	Name     string
+	sequence *imageSequence
+	//PreviewMax converts the largest embedded JPEG preview instead of decoding the raw data, downscaled so neither
+	//side is longer than it in pixels, which is much faster for web sized outputs, 0 decodes the raw data
+	PreviewMax int
+	//MinWidth and MinHeight skip images narrower or shorter than them in pixels, read from their IFDs without
+	//decoding them, 0 doesn't check that side
+	MinWidth      int
+	MinHeight     int
+	minDimensions *dimensionFilter
+	//Stdout writes the single raw image at LocationPath, or read from stdin if it's - with its type given by
+	//InputType, to stdout as the one output type, instead of to the output directory, and prints nothing else to stdout
+	Stdout bool
+	//CopyProfile embeds the source image's ICC color profile into the outputs, if it has one
+	CopyProfile bool
+	//CopyGPS writes the location and time of the source image's GPS IFD into JPEG outputs, none of the source's
+	//other metadata is carried over
+	CopyGPS bool
+	//OnProgress is called as images finish with how many have finished, how many were found, 0 if they weren't
+	//counted up front, and the path of the image which just finished. Calls are made one at a time, from a goroutine
+	//of their own, and at most every progressInterval apart, other than the call for the last image
+	OnProgress func(done int, total int, current string)
+	//locationPaths are the directories and zip archives in LocationPath, which can be a comma separated list of them
+	locationPaths []string
+}
+
+//rtcTotals are the running totals of a run of the raw to compressed image conversion tool, which all of the
+//conversion goroutines add to at once, so they're only updated atomically
+type rtcTotals struct {
+	//the byte counts go first so they're 64-bit aligned for atomic access on 32-bit platforms
+	inputBytes      uint64
+	outputBytes     uint64
+	convertedImages uint32
+	//images are skipped if all of their outputs already exist or they're older than -since
+	skippedImages uint32
+	failedImages  uint32
+}
+
+//ConversionStatus is what happened to an image in a run of the raw to compressed image conversion tool
+type ConversionStatus int
+
+const (
+	//ConversionConverted is an image which was written as all of the output types
+	ConversionConverted ConversionStatus = iota
+	//ConversionSkipped is an image which was left alone, as all of its outputs already exist or it's older than Since
+	ConversionSkipped
+	//ConversionFailed is an image which couldn't be decoded, or couldn't be written as some of the output types
+	ConversionFailed
+)
+
+//ConversionResult is what happened to a single image, Outputs are the paths it was written to, or the names of
+//its entries when writing to a zip archive, and Err is why it failed
+type ConversionResult struct {
+	Source  string
+	Outputs []string
+	Status  ConversionStatus
+	Err     error
+}
+
+//ErrMissingRtcOptions is returned by RunRtc when it isn't given images to convert or a type to convert them to
+var ErrMissingRtcOptions = errors.New("A location or file list, input type and output type are needed to convert images")
+
+//RunRtc runs the raw to compressed image conversion tool, returning what happened to each image it found, or an
+//error if the options aren't valid
+func RunRtc(opts RtcOptions) ([]ConversionResult, error) {
+	if (len(opts.From) == 0 && (len(opts.LocationPath) == 0 || (len(opts.InputType) == 0 && !opts.Stdout))) || (len(opts.OutputType) == 0 && !opts.List) {
+		return nil, ErrMissingRtcOptions
 	}
 
-	fmt.Printf("Clover - Running Raw To Compressed tool...\n")
+	if opts.List && len(opts.From) == 0 {
+		//nothing else is printed, so the list can be read by other tools
+		return nil, listImages(os.Stdout, parseLocationPaths(opts.LocationPath), opts.InputType, opts.Recursive)
+	}
 
-	var st time.Time
-	if timeStamp {
-		st = time.Now()
+	//stdout is left to the converted image
+	if !opts.Stdout {
+		fmt.Printf("Clover - Running Raw To Compressed tool...\n")
 	}
 
-	err := createDirectoryIfNotExists(outputDirectory)
-	if err != nil {
-		logging.Error(err.Error())
-		return
+	st := time.Now()
+
+	if len(opts.OnExist) == 0 {
+		opts.OnExist = OnExistSkip
+	}
+	opts.OnExist = OnExistPolicy(strings.ToLower(string(opts.OnExist)))
+	if !utils.SSliceContains(supportedOnExistPolicies, string(opts.OnExist)) {
+		return nil, fmt.Errorf("On exist policy %s not supported, must be one of %s", opts.OnExist, strings.Join(supportedOnExistPolicies, ", "))
 	}
 
-	var convertedImageCount uint32
-	supportedInputTypes := []string{".nef"}
+	if !opts.Stdout && utils.SSliceContains(parseLocationPaths(opts.LocationPath), locationStdin) {
+		return nil, errors.New("Reading a raw image from stdin needs its output written to stdout, there's no name to save it under")
+	}
+
+	var err error
+	if len(opts.From) > 0 {
+		if len(opts.LocationPath) > 0 || opts.Watch || opts.List || opts.RetainFolderStructure {
+			return nil, errors.New("Images from a file list can't be combined with a location, watching, listing or retaining folder structure")
+		}
+		if opts.imagePaths, err = readFileList(opts.From); err != nil {
+			return nil, err
+		}
+	}
+
+	//nothing is written to the output directory when writing to stdout
+	if len(opts.ZipPath) == 0 && !opts.Stdout {
+		if err = createDirectoryIfNotExists(opts.OutputDirectory); err != nil {
+			return nil, err
+		}
+	} else if _, err = os.Stat(opts.ZipPath); err == nil {
+		switch opts.OnExist {
+		case OnExistOverwrite:
+		case OnExistBackup:
+			if err = backupOutput(opts.ZipPath); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Zip archive %s already exists", opts.ZipPath)
+		}
+	}
+
+	var totals rtcTotals
+	supportedInputTypes := img.RegisteredTypes()
 	supportedOutputTypes := []string{".jpg", ".png"}
 
-	inputTypePrefixToMatch, inputType, err := parseInputOutputTypes(inputType, outputType, supportedInputTypes, supportedOutputTypes)
+	var inputTypePrefixToMatch string
+	//the image's type is its extension when writing it to stdout
+	if len(opts.From) == 0 && !opts.Stdout {
+		var inputType string
+		inputTypePrefixToMatch, inputType, err = parseInputOutputTypes(opts.InputType, "", supportedInputTypes, supportedOutputTypes)
+		if err != nil {
+			return nil, err
+		}
+		opts.InputType = inputType
+	}
+
+	opts.OutputTypes, err = parseOutputTypes(opts.OutputType, supportedOutputTypes)
 	if err != nil {
-		logging.Error(err.Error())
-		return
+		return nil, err
 	}
 
-	doneSearchingChan := make(chan bool, 32)
-	imagesToConvertChan := make(chan img.TiffImage, 32)
+	if opts.since, err = newSinceFilter(opts.Since); err != nil {
+		return nil, err
+	}
 
-	if isDir, err := isDirectory(locationpath); isDir {
-		//file searching wait group
-		var fswg sync.WaitGroup
-		//images to convert wait group
-		var icwg sync.WaitGroup
-		//add a wait for the initial single call of 'findImagesInDir'
-		fswg.Add(1)
-		go findImagesInDir(&fswg, &imagesToConvertChan, &doneSearchingChan, locationpath, inputTypePrefixToMatch, inputType, recursive)
-		//add a wait for the call of 'convertRawImagesToCompressed'
-		icwg.Add(1)
-		go convertRawImagesToCompressed(&icwg, &imagesToConvertChan, &doneSearchingChan, inputType, outputType, showConversionOutput, overwrite, retainFolderStructure, locationpath, outputDirectory, &convertedImageCount)
-		//main thread doesn't wait after firing these goroutines, so force it to
-		//wait until the file searching thread has finished
-		fswg.Wait()
-		//then tell the image conversion goroutine that there's no more images coming to convert
-		doneSearchingChan <- true
-		//wait on the image conversion goroutine until it's finished converting all images it's already been working on
-		icwg.Wait()
-		//both worker goroutines have finished, main thread continues
+	opts.locationPaths = parseLocationPaths(opts.LocationPath)
+	if opts.Stdout {
+		//the location is the raw image itself
+		if err = validateStdoutOptions(opts); err != nil {
+			return nil, err
+		}
 	} else {
-		if err != nil {
-			logging.ErrorAndExit(err.Error())
+		for _, locationPath := range opts.locationPaths {
+			if isDir, err := isDirectory(locationPath); !isDir && !isZipArchive(locationPath) {
+				if err != nil {
+					return nil, err
+				}
+				return nil, fmt.Errorf("Location %s isn't a directory or zip archive", locationPath)
+			}
+			if opts.Watch && isZipArchive(locationPath) {
+				return nil, errors.New("Zip archives can't be watched for new images")
+			}
+		}
+	}
+
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.IOWorkers < 1 {
+		opts.IOWorkers = 1
+	}
+
+	if opts.FailFast && opts.Watch {
+		return nil, errors.New("Fail fast can't be used when watching for new images")
+	}
+	opts.failFast = &failFast{enabled: opts.FailFast}
+
+	if opts.Brightness < -100 || opts.Brightness > 100 || opts.Contrast < -100 || opts.Contrast > 100 {
+		return nil, errors.New("Brightness and contrast must be from -100 to 100")
+	}
+
+	if opts.Rotate%90 != 0 || opts.Rotate < 0 || opts.Rotate > 270 {
+		return nil, fmt.Errorf("Rotation of %d degrees not supported, must be 0, 90, 180 or 270", opts.Rotate)
+	}
+
+	if opts.Progressive && opts.MaxSize > 0 {
+		return nil, errors.New("Progressive JPEGs can't be written with a max size")
+	}
+
+	if len(opts.Aspect) > 0 {
+		if opts.aspectWidth, opts.aspectHeight, err = parseAspectRatio(opts.Aspect); err != nil {
+			return nil, err
 		}
 	}
-	close(doneSearchingChan)
+
+	opts.Flip = strings.ToLower(opts.Flip)
+	if opts.Flip != "" && opts.Flip != "h" && opts.Flip != "v" {
+		return nil, fmt.Errorf("Flip %s not supported, must be h or v", opts.Flip)
+	}
+
+	if opts.DPI < 0 || opts.DPI > math.MaxUint16 {
+		return nil, fmt.Errorf("DPI of %d not supported, must be from 1 to %d", opts.DPI, math.MaxUint16)
+	}
+
+	if opts.Border < 0 {
+		return nil, errors.New("Border width can't be negative")
+	}
+
+	if opts.MinWidth < 0 || opts.MinHeight < 0 {
+		return nil, errors.New("Minimum width and height can't be negative")
+	}
+	opts.minDimensions = newDimensionFilter(opts.MinWidth, opts.MinHeight)
+
+	if opts.PreviewMax < 0 {
+		return nil, errors.New("Preview max size can't be negative")
+	}
+
+	if opts.VerifyRetries < 0 {
+		return nil, errors.New("Verify retries can't be negative")
+	}
+
+	if len(opts.Name) > 0 {
+		if err = validateNameTemplate(opts.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	//the images are numbered before any are converted, so each number only depends on the image's path
+	if strings.Contains(opts.Name, nameTokenSeq) {
+		if opts.Watch {
+			return nil, fmt.Errorf("Images can't be numbered with %s when watching for new images", nameTokenSeq)
+		}
+		if len(opts.From) > 0 {
+			opts.sequence = newImageSequence(opts.imagePaths)
+		} else if opts.sequence, err = scanImageSequence(opts.locationPaths, inputTypePrefixToMatch, opts.InputType, opts.Recursive); err != nil {
+			return nil, fmt.Errorf("Unable to number images -> %v", err)
+		}
+	}
+
+	if opts.Border > 0 {
+		if opts.borderColor, err = img.ParseHexColor(opts.BorderColor); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Stdout {
+		return convertToStdout(opts)
+	}
+
+	//new images are found as they're written when watching, so there's nothing to count up front
+	var imageCount int
+	if !opts.NoScan && !opts.Watch {
+		imageCount = len(opts.imagePaths)
+		var countErr error
+		if len(opts.From) == 0 {
+			imageCount, countErr = countImages(opts.locationPaths, inputTypePrefixToMatch, opts.InputType, opts.Recursive)
+		}
+		if countErr != nil {
+			logging.Error(fmt.Sprintf("Unable to count images -> %v", countErr))
+			imageCount = 0
+		} else {
+			fmt.Printf("Found %d images to convert\n", imageCount)
+		}
+	}
+
+	//closed once the searching is done, which ends each reading goroutine after it's read what's left
+	imagesToReadChan := make(chan img.TiffImage, 32)
+	//closed once the reading is done, which ends each conversion goroutine after it's converted what's left, it's only
+	//as big as the number of conversion goroutines, as images read from a zip archive are held in memory which
+	//-maxmem doesn't count, so the readers can't get far ahead of the conversions
+	imagesToConvertChan := make(chan img.TiffImage, opts.Workers)
+	//file searching wait group
+	var fswg sync.WaitGroup
+	//images to read wait group
+	var irwg sync.WaitGroup
+	//images to convert wait group
+	var icwg sync.WaitGroup
+	if len(opts.ZipPath) > 0 {
+		if opts.zip, err = newZipOutput(opts.ZipPath); err != nil {
+			return nil, err
+		}
+	}
+	//closed once the conversion goroutines have finished, after they've each sent the result of every image
+	conversionResultsChan := make(chan ConversionResult, 32)
+	var results []ConversionResult
+	resultsCollected := make(chan struct{})
+	go func() {
+		var lastProgress time.Time
+		var reportedDone int
+		for result := range conversionResultsChan {
+			results = append(results, result)
+			if opts.OnProgress != nil && (time.Since(lastProgress) >= progressInterval || len(results) == imageCount) {
+				opts.OnProgress(len(results), imageCount, result.Source)
+				lastProgress, reportedDone = time.Now(), len(results)
+			}
+		}
+		//the last image is always reported, even if the count was off or it came too soon after the one before
+		if opts.OnProgress != nil && reportedDone != len(results) {
+			opts.OnProgress(len(results), imageCount, results[len(results)-1].Source)
+		}
+		close(resultsCollected)
+	}()
+	//all the conversion workers share the one memory budget
+	limiter := newMemoryLimiter(opts.MaxMemory)
+	//every location's watch stops when this is closed, on interrupt
+	stopWatching := make(chan struct{})
+	if opts.Watch {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(interrupt)
+		go func() {
+			<-interrupt
+			close(stopWatching)
+		}()
+	}
+	for _, locationPath := range opts.locationPaths {
+		//add a wait for the initial single call of 'findImagesInDir' for each location
+		fswg.Add(1)
+		if opts.Watch {
+			logging.Info(fmt.Sprintf("Watching %s for new images, interrupt to stop...", locationPath))
+			go watchForImages(&fswg, &imagesToReadChan, locationPath, inputTypePrefixToMatch, opts.InputType, opts.Recursive, stopWatching)
+		} else if isZipArchive(locationPath) {
+			//the images in an archive are read straight out of it, so it's kept open until they've all been converted
+			zipReader, err := zip.OpenReader(locationPath)
+			if err != nil {
+				logging.Error(err.Error())
+				fswg.Done()
+				continue
+			}
+			defer zipReader.Close()
+			go findImagesInZip(&fswg, &imagesToReadChan, &zipReader.Reader, locationPath, inputTypePrefixToMatch, opts.InputType, opts.Recursive)
+		} else {
+			go findImagesInDir(&fswg, &imagesToReadChan, locationPath, inputTypePrefixToMatch, opts.InputType, opts.Recursive)
+		}
+	}
+	if len(opts.From) > 0 {
+		fswg.Add(1)
+		go findImagesInFileList(&fswg, &imagesToReadChan, opts.imagePaths)
+	}
+	//add a wait for each call of 'readRawImages'
+	for i := 0; i < opts.IOWorkers; i++ {
+		irwg.Add(1)
+		go readRawImages(&irwg, &imagesToReadChan, &imagesToConvertChan, &conversionResultsChan, opts, &totals)
+	}
+	//add a wait for each call of 'convertRawImagesToCompressed'
+	for i := 0; i < opts.Workers; i++ {
+		icwg.Add(1)
+		go convertRawImagesToCompressed(&icwg, &imagesToConvertChan, &conversionResultsChan, opts, limiter, &totals)
+	}
+	//main thread doesn't wait after firing these goroutines, so force it to
+	//wait until the file searching threads have finished
+	fswg.Wait()
+	//then tell the image reading goroutines that there's no more images coming to read, and once they've passed on
+	//the ones they're reading, tell the image conversion goroutines the same, nothing else sends on or closes
+	//either channel, so this is safe
+	close(imagesToReadChan)
+	irwg.Wait()
 	close(imagesToConvertChan)
-	var plural string
-	if convertedImageCount != 1 {
-		plural = "s"
-	} else {
-		plural = ""
+	//wait on the image conversion goroutines until they've finished converting all images they've already been working on
+	icwg.Wait()
+	//all worker goroutines have finished, so no more results are coming either
+	close(conversionResultsChan)
+	<-resultsCollected
+	if err := opts.since.save(); err != nil {
+		logging.Error(fmt.Sprintf("Unable to save state file %s -> %v", opts.Since, err))
+	}
+	if opts.zip != nil {
+		if err = opts.zip.close(); err != nil {
+			err = fmt.Errorf("Unable to finish writing zip archive %s -> %v", opts.ZipPath, err)
+		}
 	}
-	logging.Info(fmt.Sprintf("Successfully converted %d raw image%s", convertedImageCount, plural))
-	if timeStamp {
-		logging.Info(fmt.Sprintf("Time taken: %d ms", time.Since(st).Nanoseconds()/1000000))
+	if err == nil {
+		//all the conversion goroutines have finished, so the failure can't change now
+		err = opts.failFast.err
 	}
+	outputRtcSummary(os.Stdout, &totals, time.Since(st))
+	if len(opts.Summary) > 0 {
+		if summaryErr := writeRunSummary(opts.Summary, rtcRunSummary(&totals, results), time.Since(st)); summaryErr != nil {
+			logging.Error(summaryErr.Error())
+		}
+	}
+	return results, err
 }
 
-func findImagesInDir(wg *sync.WaitGroup, itcc *chan img.TiffImage, dsc *chan bool, locationPath string, inputTypePrefixToMatch string, inputType string, recursive bool) {
+//findImagesInDir sends each image in the location to itcc, searching its sub directories at the same time if
+//recursive, wg is done once the location and all of its sub directories have been searched
+func findImagesInDir(wg *sync.WaitGroup, itcc *chan img.TiffImage, locationPath string, inputTypePrefixToMatch string, inputType string, recursive bool) {
 	defer wg.Done()
 	files, err := ioutil.ReadDir(locationPath)
 	if err != nil {
@@ -100,140 +527,576 @@ func findImagesInDir(wg *sync.WaitGroup, itcc *chan img.TiffImage, dsc *chan boo
 	for i := range files {
 		file := files[i]
 		if !file.IsDir() {
-			if strings.HasSuffix(strings.ToLower(file.Name()), strings.ToLower(inputType)) {
-				if inputTypePrefixToMatch != "*" {
-					if !strings.Contains(file.Name(), inputTypePrefixToMatch) {
-						continue
-					}
-				}
+			if matchesInputType(file.Name(), inputTypePrefixToMatch, inputType) {
 				image, err := os.Open(utils.TranslatePath(path.Join(locationPath, file.Name())))
 				if err != nil {
 					logging.Error(err.Error())
 					continue
 				}
-				var ti img.TiffImage
-				switch inputType {
-				case ".nef":
-					ti = &img.NefImage{
-						img.RawImage{
-							File: image,
-						},
-					}
-				case ".cr2":
-					ti = &img.Cr2Image{
-						img.RawImage{
-							File: image,
-						},
-					}
-				}
-				if ti != nil {
-					*itcc <- ti
-					*dsc <- false
+				ti, ok := img.NewImage(inputType, img.RawImage{File: image})
+				if !ok {
+					image.Close()
+					continue
 				}
+				*itcc <- ti
 			}
-		} else {
-			if file.IsDir() && recursive {
-				wg.Add(1)
-				findImagesInDir(wg, itcc, dsc, utils.TranslatePath(path.Join(locationPath, file.Name())), inputTypePrefixToMatch, inputType, recursive)
-			}
+		} else if recursive {
+			//added to before this search is done, so the wait group can't reach zero with sub directories left
+			wg.Add(1)
+			go findImagesInDir(wg, itcc, utils.TranslatePath(path.Join(locationPath, file.Name())), inputTypePrefixToMatch, inputType, recursive)
 		}
 	}
 }
 
-func convertRawImagesToCompressed(wg *sync.WaitGroup, itcc *chan img.TiffImage, dsc *chan bool, inputType string, outputType string, showConversionOutput bool, overwrite bool, retainFolderStructure bool, inputDirectory string, outputDirectory string, convertedImageCount *uint32) {
-	for {
-		if !<-*dsc {
-			ri := <-*itcc
-			wg.Add(1)
-			if ri != nil {
-				convertToCompressed(ri, inputType, outputType, showConversionOutput, overwrite, retainFolderStructure, inputDirectory, outputDirectory, convertedImageCount)
-			}
-			wg.Done()
-		} else {
-			wg.Done()
+//matchesInputType returns true if the file name has the input type's extension, with a name before it, and,
+//unless it's *, contains its prefix
+func matchesInputType(fileName string, inputTypePrefixToMatch string, inputType string) bool {
+	if len(fileName) <= len(inputType) || !strings.HasSuffix(strings.ToLower(fileName), strings.ToLower(inputType)) {
+		return false
+	}
+	return inputTypePrefixToMatch == "*" || strings.Contains(fileName, inputTypePrefixToMatch)
+}
+
+//readRawImages reads the IFDs of each image received from itrc, so the conversion goroutines it passes them on
+//to over itcc only have to decode and encode them, images which are filtered out are skipped here
+func readRawImages(wg *sync.WaitGroup, itrc *chan img.TiffImage, itcc *chan img.TiffImage, crc *chan ConversionResult, opts RtcOptions, totals *rtcTotals) {
+	defer wg.Done()
+	for ri := range *itrc {
+		if ri == nil {
+			continue
+		}
+		if opts.failFast.isStopped() {
+			//left alone, so it has to be tried again next run
+			opts.since.track(ri)(false)
+			ri.GetRawImage().File.Close()
+			continue
 		}
+		if !opts.since.include(ri) || !opts.minDimensions.include(ri) {
+			opts.since.track(ri)(true)
+			ri.GetRawImage().File.Close()
+			atomic.AddUint32(&totals.skippedImages, 1)
+			*crc <- ConversionResult{Source: ri.GetRawImage().File.Name(), Status: ConversionSkipped}
+			continue
+		}
+		//the IFDs are kept once read, so converting it doesn't read them again, an image which can't be read is
+		//still passed on, to fail during conversion
+		ri.Load()
+		*itcc <- ri
 	}
 }
 
-func convertToCompressed(ti img.TiffImage, inputType string, outputType string, showConversionOutput bool, overwrite bool, retainFolderStructure bool, inputDirectory string, outputDirectory string, convertedImageCount *uint32) {
-	if ti == nil {
-		return
+//convertRawImagesToCompressed converts each image received from itcc, sending the result of each to crc, once an
+//image has failed with fail fast the rest are only closed
+func convertRawImagesToCompressed(wg *sync.WaitGroup, itcc *chan img.TiffImage, crc *chan ConversionResult, opts RtcOptions, limiter *memoryLimiter, totals *rtcTotals) {
+	defer wg.Done()
+	for ri := range *itcc {
+		if ri == nil {
+			continue
+		}
+		done := opts.since.track(ri)
+		if opts.failFast.isStopped() {
+			done(false)
+			ri.GetRawImage().File.Close()
+			continue
+		}
+		//wait for enough of the memory budget to be free before decoding
+		reserved := limiter.acquire(estimateDecodeMemory(ri))
+		result := convertToCompressed(ri, opts, totals)
+		limiter.release(reserved)
+		done(result.Status != ConversionFailed)
+		if result.Status == ConversionFailed {
+			opts.failFast.fail(result)
+		}
+		*crc <- result
 	}
+}
 
-	if ti.GetRawImage().File == nil {
-		return
+//decodeLargestPreview decodes the largest JPEG preview embedded in the image, downscaled so neither side is longer
+//than maxDimension
+func decodeLargestPreview(ti img.TiffImage, maxDimension int) (image.Image, error) {
+	if err := ti.Load(); err != nil {
+		return nil, err
+	}
+	previews, err := ti.GetPreviews()
+	if err != nil {
+		return nil, err
+	}
+	largest := previews[0]
+	for _, preview := range previews[1:] {
+		if preview.Width*preview.Height > largest.Width*largest.Height {
+			largest = preview
+		}
+	}
+	decodedPreview, err := jpeg.Decode(bytes.NewReader(largest.Data))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode embedded preview -> %v", err)
+	}
+	return img.Downscale(decodedPreview, maxDimension), nil
+}
+
+//transformImage applies the adjustments picked in the options to the decoded image, before it's encoded to each
+//of the output types
+func transformImage(decodedImage image.Image, opts RtcOptions) image.Image {
+	if opts.aspectWidth > 0 && opts.aspectHeight > 0 {
+		//the ratio is checked before any images are converted
+		if croppedImage, err := img.CropToAspectRatio(decodedImage, opts.aspectWidth, opts.aspectHeight); err == nil {
+			decodedImage = croppedImage
+		}
+	}
+	if opts.Gray {
+		decodedImage = img.Grayscale(decodedImage)
+	}
+	if opts.Brightness != 0 || opts.Contrast != 0 {
+		decodedImage = img.AdjustBrightnessContrast(decodedImage, opts.Brightness, opts.Contrast)
+	}
+	//the rotation is checked before any images are converted
+	if rotatedImage, err := img.Rotate(decodedImage, opts.Rotate); err == nil {
+		decodedImage = rotatedImage
+	}
+	if len(opts.Flip) > 0 {
+		decodedImage = img.Flip(decodedImage, opts.Flip == "h")
+	}
+	if opts.Border > 0 {
+		decodedImage = img.AddBorder(decodedImage, opts.Border, opts.borderColor)
+	}
+	return decodedImage
+}
+
+//convertToCompressed writes the image as each of the output types, returning what was written
+func convertToCompressed(ti img.TiffImage, opts RtcOptions, totals *rtcTotals) ConversionResult {
+	if ti == nil || ti.GetRawImage().File == nil {
+		atomic.AddUint32(&totals.failedImages, 1)
+		return ConversionResult{Status: ConversionFailed, Err: errors.New("Image has no file to convert")}
 	}
 
 	defer ti.GetRawImage().File.Close()
+	result := ConversionResult{Source: ti.GetRawImage().File.Name()}
+	if !hasNameBeforeExtension(result.Source) {
+		logging.Error(fmt.Sprintf("Skipping %s, it has no name before its extension to name outputs with", result.Source))
+		atomic.AddUint32(&totals.skippedImages, 1)
+		result.Status = ConversionSkipped
+		return result
+	}
+	//timed on its own to show how long each image took, which is separate to the time taken by the whole run
+	ct := time.Now()
 
 	sb := strings.Builder{}
-	sb.WriteString(strings.TrimRight(outputDirectory, string(os.PathSeparator)))
+	sb.WriteString(strings.TrimRight(opts.OutputDirectory, string(os.PathSeparator)))
 
-	if retainFolderStructure {
-		subDirToAdd := strings.Replace(ti.GetRawImage().File.Name(), inputDirectory, "", -1)
-		subDirToAdd = strings.Replace(subDirToAdd, filepath.Base(ti.GetRawImage().File.Name()), "", -1)
+	if opts.RetainFolderStructure && opts.zip == nil {
+		subDirToAdd := retainedSubDirectory(ti, opts)
 		if subDirToAdd != string(os.PathSeparator) {
 			sb.WriteString(string(os.PathSeparator))
 		}
 		sb.WriteString(subDirToAdd)
 		if err := createDirectoryIfNotExists(sb.String()); err != nil {
 			logging.Error(err.Error())
-			return
+			atomic.AddUint32(&totals.failedImages, 1)
+			result.Status, result.Err = ConversionFailed, err
+			return result
 		}
 	}
 
-	var fileNameToAdd string
-	fileNameToAdd = filepath.Base(ti.GetRawImage().File.Name())
-	fileNameToAdd = strings.Replace(fileNameToAdd, inputType, outputType, 1)
-	fileNameToAdd = strings.Replace(fileNameToAdd, strings.ToUpper(inputType), strings.ToUpper(outputType), 1)
-
-	if !retainFolderStructure {
+	if !opts.RetainFolderStructure {
 		sb.WriteRune(os.PathSeparator)
 	}
 
-	sb.WriteString(fileNameToAdd)
+	if opts.ShowConversionOutput {
+		logging.InfoNoColor(fmt.Sprintf("Converting image %s to %s", ti.GetRawImage().File.Name(), strings.Join(opts.OutputTypes, ", ")))
+	}
 
-	outputPath := utils.TranslatePath(sb.String())
+	var sourceModTime time.Time
+	var sourceSize uint64
+	if sourceInfo, err := ti.GetRawImage().File.Stat(); err == nil {
+		sourceModTime, sourceSize = sourceInfo.ModTime(), uint64(sourceInfo.Size())
+	}
 
-	if showConversionOutput {
-		logging.InfoNoColor(fmt.Sprintf("Converting image %s to %s", ti.GetRawImage().File.Name(), outputType))
+	//the on exist policy is applied to each output file on its own
+	var outputTypes []string
+	var outputPaths []string
+	var zipEntryNames []string
+	for _, outputType := range opts.OutputTypes {
+		outputName := expandNameTemplate(opts.Name, ti.GetRawImage().File.Name(), outputType, opts.sequence)
+		if opts.zip != nil {
+			//outputs are written to temporary files first, then added to the archive under the path they'd
+			//have in the output directory
+			outputPath, err := opts.zip.tempPath(outputType)
+			if err != nil {
+				logging.Error(err.Error())
+				atomic.AddUint32(&totals.failedImages, 1)
+				result.Status, result.Err = ConversionFailed, err
+				return result
+			}
+			zipEntryName := outputName
+			if opts.RetainFolderStructure {
+				zipEntryName = path.Join(filepath.ToSlash(retainedSubDirectory(ti, opts)), outputName)
+			}
+			outputTypes = append(outputTypes, outputType)
+			outputPaths = append(outputPaths, outputPath)
+			zipEntryNames = append(zipEntryNames, strings.TrimLeft(zipEntryName, "/"))
+			continue
+		}
+		outputPath, write := resolveExistingOutput(utils.TranslatePath(sb.String()+outputName), sourceModTime, opts.OnExist)
+		if !write {
+			if opts.ShowConversionOutput {
+				logging.Error(fmt.Sprintf(" [FAILED] (Output result file %s already exists.)", outputPath))
+			}
+			continue
+		}
+		outputTypes = append(outputTypes, outputType)
+		outputPaths = append(outputPaths, outputPath)
+	}
+	if len(outputPaths) == 0 {
+		atomic.AddUint32(&totals.skippedImages, 1)
+		result.Status = ConversionSkipped
+		return result
 	}
 
-	if _, err := os.Stat(outputPath); err == nil && !overwrite {
-		if showConversionOutput {
-			logging.Error(" [FAILED] (Output result file already exists.)")
+	//decode once, then encode to each of the output types
+	var decodedImage image.Image
+	var err error
+	if opts.PreviewMax > 0 {
+		decodedImage, err = decodeLargestPreview(ti, opts.PreviewMax)
+	} else {
+		decodedImage, err = ti.Decode()
+	}
+	if err != nil {
+		if opts.ShowConversionOutput {
+			logging.Error(fmt.Sprintf(" [FAILED] (%s) (%d ms)", err.Error(), time.Since(ct).Nanoseconds()/1000000))
 		}
-		return
+		atomic.AddUint32(&totals.failedImages, 1)
+		result.Status, result.Err = ConversionFailed, err
+		return result
+	}
+
+	decodedImage = transformImage(decodedImage, opts)
+
+	metadata := newOutputMetadata(ti.GetRawImage(), opts)
+
+	succussfullyConvertedImage := true
+	var outputSize uint64
+	//outputs which weren't smaller or larger than the existing file they'd have replaced
+	var keptOutputs int
+	for i, outputPath := range outputPaths {
+		if opts.OnExist == OnExistBackup && opts.zip == nil {
+			if err := backupOutput(outputPath); err != nil {
+				if opts.ShowConversionOutput {
+					logging.Error(fmt.Sprintf(" [FAILED] (%s: %s)", outputPath, err.Error()))
+				}
+				succussfullyConvertedImage = false
+				result.Err = err
+				continue
+			}
+		}
+		var err error
+		existingInfo, existsErr := os.Stat(outputPath)
+		if (opts.OnExist == OnExistSmaller || opts.OnExist == OnExistLarger) && opts.zip == nil && existsErr == nil {
+			//encoded in memory first, so the existing output is only touched if the new one wins
+			var replaced bool
+			if replaced, err = replaceIfSizeWins(decodedImage, outputTypes[i], outputPath, existingInfo.Size(), opts, metadata); err == nil && !replaced {
+				if opts.ShowConversionOutput {
+					logging.Error(fmt.Sprintf(" [SKIPPED] (Output result file %s isn't %s than the existing one.)", outputPath, opts.OnExist))
+				}
+				keptOutputs++
+				continue
+			}
+		} else {
+			err = writeOutput(decodedImage, outputTypes[i], outputPath, opts, metadata)
+		}
+		if err == img.ErrJPEGTargetSizeExceeded {
+			logging.Error(fmt.Sprintf(" [WARNING] (%s: %s, written at lowest quality)", outputPath, err.Error()))
+		} else if err != nil {
+			if opts.ShowConversionOutput {
+				logging.Error(fmt.Sprintf(" [FAILED] (%s: %s)", outputPath, err.Error()))
+			}
+			succussfullyConvertedImage = false
+			result.Err = err
+			continue
+		}
+		if outputInfo, err := os.Stat(outputPath); err == nil {
+			outputSize += uint64(outputInfo.Size())
+		}
+		if opts.zip != nil {
+			opts.zip.add(zipEntryNames[i], outputPath)
+			result.Outputs = append(result.Outputs, zipEntryNames[i])
+		} else {
+			result.Outputs = append(result.Outputs, outputPath)
+		}
+	}
+
+	if succussfullyConvertedImage && keptOutputs == len(outputPaths) {
+		atomic.AddUint32(&totals.skippedImages, 1)
+		result.Status = ConversionSkipped
+	} else if succussfullyConvertedImage {
+		if opts.ShowConversionOutput {
+			logging.Info(fmt.Sprintf(" [SUCCESS] (%d ms)", time.Since(ct).Nanoseconds()/1000000))
+		}
+		atomic.AddUint32(&totals.convertedImages, 1)
+		atomic.AddUint64(&totals.inputBytes, sourceSize)
+		atomic.AddUint64(&totals.outputBytes, outputSize)
+		result.Status = ConversionConverted
+	} else {
+		atomic.AddUint32(&totals.failedImages, 1)
+		result.Status = ConversionFailed
+	}
+	return result
+}
+
+//resolveExistingOutput applies the on exist policy to the output path, returning the path to write the output to,
+//which is only different when renaming, and false if there's a file there which should be left alone
+func resolveExistingOutput(outputPath string, sourceModTime time.Time, policy OnExistPolicy) (string, bool) {
+	outputInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return outputPath, true
+	}
+	switch policy {
+	case OnExistOverwrite, OnExistBackup, OnExistSmaller, OnExistLarger:
+		return outputPath, true
+	case OnExistNewer:
+		//the image has changed since it was converted
+		return outputPath, outputInfo.ModTime().Before(sourceModTime)
+	case OnExistRename:
+		return nextFreeOutputPath(outputPath), true
+	}
+	return outputPath, false
+}
+
+//nextFreeOutputPath returns the output path with the lowest number from 1 up that isn't taken added to its name,
+//e.g. image_1.jpg
+func nextFreeOutputPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	for i := 1; ; i++ {
+		renamedPath := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Lstat(renamedPath); os.IsNotExist(err) {
+			return renamedPath
+		}
+	}
+}
+
+//hasNameBeforeExtension returns true if the base name of the file isn't only its extension, e.g. .nef, as its
+//outputs would be named with nothing but their own extension
+func hasNameBeforeExtension(filePath string) bool {
+	return len(utils.RemoveExtension(filepath.Base(filePath))) > 0
+}
+
+//backupOutput renames an existing output to <name>.bak, or if that's taken to <name>.<time>.bak, so overwriting
+//it doesn't lose it
+func backupOutput(outputPath string) error {
+	if _, err := os.Lstat(outputPath); os.IsNotExist(err) {
+		return nil
 	}
+	backupPath := outputPath + ".bak"
+	if _, err := os.Lstat(backupPath); err == nil {
+		backupPath = fmt.Sprintf("%s.%s.bak", outputPath, time.Now().Format("20060102150405.000000000"))
+	}
+	if err := os.Rename(outputPath, backupPath); err != nil {
+		return fmt.Errorf("Unable to back up existing output -> %v", err)
+	}
+	return nil
+}
+
+//replaceIfSizeWins encodes the output in memory and writes it over the existing output of existingSize bytes if it's
+//smaller, or larger for OnExistLarger, returning true if the existing output was replaced
+func replaceIfSizeWins(decodedImage image.Image, outputType string, outputPath string, existingSize int64, opts RtcOptions, metadata outputMetadata) (bool, error) {
+	data, err := encodeOutput(decodedImage, outputType, opts, metadata)
+	if err != nil && err != img.ErrJPEGTargetSizeExceeded {
+		return false, err
+	}
+	if !sizeWins(int64(len(data)), existingSize, opts.OnExist) {
+		return false, nil
+	}
+	if writeErr := writeOutputFile(outputPath, data); writeErr != nil {
+		return false, fmt.Errorf("Unable to replace existing output -> %v", writeErr)
+	}
+	if opts.VerifyOutput {
+		if verifyErr := verifyOutput(outputPath, outputType, decodedImage.Bounds()); verifyErr != nil {
+			logging.Error(fmt.Sprintf("%s, writing it again", verifyErr.Error()))
+			return true, writeOutput(decodedImage, outputType, outputPath, opts, metadata)
+		}
+	}
+	return true, err
+}
+
+//sizeWins returns whether an output of newSize bytes should replace an existing one of existingSize bytes, it has to
+//be strictly smaller, or larger for OnExistLarger
+func sizeWins(newSize int64, existingSize int64, policy OnExistPolicy) bool {
+	if policy == OnExistLarger {
+		return newSize > existingSize
+	}
+	return newSize < existingSize
+}
+
+//retainedSubDirectory returns the directory of the image relative to the location being converted, which its
+//outputs are put under when retaining the folder structure
+func retainedSubDirectory(ti img.TiffImage, opts RtcOptions) string {
+	fileName := ti.GetRawImage().File.Name()
+	//with more than one location the image's is the longest one it's in, as a location could be inside another
+	locationPath := opts.LocationPath
+	if len(opts.locationPaths) > 0 {
+		locationPath = ""
+		for _, lp := range opts.locationPaths {
+			if strings.HasPrefix(fileName, lp) && len(lp) > len(locationPath) {
+				locationPath = lp
+			}
+		}
+	}
+	subDir := strings.Replace(fileName, locationPath, "", -1)
+	return strings.Replace(subDir, filepath.Base(ti.GetRawImage().File.Name()), "", -1)
+}
+
+//outputMetadata is what's carried over from the raw image into its outputs
+type outputMetadata struct {
+	//dpi is the resolution written into outputs, 0 writes none
+	dpi int
+	//gifd is the GPS IFD written into JPEG outputs, nil writes none
+	gifd *img.GpsIFD
+	//iccProfile is the color profile embedded into outputs, nil embeds none
+	iccProfile []byte
+}
 
-	var succussfullyConvertedImage bool
-	var conversionError error
+//newOutputMetadata returns the metadata the options carry over from the raw image into its outputs
+func newOutputMetadata(rawImage img.RawImage, opts RtcOptions) outputMetadata {
+	metadata := outputMetadata{dpi: opts.DPI}
+	if metadata.dpi == 0 {
+		if metadata.dpi = rawImage.GetDPI(); metadata.dpi > math.MaxUint16 {
+			metadata.dpi = 0
+		}
+	}
+	if opts.CopyGPS && rawImage.GetGpsIFD().HasFix() {
+		metadata.gifd = rawImage.GetGpsIFD()
+	}
+	if opts.CopyProfile {
+		metadata.iccProfile, _ = rawImage.GetICCProfile()
+	}
+	return metadata
+}
+
+//encodeImage writes the decoded image to the output path in the format of the output type, with the metadata
+//written into it
+func encodeImage(decodedImage image.Image, outputType string, outputPath string, opts RtcOptions, metadata outputMetadata) error {
+	data, err := encodeOutput(decodedImage, outputType, opts, metadata)
+	if err != nil && err != img.ErrJPEGTargetSizeExceeded {
+		return err
+	}
+	if writeErr := writeOutputFile(outputPath, data); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+//encodeOutput encodes the decoded image in the format of the output type, with the metadata written into it,
+//returning ErrJPEGTargetSizeExceeded along with the lowest quality JPEG if it doesn't fit in MaxSize
+func encodeOutput(decodedImage image.Image, outputType string, opts RtcOptions, metadata outputMetadata) ([]byte, error) {
+	dpi, gifd := metadata.dpi, metadata.gifd
+	var encoded bytes.Buffer
+	var err error
 	switch strings.ToLower(outputType) {
 	case ".jpg":
-		conversionError = ti.ConvertToJPEG(outputPath)
+		if opts.MaxSize > 0 {
+			maxSize := int64(opts.MaxSize)
+			if dpi > 0 {
+				//leave room for the JFIF segment the resolution goes in
+				maxSize -= img.JFIFSegmentLength
+			}
+			if gifd != nil {
+				maxSize -= int64(img.GPSSegmentLength(gifd))
+			}
+			if len(metadata.iccProfile) > 0 {
+				maxSize -= int64(img.ICCSegmentsLength(metadata.iccProfile))
+			}
+			var data []byte
+			data, _, err = img.EncodeJPEGTargetSize(decodedImage, maxSize)
+			encoded.Write(data)
+		} else if opts.Progressive {
+			err = img.EncodeProgressiveJPEG(&encoded, decodedImage, jpeg.DefaultQuality)
+		} else {
+			err = jpeg.Encode(&encoded, decodedImage, nil)
+		}
 	case ".png":
-		conversionError = ti.ConvertToPNG(outputPath)
+		err = png.Encode(&encoded, decodedImage)
 	default:
-		if showConversionOutput {
-			logging.Error(fmt.Sprintf("[FAILED] (Output type %s not recognised/supported.)", outputType))
+		return nil, fmt.Errorf("Output type %s not recognised/supported", outputType)
+	}
+	if err != nil && err != img.ErrJPEGTargetSizeExceeded {
+		return nil, err
+	}
+	data := encoded.Bytes()
+	var metadataErr error
+	if dpi > 0 {
+		if data, metadataErr = img.AddDPI(data, dpi); metadataErr != nil {
+			return nil, metadataErr
 		}
-		succussfullyConvertedImage = false
 	}
-	if conversionError != nil {
-		if showConversionOutput {
-			logging.Error(fmt.Sprintf(" [FAILED] (%s)", conversionError.Error()))
+	//added after the resolution, so it goes after the JFIF segment
+	if gifd != nil && strings.ToLower(outputType) == ".jpg" {
+		if data, metadataErr = img.AddGPS(data, gifd); metadataErr != nil {
+			return nil, metadataErr
 		}
-		succussfullyConvertedImage = false
-	} else {
-		if showConversionOutput {
-			logging.Info(" [SUCCESS]")
+	}
+	//added last, so it goes after the JFIF and EXIF segments
+	if len(metadata.iccProfile) > 0 {
+		if data, metadataErr = img.AddICCProfile(data, metadata.iccProfile); metadataErr != nil {
+			return nil, metadataErr
 		}
-		succussfullyConvertedImage = true
 	}
+	return data, err
+}
 
-	if succussfullyConvertedImage {
-		*convertedImageCount++
+//writeOutputFile writes the encoded output to the output path, removing it again if that fails, so a partly
+//written output isn't left behind
+func writeOutputFile(outputPath string, data []byte) error {
+	if err := ioutil.WriteFile(outputPath, data, 0666); err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
+
+//parseLocationPaths splits a comma separated list of locations
+func parseLocationPaths(locationPath string) []string {
+	var locationPaths []string
+	for _, lp := range strings.Split(locationPath, ",") {
+		if lp = strings.TrimSpace(lp); len(lp) > 0 {
+			locationPaths = append(locationPaths, lp)
+		}
+	}
+	return locationPaths
+}
+
+//parseAspectRatio parses a width to height ratio in the form W:H, e.g. 3:2
+func parseAspectRatio(aspect string) (int, int, error) {
+	sides := strings.Split(aspect, ":")
+	if len(sides) != 2 {
+		return 0, 0, fmt.Errorf("Aspect ratio %s format not recognised, make sure it matches <width>:<height>", aspect)
+	}
+	ratioWidth, widthErr := strconv.Atoi(strings.TrimSpace(sides[0]))
+	ratioHeight, heightErr := strconv.Atoi(strings.TrimSpace(sides[1]))
+	if widthErr != nil || heightErr != nil || ratioWidth <= 0 || ratioHeight <= 0 {
+		return 0, 0, fmt.Errorf("Aspect ratio %s not supported, both sides must be whole numbers above 0", aspect)
 	}
+	return ratioWidth, ratioHeight, nil
+}
+
+//parseOutputTypes splits a comma separated list of output types, making sure each one is supported
+func parseOutputTypes(outputType string, supportedOutputTypes []string) ([]string, error) {
+	var outputTypes []string
+	for _, ot := range strings.Split(outputType, ",") {
+		ot = strings.TrimSpace(ot)
+		if len(ot) == 0 {
+			continue
+		}
+		if !utils.SSliceContainsFold(supportedOutputTypes, ot) {
+			return nil, fmt.Errorf("Unable to use %s, %w", ot, ErrUnsupportedOutputType)
+		}
+		if !utils.SSliceContainsFold(outputTypes, ot) {
+			outputTypes = append(outputTypes, ot)
+		}
+	}
+	if len(outputTypes) == 0 {
+		return nil, ErrNoOutputType
+	}
+	return outputTypes, nil
 }
 
 func isDirectory(path string) (bool, error) {
@@ -244,18 +1107,31 @@ func isDirectory(path string) (bool, error) {
 	return fileInfo.IsDir(), err
 }
 
+//createDirectoryIfNotExists creates the directory, along with any parents, unless it already exists, it's an error
+//for the path to exist as a file
 func createDirectoryIfNotExists(dir string) error {
-	if isDir, err := isDirectory(dir); !isDir {
-		if err != nil {
-			err = os.MkdirAll(dir, os.ModePerm)
-			if err != nil {
-				return err
-			}
-		}
+	fileInfo, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(dir, os.ModePerm)
+	}
+	if err != nil {
+		return err
+	}
+	if !fileInfo.IsDir() {
+		return fmt.Errorf("Unable to create directory %s, a file already exists there", dir)
 	}
 	return nil
 }
 
+//Errors returned when parsing the input and output types, they're wrapped with the type which failed so check for
+//them with errors.Is
+var (
+	ErrBadTypeFormat         = errors.New("format not recognised, make sure input type matches <*|filename>.<typeext>")
+	ErrUnsupportedInputType  = errors.New("input type not supported")
+	ErrUnsupportedOutputType = errors.New("output type not supported")
+	ErrNoOutputType          = errors.New("No output type given")
+)
+
 func parseInputOutputTypes(inputType string, outputType string, supportedInputTypes []string, supportOutputTypes []string) (string, string, error) {
 
 	//if the input type is *.nef then don't filter on file name
@@ -264,19 +1140,19 @@ func parseInputOutputTypes(inputType string, outputType string, supportedInputTy
 	res := r.FindStringSubmatch(inputType)
 
 	if len(res) == 0 {
-		return "", "", fmt.Errorf("Input type %s format not recognised, make sure input type matches <*|filename>.<typeext>", inputType)
+		return "", "", fmt.Errorf("Input type %s %w", inputType, ErrBadTypeFormat)
 	}
 
 	inputPrefix := res[1]
 	inputType = "." + res[2]
 
-	if !utils.SSliceContains(supportedInputTypes, inputType) {
-		return "", "", fmt.Errorf("Input type %s not supported", inputType)
+	if !utils.SSliceContainsFold(supportedInputTypes, inputType) {
+		return "", "", fmt.Errorf("Unable to use %s, %w", inputType, ErrUnsupportedInputType)
 	}
 
-	if !utils.SSliceContains(supportOutputTypes, outputType) {
+	if !utils.SSliceContainsFold(supportOutputTypes, outputType) {
 		if len(outputType) > 0 {
-			return "", "", fmt.Errorf("Output type %s not supported", outputType)
+			return "", "", fmt.Errorf("Unable to use %s, %w", outputType, ErrUnsupportedOutputType)
 		} else {
 			return inputPrefix, inputType, nil
 		}
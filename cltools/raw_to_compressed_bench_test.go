@@ -0,0 +1,160 @@
+package cltools
+
+//The benchmarks generate their own directory of tiny TIFFs, each holding nothing but a small JPEG preview, so they
+//measure the searching and the worker goroutines more than decoding, each op is a run over the whole directory,
+//run them with
+//
+//	go test ./cltools -run XXX -bench . -benchmem
+//
+//and compare runs before and after a change with benchstat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/tacusci/clover/img"
+)
+
+//benchmarkImageCount is the number of fixtures in the generated directory
+const benchmarkImageCount = 200
+
+//tinyTIFF lays out a little endian TIFF with a single IFD pointing to a JPEG preview of the given size, which is
+//all the TIFF image type needs to be decoded, padded to the smallest file size which is read
+func tinyTIFF(width int, height int) ([]byte, error) {
+	var preview bytes.Buffer
+	if err := jpeg.Encode(&preview, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		return nil, err
+	}
+	type entry struct {
+		tag      uint16
+		dataType uint16
+		value    uint32
+	}
+	const (
+		shortType  = 3
+		longType   = 4
+		ifdOffset  = 8
+		entryCount = 4
+	)
+	//the header, the entry count, the entries and the next IFD offset, with the preview straight after
+	previewOffset := ifdOffset + 2 + entryCount*12 + 4
+	entries := []entry{
+		{0x0100, shortType, uint32(width)},
+		{0x0101, shortType, uint32(height)},
+		{0x0201, longType, uint32(previewOffset)},
+		{0x0202, longType, uint32(preview.Len())},
+	}
+
+	data := make([]byte, previewOffset, previewOffset+preview.Len())
+	copy(data, []byte{'I', 'I', 42, 0})
+	binary.LittleEndian.PutUint32(data[4:], ifdOffset)
+	binary.LittleEndian.PutUint16(data[ifdOffset:], entryCount)
+	for i, e := range entries {
+		field := data[ifdOffset+2+i*12:]
+		binary.LittleEndian.PutUint16(field, e.tag)
+		binary.LittleEndian.PutUint16(field[2:], e.dataType)
+		binary.LittleEndian.PutUint32(field[4:], 1)
+		if e.dataType == shortType {
+			binary.LittleEndian.PutUint16(field[8:], uint16(e.value))
+		} else {
+			binary.LittleEndian.PutUint32(field[8:], e.value)
+		}
+	}
+	data = append(data, preview.Bytes()...)
+	if len(data) <= 1024 {
+		data = append(data, make([]byte, 1025-len(data))...)
+	}
+	return data, nil
+}
+
+//writeBenchmarkImages fills a temporary directory with count tiny TIFFs, returning its path
+func writeBenchmarkImages(b *testing.B, count int) string {
+	b.Helper()
+	data, err := tinyTIFF(16, 16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	for i := 0; i < count; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("image%04d.tif", i)), data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func BenchmarkFindImagesInDir(b *testing.B) {
+	dir := writeBenchmarkImages(b, benchmarkImageCount)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		imagesChan := make(chan img.TiffImage, 32)
+		found := make(chan int)
+		go func() {
+			count := 0
+			for ti := range imagesChan {
+				ti.GetRawImage().File.Close()
+				count++
+			}
+			found <- count
+		}()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		findImagesInDir(&wg, &imagesChan, dir, "*", ".tif", false)
+		wg.Wait()
+		close(imagesChan)
+		if count := <-found; count != benchmarkImageCount {
+			b.Fatalf("Found %d images, expected %d", count, benchmarkImageCount)
+		}
+	}
+}
+
+func BenchmarkRunRtc(b *testing.B) {
+	dir := writeBenchmarkImages(b, benchmarkImageCount)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("j=%d", workers), func(b *testing.B) {
+			var err error
+			opts := RtcOptions{
+				LocationPath:    dir,
+				OutputDirectory: b.TempDir(),
+				InputType:       "*.tif",
+				OutputType:      ".jpg",
+				OnExist:         OnExistOverwrite,
+				Workers:         workers,
+				IOWorkers:       workers,
+				NoScan:          true,
+			}
+			//the run's progress and totals would bury the results
+			stdout := os.Stdout
+			if os.Stdout, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				os.Stdout.Close()
+				os.Stdout = stdout
+			}()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				results, err := RunRtc(opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(results) != benchmarkImageCount {
+					b.Fatalf("Converted %d images, expected %d", len(results), benchmarkImageCount)
+				}
+				for _, result := range results {
+					if result.Status != ConversionConverted {
+						b.Fatalf("Unable to convert %s -> %v", result.Source, result.Err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package cltools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+//writeTestImages writes the files into a new temporary directory, returning its path
+func writeTestImages(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunRtcMissingOptions(t *testing.T) {
+	for _, opts := range []RtcOptions{
+		{},
+		{LocationPath: t.TempDir(), OutputType: ".jpg"},
+		{LocationPath: t.TempDir(), InputType: "*.tif"},
+	} {
+		if results, err := RunRtc(opts); !errors.Is(err, ErrMissingRtcOptions) || results != nil {
+			t.Errorf("%+v returned %v and %d results, expected ErrMissingRtcOptions", opts, err, len(results))
+		}
+	}
+}
+
+func TestRunRtcResultsMatchFiles(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeTestImages(t, map[string][]byte{
+		"a.tif":       fixture,
+		"b.tif":       fixture,
+		"corrupt.tif": make([]byte, 2048),
+		//not the input type, so not found
+		"notes.txt": []byte("not an image"),
+	})
+	outputDirectory := t.TempDir()
+
+	results, err := RunRtc(RtcOptions{
+		LocationPath:    dir,
+		OutputDirectory: outputDirectory,
+		InputType:       "*.tif",
+		OutputType:      ".jpg,.png",
+		Workers:         2,
+		IOWorkers:       2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]ConversionStatus{}
+	var outputs []string
+	for _, result := range results {
+		statuses[filepath.Base(result.Source)] = result.Status
+		if result.Status == ConversionFailed && result.Err == nil {
+			t.Errorf("%s failed without an error", result.Source)
+		}
+		for _, output := range result.Outputs {
+			outputs = append(outputs, filepath.Base(output))
+		}
+	}
+	expectedStatuses := map[string]ConversionStatus{"a.tif": ConversionConverted, "b.tif": ConversionConverted, "corrupt.tif": ConversionFailed}
+	if len(statuses) != len(expectedStatuses) || len(results) != len(expectedStatuses) {
+		t.Fatalf("Returned results for %v, expected %v", statuses, expectedStatuses)
+	}
+	for name, status := range expectedStatuses {
+		if statuses[name] != status {
+			t.Errorf("%s has status %d, expected %d", name, statuses[name], status)
+		}
+	}
+
+	//the outputs returned are exactly the files written
+	files, err := ioutil.ReadDir(outputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, file := range files {
+		written = append(written, file.Name())
+	}
+	sort.Strings(outputs)
+	expected := []string{"a.jpg", "a.png", "b.jpg", "b.png"}
+	if len(outputs) != len(expected) || len(written) != len(expected) {
+		t.Fatalf("Returned outputs %v and wrote %v, expected %v", outputs, written, expected)
+	}
+	for i := range expected {
+		if outputs[i] != expected[i] || written[i] != expected[i] {
+			t.Errorf("Returned outputs %v and wrote %v, expected %v", outputs, written, expected)
+			break
+		}
+	}
+}
+
+func TestParseInputOutputTypesErrors(t *testing.T) {
+	supportedInputTypes, supportedOutputTypes := []string{".nef", ".tif"}, []string{".jpg", ".png"}
+	for _, test := range []struct {
+		inputType  string
+		outputType string
+		expected   error
+	}{
+		{"nef", ".jpg", ErrBadTypeFormat},
+		{"*.bmp", ".jpg", ErrUnsupportedInputType},
+		{"*.nef", ".gif", ErrUnsupportedOutputType},
+	} {
+		_, _, err := parseInputOutputTypes(test.inputType, test.outputType, supportedInputTypes, supportedOutputTypes)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s -> %s returned %v, expected %v", test.inputType, test.outputType, err, test.expected)
+		}
+	}
+	if _, _, err := parseInputOutputTypes("*.NEF", ".jpg", supportedInputTypes, supportedOutputTypes); err != nil {
+		t.Errorf("*.NEF -> .jpg returned %v", err)
+	}
+
+	if _, err := parseOutputTypes(".jpg,.gif", supportedOutputTypes); !errors.Is(err, ErrUnsupportedOutputType) {
+		t.Errorf(".jpg,.gif returned %v, expected %v", err, ErrUnsupportedOutputType)
+	}
+	if _, err := parseOutputTypes(" , ", supportedOutputTypes); !errors.Is(err, ErrNoOutputType) {
+		t.Errorf("No output types returned %v, expected %v", err, ErrNoOutputType)
+	}
+
+	//the messages are all that's printed, so they have to tell the errors apart
+	if ErrUnsupportedInputType.Error() == ErrUnsupportedOutputType.Error() {
+		t.Errorf("Unsupported input and output types both print %q", ErrUnsupportedInputType)
+	}
+}
+
+func TestRunRtcOnExistSizeReplaceOrKeep(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiny, huge := []byte("existing"), bytes.Repeat([]byte{0xff}, 1<<20)
+	for _, test := range []struct {
+		policy   OnExistPolicy
+		existing []byte
+		replaced bool
+	}{
+		{OnExistSmaller, huge, true},
+		{OnExistSmaller, tiny, false},
+		{OnExistLarger, tiny, true},
+		{OnExistLarger, huge, false},
+	} {
+		t.Run(fmt.Sprintf("%s than %d bytes", test.policy, len(test.existing)), func(t *testing.T) {
+			dir := writeTestImages(t, map[string][]byte{"a.tif": fixture})
+			outputDirectory := writeTestImages(t, map[string][]byte{"a.jpg": test.existing})
+
+			results, err := RunRtc(RtcOptions{
+				LocationPath:    dir,
+				OutputDirectory: outputDirectory,
+				InputType:       "*.tif",
+				OutputType:      ".jpg",
+				OnExist:         test.policy,
+				Workers:         1,
+				IOWorkers:       1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedStatus := ConversionSkipped
+			if test.replaced {
+				expectedStatus = ConversionConverted
+			}
+			if len(results) != 1 || results[0].Status != expectedStatus {
+				t.Fatalf("Returned results %+v, expected status %d", results, expectedStatus)
+			}
+
+			written, err := ioutil.ReadFile(filepath.Join(outputDirectory, "a.jpg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replaced := !bytes.Equal(written, test.existing); replaced != test.replaced {
+				t.Errorf("Existing output replaced %t, expected %t", replaced, test.replaced)
+			}
+			if test.replaced && !bytes.HasPrefix(written, []byte{0xff, 0xd8}) {
+				t.Errorf("Replaced output isn't a JPEG, starts with %x", written[:2])
+			}
+			//nothing but the output is written next to it
+			if files, err := ioutil.ReadDir(outputDirectory); err != nil || len(files) != 1 {
+				t.Errorf("Output directory holds %d files (%v), expected only a.jpg", len(files), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package cltools
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/tacusci/clover/utils"
+)
+
+//outputRtcSummary writes a table of how many images were converted, skipped and failed, in green, yellow and red
+//unless color is turned off, followed by how long it took and how much smaller the outputs are
+func outputRtcSummary(w io.Writer, totals *rtcTotals, elapsed time.Duration) {
+	rows := []struct {
+		label string
+		count uint32
+		color *color.Color
+	}{
+		{"Converted", atomic.LoadUint32(&totals.convertedImages), color.New(color.FgGreen)},
+		{"Skipped", atomic.LoadUint32(&totals.skippedImages), color.New(color.FgYellow)},
+		{"Failed", atomic.LoadUint32(&totals.failedImages), color.New(color.FgRed)},
+	}
+	for _, row := range rows {
+		row.color.Fprintf(w, "%-11s %6d\n", row.label, row.count)
+	}
+	fmt.Fprintf(w, "%-11s %6d ms\n", "Time taken", elapsed.Nanoseconds()/1000000)
+	if inputBytes := atomic.LoadUint64(&totals.inputBytes); inputBytes > 0 {
+		outputBytes := atomic.LoadUint64(&totals.outputBytes)
+		fmt.Fprintf(w, "Processed %s -> %s (%s)\n", utils.FormatBytes(inputBytes), utils.FormatBytes(outputBytes), describeSizeChange(inputBytes, outputBytes))
+	}
+}
+
+//describeSizeChange describes how much smaller or larger the outputs are than the inputs, as a percentage
+func describeSizeChange(inputBytes uint64, outputBytes uint64) string {
+	if outputBytes > inputBytes {
+		return fmt.Sprintf("%.0f%% larger", float64(outputBytes-inputBytes)/float64(inputBytes)*100)
+	}
+	return fmt.Sprintf("%.0f%% smaller", float64(inputBytes-outputBytes)/float64(inputBytes)*100)
+}
+
+//rtcRunSummary summarises a run of the raw to compressed image conversion tool for -summary
+func rtcRunSummary(totals *rtcTotals, results []ConversionResult) RunSummary {
+	summary := RunSummary{
+		Tool: "rtc",
+		Counts: map[string]int{
+			"converted": int(atomic.LoadUint32(&totals.convertedImages)),
+			"skipped":   int(atomic.LoadUint32(&totals.skippedImages)),
+			"failed":    int(atomic.LoadUint32(&totals.failedImages)),
+		},
+		Bytes: map[string]uint64{
+			"input":  atomic.LoadUint64(&totals.inputBytes),
+			"output": atomic.LoadUint64(&totals.outputBytes),
+		},
+	}
+	for _, result := range results {
+		if result.Status == ConversionFailed {
+			summary.Failures = append(summary.Failures, newRunFailure(result.Source, result.Err))
+		}
+	}
+	return summary
+}
@@ -0,0 +1,61 @@
+package cltools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/tacusci/clover/utils"
+)
+
+//summaryStderr is the summary path which writes the summary to stderr instead
+const summaryStderr = "-"
+
+//RunSummary is the machine readable summary of a whole run of a tool, written as JSON with -summary. Counts and
+//Bytes are keyed by what the tool counts, e.g. converted, skipped and failed images for /rtc
+type RunSummary struct {
+	Tool      string            `json:"tool"`
+	Counts    map[string]int    `json:"counts"`
+	Bytes     map[string]uint64 `json:"bytes,omitempty"`
+	ElapsedMs int64             `json:"elapsed_ms"`
+	Failures  []RunFailure      `json:"failures"`
+}
+
+//RunFailure is a file which a tool failed on, and why
+type RunFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+//newRunFailure creates the failure of the file, err can be nil if there's no reason known
+func newRunFailure(path string, err error) RunFailure {
+	failure := RunFailure{Path: path}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+	return failure
+}
+
+//writeRunSummary writes the summary as indented JSON to the summary path, or stderr if it's -
+func writeRunSummary(summaryPath string, summary RunSummary, elapsed time.Duration) error {
+	summary.ElapsedMs = elapsed.Nanoseconds() / 1000000
+	if summary.Failures == nil {
+		//so there's always a list to read, even when nothing failed
+		summary.Failures = []RunFailure{}
+	}
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode run summary as JSON -> %v", err)
+	}
+	summaryJSON = append(summaryJSON, '\n')
+	if summaryPath == summaryStderr {
+		_, err = os.Stderr.Write(summaryJSON)
+		return err
+	}
+	if err := ioutil.WriteFile(utils.TranslatePath(summaryPath), summaryJSON, 0644); err != nil {
+		return fmt.Errorf("Unable to write run summary %s -> %v", summaryPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package cltools
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tacusci/logging"
+
+	"github.com/tacusci/clover/img"
+)
+
+//ServeOptions holds the settings for a run of the conversion server tool
+type ServeOptions struct {
+	//Address is the host and port to listen on, e.g. ":8080"
+	Address string
+	//MaxBodySize is the largest raw image which can be posted, 0 is no limit
+	MaxBodySize uint64
+	//Concurrency is the number of images to convert at once, other requests wait their turn
+	Concurrency int
+}
+
+//RunServe runs the conversion server tool, which converts raw images posted to /convert until it's stopped
+func RunServe(opts ServeOptions) {
+	if len(opts.Address) == 0 {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	fmt.Printf("Clover - Running conversion server tool...\n")
+
+	mux := http.NewServeMux()
+	mux.Handle("/convert", newConvertHandler(opts))
+	logging.Info(fmt.Sprintf("Listening on %s, POST raw images to /convert?from=<typeext>&to=<jpg|png>&q=<1-100>", opts.Address))
+	if err := http.ListenAndServe(opts.Address, mux); err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+}
+
+//convertHandler converts the raw image in the body of each request, the query gives its type in from, the output
+//type in to, jpg by default, and the JPEG quality in q
+type convertHandler struct {
+	maxBodySize uint64
+	//slots holds a value for each conversion running, so no more than its capacity run at once
+	slots chan struct{}
+}
+
+func newConvertHandler(opts ServeOptions) *convertHandler {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	return &convertHandler{maxBodySize: opts.MaxBodySize, slots: make(chan struct{}, opts.Concurrency)}
+}
+
+func (ch *convertHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Raw images have to be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	inputType := "." + strings.TrimPrefix(strings.ToLower(query.Get("from")), ".")
+	outputType := strings.TrimPrefix(strings.ToLower(query.Get("to")), ".")
+	if len(outputType) == 0 {
+		outputType = "jpg"
+	}
+	if outputType != "jpg" && outputType != "jpeg" && outputType != "png" {
+		http.Error(w, fmt.Sprintf("Output type %s not supported", outputType), http.StatusBadRequest)
+		return
+	}
+	quality := jpeg.DefaultQuality
+	if len(query.Get("q")) > 0 {
+		var err error
+		if quality, err = strconv.Atoi(query.Get("q")); err != nil || quality < 1 || quality > 100 {
+			http.Error(w, "Quality must be from 1 to 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	select {
+	case ch.slots <- struct{}{}:
+		defer func() { <-ch.slots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	body := r.Body
+	if ch.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(ch.maxBodySize))
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ti, ok := img.NewImage(inputType, img.RawImage{File: img.NewMemoryFile("upload"+inputType, data)})
+	if !ok {
+		http.Error(w, fmt.Sprintf("Input type %s not supported", inputType), http.StatusBadRequest)
+		return
+	}
+	decodedImage, err := ti.Decode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	//encode before writing anything, so a failure can still be reported with its status
+	var encoded bytes.Buffer
+	contentType, err := encodeToWriter(&encoded, decodedImage, outputType, quality)
+	if err != nil {
+		logging.Error(fmt.Sprintf("Unable to encode converted image -> %v", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(encoded.Len()))
+	w.Write(encoded.Bytes())
+}
+
+//encodeToWriter encodes the image as the output type, returning its content type
+func encodeToWriter(w io.Writer, decodedImage image.Image, outputType string, quality int) (string, error) {
+	if outputType == "png" {
+		return "image/png", png.Encode(w, decodedImage)
+	}
+	return "image/jpeg", jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
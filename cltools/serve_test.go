@@ -0,0 +1,88 @@
+package cltools
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//postConvert posts the body to the convert handler with the query, returning the recorded response
+func postConvert(t *testing.T, opts ServeOptions, method string, query string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, "/convert?"+query, bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	newConvertHandler(opts).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestConvertHandler(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name        string
+		query       string
+		contentType string
+		decode      func([]byte) (image.Image, error)
+	}{
+		{"jpg", "from=tif&to=jpg&q=85", "image/jpeg", func(data []byte) (image.Image, error) {
+			return jpeg.Decode(bytes.NewReader(data))
+		}},
+		{"default", "from=.TIF", "image/jpeg", func(data []byte) (image.Image, error) {
+			return jpeg.Decode(bytes.NewReader(data))
+		}},
+		{"png", "from=tif&to=png", "image/png", func(data []byte) (image.Image, error) {
+			return png.Decode(bytes.NewReader(data))
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			response := postConvert(t, ServeOptions{Concurrency: 1}, http.MethodPost, test.query, fixture)
+			if response.Code != http.StatusOK {
+				t.Fatalf("Responded %d (%s)", response.Code, response.Body.String())
+			}
+			if contentType := response.Header().Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("Content type %s, expected %s", contentType, test.contentType)
+			}
+			decoded, err := test.decode(response.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := decoded.Bounds().Size(); size != image.Pt(16, 16) {
+				t.Errorf("Converted to %v, expected 16x16", size)
+			}
+		})
+	}
+}
+
+func TestConvertHandlerErrors(t *testing.T) {
+	fixture, err := tinyTIFF(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		opts   ServeOptions
+		method string
+		query  string
+		body   []byte
+		status int
+	}{
+		{"get", ServeOptions{}, http.MethodGet, "from=tif", nil, http.StatusMethodNotAllowed},
+		{"output type", ServeOptions{}, http.MethodPost, "from=tif&to=gif", fixture, http.StatusBadRequest},
+		{"quality", ServeOptions{}, http.MethodPost, "from=tif&q=101", fixture, http.StatusBadRequest},
+		{"input type", ServeOptions{}, http.MethodPost, "from=bmp", fixture, http.StatusBadRequest},
+		{"too large", ServeOptions{MaxBodySize: 512}, http.MethodPost, "from=tif", fixture, http.StatusRequestEntityTooLarge},
+		{"undecodable", ServeOptions{}, http.MethodPost, "from=tif", make([]byte, 2048), http.StatusUnprocessableEntity},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if response := postConvert(t, test.opts, test.method, test.query, test.body); response.Code != test.status {
+				t.Errorf("Responded %d (%s), expected %d", response.Code, response.Body.String(), test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package cltools
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/clover/img"
+)
+
+//sinceTimeLayouts are the layouts a -since time can be given in, times without a zone are local
+var sinceTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+//sinceFilter skips images which haven't been modified since a point in time, either given directly or read from a
+//state file, the state file is then updated to when the newest image processed was modified, but never past an
+//image which failed, so failed images are tried again next run
+type sinceFilter struct {
+	since     time.Time
+	statePath string
+	mu        sync.Mutex
+	newest    time.Time
+	//oldestFailed is when the oldest image which failed, or was left alone after a failure, was modified
+	oldestFailed time.Time
+}
+
+//newSinceFilter creates a filter from a time or the path of a state file, a state file which doesn't exist yet
+//lets every image through, an empty since returns a nil filter which also lets every image through
+func newSinceFilter(since string) (*sinceFilter, error) {
+	if len(since) == 0 {
+		return nil, nil
+	}
+	for _, layout := range sinceTimeLayouts {
+		if sinceTime, err := time.ParseInLocation(layout, since, time.Local); err == nil {
+			return &sinceFilter{since: sinceTime}, nil
+		}
+	}
+	sf := &sinceFilter{statePath: since}
+	stateData, err := ioutil.ReadFile(since)
+	if os.IsNotExist(err) {
+		return sf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sf.since, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(string(stateData))); err != nil {
+		return nil, fmt.Errorf("Unable to read time from state file %s -> %v", since, err)
+	}
+	sf.newest = sf.since
+	return sf, nil
+}
+
+//include returns true if the image has been modified since the filter's time
+func (sf *sinceFilter) include(ti img.TiffImage) bool {
+	if sf == nil {
+		return true
+	}
+	fileInfo, err := ti.GetRawImage().File.Stat()
+	if err != nil {
+		return true
+	}
+	return fileInfo.ModTime().After(sf.since)
+}
+
+//track returns the function to call with whether the image was processed, converted or skipped, once it's done
+//with, its modification time is read now as its file is closed by then
+func (sf *sinceFilter) track(ti img.TiffImage) func(processed bool) {
+	if sf == nil {
+		return func(bool) {}
+	}
+	fileInfo, err := ti.GetRawImage().File.Stat()
+	if err != nil {
+		return func(bool) {}
+	}
+	modTime := fileInfo.ModTime()
+	return func(processed bool) {
+		sf.mu.Lock()
+		defer sf.mu.Unlock()
+		if !processed {
+			if sf.oldestFailed.IsZero() || modTime.Before(sf.oldestFailed) {
+				sf.oldestFailed = modTime
+			}
+		} else if modTime.After(sf.newest) {
+			sf.newest = modTime
+		}
+	}
+}
+
+//save writes when the newest image processed was modified to the state file, if there is one, held back to just
+//before the oldest image which failed. It's written to a temporary file first then renamed over the state file,
+//so it's never left half written
+func (sf *sinceFilter) save() error {
+	if sf == nil || len(sf.statePath) == 0 || sf.newest.IsZero() {
+		return nil
+	}
+	newest := sf.newest
+	if !sf.oldestFailed.IsZero() && !newest.Before(sf.oldestFailed) {
+		newest = sf.oldestFailed.Add(-time.Nanosecond)
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(sf.statePath), filepath.Base(sf.statePath)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.WriteString(newest.Format(time.RFC3339Nano) + "\n")
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), sf.statePath)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
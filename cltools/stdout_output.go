@@ -0,0 +1,127 @@
+package cltools
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tacusci/clover/img"
+)
+
+//locationStdin is the location which reads a single raw image from stdin, its type given by the input type
+const locationStdin = "-"
+
+//validateStdoutOptions checks a stdout run converts one raw image to one output type, and nothing else, as there's
+//only one stdout to write to
+func validateStdoutOptions(opts RtcOptions) error {
+	if len(opts.From) > 0 || opts.Watch || opts.List || len(opts.ZipPath) > 0 {
+		return errors.New("Writing to stdout can't be combined with a file list, watching, listing or a zip archive")
+	}
+	if len(opts.OutputDirectory) > 0 || len(opts.Name) > 0 || opts.RetainFolderStructure {
+		return errors.New("Writing to stdout can't be combined with an output location, name template or retaining folder structure")
+	}
+	if len(opts.locationPaths) != 1 {
+		return errors.New("Writing to stdout needs a single raw image, not several locations")
+	}
+	if opts.locationPaths[0] == locationStdin {
+		//there's no name to tell the image's type from
+		if len(opts.InputType) == 0 {
+			return errors.New("Reading a raw image from stdin needs its input type")
+		}
+	} else {
+		fileInfo, err := os.Stat(opts.locationPaths[0])
+		if err != nil {
+			return err
+		}
+		if !fileInfo.Mode().IsRegular() || isZipArchive(opts.locationPaths[0]) {
+			return fmt.Errorf("Writing to stdout needs a single raw image, %s is a directory or zip archive", opts.locationPaths[0])
+		}
+	}
+	if len(opts.OutputTypes) != 1 {
+		return errors.New("Writing to stdout needs a single output type")
+	}
+	return nil
+}
+
+//convertToStdout converts the single raw image at the location path, or read from stdin, and writes it to stdout, nothing else is
+//printed to stdout, so the output can be redirected or piped into another program
+func convertToStdout(opts RtcOptions) ([]ConversionResult, error) {
+	result := ConversionResult{Source: opts.locationPaths[0], Status: ConversionFailed}
+	if err := writeImageToStdout(opts); err != nil {
+		result.Err = err
+		return []ConversionResult{result}, fmt.Errorf("Unable to convert %s -> %v", result.Source, err)
+	}
+	result.Outputs, result.Status = []string{"-"}, ConversionConverted
+	return []ConversionResult{result}, nil
+}
+
+func writeImageToStdout(opts RtcOptions) error {
+	var ti img.TiffImage
+	if opts.locationPaths[0] == locationStdin {
+		var err error
+		if ti, err = readImage(os.Stdin, opts.InputType); err != nil {
+			return err
+		}
+	} else {
+		file, err := os.Open(opts.locationPaths[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		var ok bool
+		if ti, ok = img.NewImage(filepath.Ext(file.Name()), img.RawImage{File: file}); !ok {
+			return fmt.Errorf("Input type %s not recognised/supported", filepath.Ext(file.Name()))
+		}
+	}
+
+	var decodedImage image.Image
+	var err error
+	if opts.PreviewMax > 0 {
+		decodedImage, err = decodeLargestPreview(ti, opts.PreviewMax)
+	} else {
+		decodedImage, err = ti.Decode()
+	}
+	if err != nil {
+		return err
+	}
+	decodedImage = transformImage(decodedImage, opts)
+	metadata := newOutputMetadata(ti.GetRawImage(), opts)
+
+	//the image writers and the metadata setters all work on files, so the output is written to a temporary file
+	//first, then copied to stdout once it's complete, which also keeps a failed output off stdout
+	outputFile, err := ioutil.TempFile("", "clover-stdout-*"+opts.OutputTypes[0])
+	if err != nil {
+		return err
+	}
+	outputPath := outputFile.Name()
+	outputFile.Close()
+	defer os.Remove(outputPath)
+
+	if err = encodeImage(decodedImage, opts.OutputTypes[0], outputPath, opts, metadata); err != nil && err != img.ErrJPEGTargetSizeExceeded {
+		return err
+	}
+	output, err := os.Open(outputPath)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	_, err = io.Copy(os.Stdout, output)
+	return err
+}
+
+//readImage reads the whole of a raw image of the input type, e.g. .nef or *.nef, into memory, as decoding it needs
+//to seek around it
+func readImage(r io.Reader, inputType string) (img.TiffImage, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("No image data to read")
+	}
+	return img.OpenBytes(filepath.Ext(inputType), data)
+}
@@ -3,119 +3,563 @@ package cltools
 import (
 	"bufio"
 	"crypto/md5"
-	"flag"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/tacusci/clover/utils"
 )
 
-//RunSdc to run the storage device checker tool
-func RunSdc(locationPath string, sizeToWrite int, skipFileIntegrityCheck bool, dontDeleteFiles bool) {
-	if len(locationPath) == 0 {
-		flag.PrintDefaults()
-		os.Exit(1)
+//bytes in 1MB, the size of each written data file
+const sdcChunkSize = 1024 * 1000
+
+//initial wait before retrying a failed write, doubled after each attempt
+const sdcRetryBackoff = 100 * time.Millisecond
+
+//reusable chunk sized buffers for writing and verifying data files, saves allocating one per file
+var sdcChunkBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, sdcChunkSize)
+		return &buffer
+	},
+}
+
+var cloverDataFileRegex = regexp.MustCompile(`^cloverdata(\d+)\.bin$`)
+
+//ErrMissingSdcOptions is returned by RunSdc when there's no location, or neither a size to write nor -fill
+var ErrMissingSdcOptions = errors.New("A location and a size to write or -fill are needed to check a storage device")
+
+//ErrNotConfirmed is returned by RunSdc when the answer to filling or cleaning a location wasn't yes, including when
+//there was no answer to read
+var ErrNotConfirmed = errors.New("Not confirmed, use -y to go ahead without asking")
+
+//FillPattern is the data pattern written to each data file, different patterns catch different failure modes,
+//solid patterns show stuck bits, counting shows addressing faults
+type FillPattern string
+
+//Supported fill patterns
+const (
+	//PatternMixed is half zeros, half random bytes, with the chunk's MD5 checksum over the first 16 bytes
+	PatternMixed    FillPattern = "mixed"
+	PatternZero     FillPattern = "zero"
+	PatternOne      FillPattern = "one"
+	PatternRandom   FillPattern = "random"
+	PatternCounting FillPattern = "counting"
+	PatternAlt      FillPattern = "alt"
+)
+
+var supportedFillPatterns = []string{string(PatternMixed), string(PatternZero), string(PatternOne), string(PatternRandom), string(PatternCounting), string(PatternAlt)}
+
+//SdcOptions holds the settings for a run of the storage device checker tool
+type SdcOptions struct {
+	//LocationPath is one or more comma separated locations, which are written to and verified at the same time
+	LocationPath           string
+	SizeToWrite            int
+	SkipFileIntegrityCheck bool
+	DontDeleteFiles        bool
+	//Fill ignores SizeToWrite and keeps writing until the device is out of space
+	Fill bool
+	//VerifyOnly skips writing and verifies data files left in the location by a previous run
+	VerifyOnly bool
+	Pattern    FillPattern
+	//CsvPath is where to save per file write/read timings, if set
+	CsvPath string
+	//Histogram prints a histogram of the write speeds alongside the summary
+	Histogram bool
+	//Retries is how many times to retry writing a data file after a transient error
+	Retries int
+	//Clean skips writing and deletes data files left in the location by previous runs
+	Clean bool
+	//Recursive also cleans data files in sub folders of the location
+	Recursive bool
+	//AssumeYes skips the confirmation prompts before filling and cleaning
+	AssumeYes bool
+	//ManifestPath is where to save the SHA-256 checksum of each written data file, if set
+	ManifestPath string
+	//VerifyManifestPath skips writing and checks data files against the checksums in the manifest
+	VerifyManifestPath string
+	//Force writes even if the requested size is larger than the location's free space
+	Force bool
+	//Summary is where to write a JSON summary of writing and verifying, - for stderr, "" doesn't write one
+	Summary string
+	//Workers is the most locations to write to at once when LocationPath lists more than one, 0 is all of them, each
+	//location's data files are still written one at a time
+	Workers int
+}
+
+//RunSdc to run the storage device checker tool, returning ErrNotConfirmed if filling or cleaning wasn't confirmed
+func RunSdc(opts SdcOptions) error {
+	return runSdc(opts, os.Stdin, os.Stdout)
+}
+
+//runSdc runs the storage device checker tool, reading the answers to confirmation prompts from in and writing the
+//prompts to out
+func runSdc(opts SdcOptions, in io.Reader, out io.Writer) error {
+	//the manifest holds the full path of each data file so no location is needed
+	if len(opts.VerifyManifestPath) > 0 {
+		verifyManifest(utils.TranslatePath(opts.VerifyManifestPath))
+		return nil
+	}
+
+	if len(opts.LocationPath) == 0 {
+		return ErrMissingSdcOptions
+	}
+
+	if len(opts.Pattern) == 0 {
+		opts.Pattern = PatternMixed
+	}
+	if !utils.SSliceContains(supportedFillPatterns, string(opts.Pattern)) {
+		return fmt.Errorf("Pattern %v not supported, supported patterns are %v", opts.Pattern, strings.Join(supportedFillPatterns, ", "))
+	}
+
+	locations := parseLocationPaths(opts.LocationPath)
+	//shared by every question, so answers piped in for later ones aren't lost in an earlier one's buffer
+	answers := bufio.NewReader(in)
+
+	if opts.Clean {
+		for _, location := range locations {
+			if _, _, err := cleanLocation(location, opts.Recursive, opts.AssumeYes, answers, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if opts.VerifyOnly {
+		for _, location := range locations {
+			verifyExisting(location, opts.Pattern)
+		}
+		return nil
+	}
+
+	if opts.SizeToWrite == 0 && !opts.Fill {
+		return ErrMissingSdcOptions
+	}
+
+	if len(locations) > 1 && (len(opts.CsvPath) > 0 || len(opts.ManifestPath) > 0) {
+		return errors.New("Timings CSVs and manifests can only be saved when writing to a single location")
+	}
+
+	if !opts.Fill && !opts.Force {
+		for _, location := range locations {
+			freeSpace, err := utils.FreeSpace(location)
+			if err != nil {
+				color.New(color.FgYellow).Printf("Unable to check free space of %v -> %v\n", location, err)
+			} else if err := checkFreeSpace(opts.SizeToWrite, freeSpace); err != nil {
+				return fmt.Errorf("%v: %v, use -force to write anyway or -fill to write until full", location, err)
+			}
+		}
+	}
+
+	//a sized write has been checked against the free space, filling is what can take the whole device
+	if opts.Fill && !opts.AssumeYes && !confirm(writeConfirmationQuestion(opts, locations), answers, out) {
+		return ErrNotConfirmed
+	}
+
+	if opts.Workers < 1 || opts.Workers > len(locations) {
+		opts.Workers = len(locations)
+	}
+	//each location is checked by a goroutine of its own, with at most Workers writing at once
+	results := make([]sdcLocationResult, len(locations))
+	workerSlots := make(chan struct{}, opts.Workers)
+	var wg sync.WaitGroup
+	for i, location := range locations {
+		wg.Add(1)
+		go func(i int, location string) {
+			defer wg.Done()
+			workerSlots <- struct{}{}
+			defer func() { <-workerSlots }()
+			results[i] = checkLocation(location, opts)
+			if len(locations) > 1 {
+				color.New(color.FgYellow).Printf("Finished checking %v\n", location)
+			}
+		}(i, location)
+	}
+	wg.Wait()
+
+	summary := RunSummary{Tool: "sdc", Counts: map[string]int{}, Bytes: map[string]uint64{}}
+	var timeElapsed time.Duration
+	for _, result := range results {
+		outputSummary(opts.SizeToWrite, result.totalWrittenBytes, result.location, result.passed, opts.SkipFileIntegrityCheck, opts.Fill, result.timeElapsed)
+		outputThroughputStats(result.timings, opts.Histogram)
+		summary.Counts["files"] += result.fileCount - 1
+		summary.Counts["failed"] += len(result.failures)
+		summary.Bytes["requested"] += uint64(opts.SizeToWrite)
+		summary.Bytes["written"] += uint64(result.totalWrittenBytes)
+		summary.Failures = append(summary.Failures, result.failures...)
+		if result.timeElapsed > timeElapsed {
+			timeElapsed = result.timeElapsed
+		}
+	}
+	if len(results) > 1 {
+		outputLocationsSummary(results, opts.SkipFileIntegrityCheck)
 	}
-	if sizeToWrite == 0 {
-		flag.PrintDefaults()
-		os.Exit(1)
+	if len(opts.Summary) > 0 {
+		if err := writeRunSummary(opts.Summary, summary, timeElapsed); err != nil {
+			color.New(color.FgRed).Printf("%v\n", err)
+		}
 	}
+	return nil
+}
 
-	if sizeToWrite > 0 {
-		fileCount, totalWrittenBytes, timeElapsed := writeDataToLocation(locationPath, sizeToWrite)
+//sdcLocationResult is what writing to and verifying a single location found
+type sdcLocationResult struct {
+	location string
+	//fileCount is one more than the number of data files written, as it's the index the next file would have had
+	fileCount         int
+	totalWrittenBytes int
+	timeElapsed       time.Duration
+	passed            bool
+	timings           []fileTiming
+	failures          []RunFailure
+}
 
-		var passed = false
+//checkLocation writes data files to the location, verifies them unless skipped, saves the timings CSV and manifest
+//if asked for, then deletes the files unless they're to be kept
+func checkLocation(location string, opts SdcOptions) sdcLocationResult {
+	result := sdcLocationResult{location: location}
+	fileCount, totalWrittenBytes, timeElapsed, err := writeDataToLocation(location, opts.SizeToWrite, opts.Fill, opts.Pattern, opts.Retries, &result.timings)
+	result.fileCount, result.totalWrittenBytes, result.timeElapsed = fileCount, totalWrittenBytes, timeElapsed
+	if err != nil {
+		color.New(color.FgRed).Add(color.Bold).Printf("Unable to write more data to %v -> %v\n", location, err)
+		result.failures = append(result.failures, newRunFailure(location, err))
+	}
+
+	if !opts.SkipFileIntegrityCheck {
+		verifyFailures := verify(fileCount, location, opts.Pattern, result.timings)
+		result.passed = len(verifyFailures) == 0
+		for _, verifyFailure := range verifyFailures {
+			result.failures = append(result.failures, newRunFailure(verifyFailure.filename, verifyFailure.failure()))
+		}
+	}
+	if len(opts.CsvPath) > 0 {
+		if err := writeTimingsCsv(utils.TranslatePath(opts.CsvPath), result.timings, !opts.SkipFileIntegrityCheck); err != nil {
+			color.New(color.FgRed).Printf("Unable to write timings CSV -> %v\n", err)
+		}
+	}
+	if len(opts.ManifestPath) > 0 {
+		if err := writeManifest(utils.TranslatePath(opts.ManifestPath), result.timings); err != nil {
+			color.New(color.FgRed).Printf("Unable to write manifest -> %v\n", err)
+		}
+	}
+	tidy(opts.DontDeleteFiles, fileCount, location)
+	return result
+}
 
-		if !skipFileIntegrityCheck {
-			passed = verify(fileCount, locationPath)
+//outputLocationsSummary prints a line for each location after their own summaries, so how every device did can be
+//seen at once
+func outputLocationsSummary(results []sdcLocationResult, skipFileIntegrityCheck bool) {
+	color.New(color.FgYellow).Add(color.Bold).Println("------------- All Locations -------------")
+	for _, result := range results {
+		integrity, integrityColor := "SKIPPED", color.New(color.FgYellow)
+		if !skipFileIntegrityCheck && result.passed {
+			integrity, integrityColor = "PASSED", color.New(color.FgGreen)
+		} else if !skipFileIntegrityCheck {
+			integrity, integrityColor = "FAILED", color.New(color.FgRed)
 		}
-		tidy(dontDeleteFiles, fileCount, locationPath)
-		outputSummary(sizeToWrite, totalWrittenBytes, locationPath, passed, skipFileIntegrityCheck, timeElapsed)
+		integrityColor.Printf("%v -> wrote %v, File Integrity %v\n", result.location, utils.FormatBytes(uint64(result.totalWrittenBytes)), integrity)
 	}
 }
 
-func writeDataToLocation(location string, size int) (int, int, time.Duration) {
-	//bytes in 1MB
-	var byteChunkSize = 1024 * 1000
+//writeDataToLocation writes numbered data files to the location until size bytes are written, or if fill
+//is set until the device runs out of space, running out of space while filling isn't treated as an error
+func writeDataToLocation(location string, size int, fill bool, pattern FillPattern, retries int, timings *[]fileTiming) (int, int, time.Duration, error) {
 	var totalWrittenBytes int
 	var fileCount = 1
 
 	startTime := time.Now()
 
 	yColor := color.New(color.FgYellow)
-	rColor := color.New(color.FgRed).Add(color.Bold)
 
-	yColor.Printf("Running StorageDeviceChecker tool -> Writing %v bytes to %v\n", size, location)
-
-	for {
-		if totalWrittenBytes <= size-byteChunkSize {
-			filename := path.Join(location, "cloverdata"+strconv.Itoa(fileCount)+".bin")
-			filename = utils.TranslatePath(filename)
-			file, err := os.Create(filename)
-			check(err)
-			bufferedWriter := bufio.NewWriter(file)
-			rand.Seed(int64(fileCount))
-			bytesToWrite := make([]byte, 1024*1000)
-			for i := len(bytesToWrite) / 2; i < len(bytesToWrite); i++ {
-				bytesToWrite[i] = byte(rand.Intn(254))
-			}
-			fileMd5 := md5.Sum(bytesToWrite)
-			for i := 0; i < len(fileMd5); i++ {
-				bytesToWrite[i] = fileMd5[i]
+	if fill {
+		yColor.Printf("Running StorageDeviceChecker tool -> Writing data to %v until full\n", location)
+	} else {
+		yColor.Printf("Running StorageDeviceChecker tool -> Writing %v to %v\n", utils.FormatBytes(uint64(size)), location)
+	}
+
+	for fill || totalWrittenBytes <= size-sdcChunkSize {
+		filename := cloverDataFilename(location, fileCount)
+		data := getChunkBuffer()
+		fillFileData(data, fileCount, pattern)
+		writeStartTime := time.Now()
+		bytesWritten, err := retryTransient(retries, sdcRetryBackoff, func() (int, error) {
+			return writeFile(filename, data)
+		})
+		writeDuration := time.Since(writeStartTime)
+		checksum := sha256.Sum256(data)
+		putChunkBuffer(data)
+		if err != nil {
+			//the partially written file can't be verified so don't leave it behind
+			os.Remove(filename)
+			if fill && isNoSpaceError(err) {
+				yColor.Printf("Device full after writing %v\n", utils.FormatBytes(uint64(totalWrittenBytes)))
+				return fileCount, totalWrittenBytes, time.Now().Sub(startTime), nil
 			}
-			bytesWritten, err := bufferedWriter.Write(bytesToWrite)
-			bufferedWriter.Flush()
-			if err != nil {
-				rColor.Println("Unable to write more data")
-				return fileCount, totalWrittenBytes, time.Now().Sub(startTime)
+			return fileCount, totalWrittenBytes, time.Now().Sub(startTime), err
+		}
+		*timings = append(*timings, fileTiming{
+			index:         fileCount,
+			filename:      filename,
+			size:          bytesWritten,
+			checksum:      checksum,
+			writeDuration: writeDuration,
+		})
+		totalWrittenBytes += bytesWritten
+		fileCount++
+	}
+	return fileCount, totalWrittenBytes, time.Now().Sub(startTime), nil
+}
+
+//writeFile creates the file and writes the data to it
+func writeFile(filename string, data []byte) (int, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	bufferedWriter := bufio.NewWriter(file)
+	bytesWritten, err := bufferedWriter.Write(data)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	//some file systems only report running out of space on close
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return bytesWritten, err
+}
+
+//expectedFileData generates a data file's contents for the pattern, random data is seeded from the file index
+func expectedFileData(fileIndex int, chunkSize int, pattern FillPattern) []byte {
+	data := make([]byte, chunkSize)
+	fillFileData(data, fileIndex, pattern)
+	return data
+}
+
+//fillFileData writes the expected pattern data for the file index into data, overwriting whatever
+//a previous use of the buffer left in it
+func fillFileData(data []byte, fileIndex int, pattern FillPattern) {
+	switch pattern {
+	case PatternZero:
+		for i := range data {
+			data[i] = 0
+		}
+	case PatternOne:
+		for i := range data {
+			data[i] = 0xff
+		}
+	case PatternRandom:
+		//seeded sources of their own, so locations being written at the same time get the same data
+		rand.New(rand.NewSource(int64(fileIndex))).Read(data)
+	case PatternCounting:
+		for i := range data {
+			data[i] = byte(i)
+		}
+	case PatternAlt:
+		for i := range data {
+			if i%2 == 0 {
+				data[i] = 0xaa
+			} else {
+				data[i] = 0x55
 			}
-			file.Close()
-			totalWrittenBytes += bytesWritten
-			fileCount++
-		} else {
-			break
+		}
+	default:
+		//clear the zero half as the buffer may have held other data
+		zeroHalf := data[:len(data)/2]
+		for i := range zeroHalf {
+			zeroHalf[i] = 0
+		}
+		random := rand.New(rand.NewSource(int64(fileIndex)))
+		for i := len(data) / 2; i < len(data); i++ {
+			data[i] = byte(random.Intn(254))
+		}
+		fileMd5 := md5.Sum(data)
+		for i := 0; i < len(fileMd5); i++ {
+			data[i] = fileMd5[i]
 		}
 	}
-	return fileCount, totalWrittenBytes, time.Now().Sub(startTime)
 }
 
-func verify(fileCount int, location string) bool {
+//getChunkBuffer takes a chunk sized buffer from the pool, it should be handed back with putChunkBuffer
+func getChunkBuffer() []byte {
+	return *sdcChunkBufferPool.Get().(*[]byte)
+}
 
-	rColor := color.New(color.FgRed).Add(color.Bold)
+func putChunkBuffer(buffer []byte) {
+	sdcChunkBufferPool.Put(&buffer)
+}
+
+func cloverDataFilename(location string, fileIndex int) string {
+	return utils.TranslatePath(path.Join(location, "cloverdata"+strconv.Itoa(fileIndex)+".bin"))
+}
+
+//checkFreeSpace returns an error if the requested size won't fit in the available space
+func checkFreeSpace(sizeToWrite int, freeSpace uint64) error {
+	if sizeToWrite > 0 && uint64(sizeToWrite) > freeSpace {
+		return fmt.Errorf("requested %v exceeds %v free", utils.FormatBytes(uint64(sizeToWrite)), utils.FormatBytes(freeSpace))
+	}
+	return nil
+}
+
+//isNoSpaceError returns whether the error was caused by the device running out of space
+func isNoSpaceError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+//isTransientError reports whether the error is likely to go away if the operation is tried again
+func isTransientError(err error) bool {
+	//no amount of retrying will fix permissions or make more space
+	if errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOSPC) {
+		return false
+	}
+	if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	var temporaryErr interface{ Temporary() bool }
+	return errors.As(err, &temporaryErr) && temporaryErr.Temporary()
+}
+
+//retryTransient runs the write operation, retrying up to retries more times with a doubling backoff
+//while it fails with a transient error
+func retryTransient(retries int, backoff time.Duration, write func() (int, error)) (int, error) {
+	bytesWritten, err := write()
+	for attempt := 1; err != nil && attempt <= retries && isTransientError(err); attempt++ {
+		color.New(color.FgYellow).Printf("Write failed -> %v, retrying (%d/%d)...\n", err, attempt, retries)
+		time.Sleep(backoff)
+		backoff *= 2
+		bytesWritten, err = write()
+	}
+	return bytesWritten, err
+}
 
+//verify checks each written data file, recording how long each took to read back in its timing, returning the
+//results of the files which didn't pass
+func verify(fileCount int, location string, pattern FillPattern, timings []fileTiming) []verifyResult {
+	var failed []verifyResult
 	for i := 1; i < fileCount; i++ {
-		file, err := os.Open(path.Join(location, "cloverdata"+strconv.Itoa(i)+".bin"))
+		result := verifyFile(cloverDataFilename(location, i), i, sdcChunkSize, pattern)
+		if i <= len(timings) {
+			timings[i-1].readDuration = result.readDuration
+		}
+		if !reportVerifyResult(result) {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+//verifyExisting verifies every data file found in the location against its expected contents, using the index in each file's name
+func verifyExisting(location string, pattern FillPattern) {
+	yColor := color.New(color.FgYellow)
+	yBoldColor := color.New(color.FgYellow).Add(color.Bold)
+	rColor := color.New(color.FgRed)
+	gColor := color.New(color.FgGreen)
+
+	yColor.Printf("Running StorageDeviceChecker tool -> Verifying existing data in %v\n", location)
+
+	files, err := ioutil.ReadDir(location)
+	if err != nil {
+		rColor.Printf("Unable to read %v -> %v\n", location, err)
+		return
+	}
+
+	var passCount, failCount int
+	for _, file := range files {
+		match := cloverDataFileRegex.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		fileIndex, err := strconv.Atoi(match[1])
 		if err != nil {
-			rColor.Println("Unable to open " + file.Name() + " for verification...")
-			break
-		}
-		defer file.Close()
-		checksumBytes := make([]byte, 16)
-		_, err = file.Seek(0, 0)
-		check(err)
-		_, err = file.Read(checksumBytes)
-		check(err)
-		fullFileBytes := make([]byte, 1024*1000)
-		file.Seek(0, 0)
-		file.Read(fullFileBytes)
-		for i := 0; i < 17; i++ {
-			fullFileBytes[i] = 0
-		}
-		checksumFromFileContents := md5.Sum(fullFileBytes)
-		//if checksumFromFileContents[:] != fullFileBytes[:] {
-		if compareHashBytes(checksumFromFileContents[:], fullFileBytes[:]) {
-			rColor.Println("Incorrect checksum for file -> %v", file.Name())
-			return false
+			continue
+		}
+		if reportVerifyResult(verifyFile(utils.TranslatePath(path.Join(location, file.Name())), fileIndex, sdcChunkSize, pattern)) {
+			passCount++
+		} else {
+			failCount++
+		}
+	}
+
+	yBoldColor.Println("------------- Summary -------------")
+	yColor.Printf("Verified %v data files in %v\n", passCount+failCount, location)
+	if failCount == 0 {
+		gColor.Printf("File Integrity -> PASSED %v/%v...\n", passCount, passCount+failCount)
+	} else {
+		rColor.Printf("File Integrity -> FAILED %v/%v...\n", failCount, passCount+failCount)
+	}
+}
+
+//verifyResult is the outcome of checking a single data file against its expected contents
+type verifyResult struct {
+	filename string
+	passed   bool
+	//badOffset is the offset of the first byte which didn't match, if the file didn't pass
+	badOffset    int
+	readDuration time.Duration
+	err          error
+}
+
+//verifyFile compares the file's contents to the pattern data expected to have been written for the file index
+func verifyFile(filename string, fileIndex int, chunkSize int, pattern FillPattern) verifyResult {
+	readStartTime := time.Now()
+	fileBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return verifyResult{filename: filename, err: err}
+	}
+	result := verifyResult{filename: filename, readDuration: time.Since(readStartTime)}
+	expectedBytes := expectedFileData(fileIndex, chunkSize, pattern)
+	for i := 0; i < len(expectedBytes); i++ {
+		if i >= len(fileBytes) || fileBytes[i] != expectedBytes[i] {
+			result.badOffset = i
+			return result
 		}
 	}
+	if len(fileBytes) != len(expectedBytes) {
+		result.badOffset = len(expectedBytes)
+		return result
+	}
+	result.passed = true
+	return result
+}
+
+//failure returns why the file didn't pass, or nil if it did
+func (result verifyResult) failure() error {
+	if result.err != nil {
+		return result.err
+	}
+	if !result.passed {
+		return fmt.Errorf("Incorrect data, first bad byte at offset %v", result.badOffset)
+	}
+	return nil
+}
+
+//reportVerifyResult outputs any verification failure, returning whether the file passed
+func reportVerifyResult(result verifyResult) bool {
+	rColor := color.New(color.FgRed).Add(color.Bold)
+	if result.err != nil {
+		rColor.Printf("Unable to open %v for verification -> %v\n", result.filename, result.err)
+		return false
+	}
+	if !result.passed {
+		rColor.Printf("Incorrect data in file -> %v (first bad byte at offset %v)\n", result.filename, result.badOffset)
+		return false
+	}
 	return true
 }
 
-func outputSummary(sizeToWrite int, totalWrittenBytes int, location string, verificationPassed bool, skipFileIntegrityCheck bool, timeElapsed time.Duration) {
+func outputSummary(sizeToWrite int, totalWrittenBytes int, location string, verificationPassed bool, skipFileIntegrityCheck bool, fill bool, timeElapsed time.Duration) {
 	yColor := color.New(color.FgYellow)
 	yBoldColor := color.New(color.FgYellow).Add(color.Bold)
 	rColor := color.New(color.FgRed)
@@ -123,9 +567,13 @@ func outputSummary(sizeToWrite int, totalWrittenBytes int, location string, veri
 	yBoldColor.Println("------------- Summary -------------")
 	yColor.Printf("Run for %v seconds...\n", timeElapsed.Seconds())
 
-	writtenPercentage := (sizeToWrite / totalWrittenBytes) * 100
+	if fill {
+		yColor.Printf("Measured free capacity of %v -> %v (%v bytes)\n", location, utils.FormatBytes(uint64(totalWrittenBytes)), totalWrittenBytes)
+	} else {
+		writtenPercentage := totalWrittenBytes * 100 / sizeToWrite
 
-	yColor.Printf("Managed to write %v/%v (%v%%) bytes to %v\n", totalWrittenBytes, sizeToWrite, writtenPercentage, location)
+		yColor.Printf("Managed to write %v/%v (%v%%) to %v\n", utils.FormatBytes(uint64(totalWrittenBytes)), utils.FormatBytes(uint64(sizeToWrite)), writtenPercentage, location)
+	}
 
 	if !skipFileIntegrityCheck {
 		if verificationPassed {
@@ -150,20 +598,106 @@ func tidy(dontDeleteFiles bool, fileCount int, location string) {
 	}
 }
 
-func compareHashBytes(hashBytes1 []byte, hashBytes2 []byte) bool {
-	if len(hashBytes1) != len(hashBytes2) {
-		return false
-	}
-	for i := range hashBytes1 {
-		if hashBytes1[i] != hashBytes2[i] {
-			return false
+//findCloverDataFiles returns the paths of all data files in the location and their total size in bytes
+func findCloverDataFiles(location string, recursive bool) ([]string, int64, error) {
+	var dataFiles []string
+	var totalSize int64
+
+	err := filepath.Walk(location, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filePath != location && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if cloverDataFileRegex.MatchString(info.Name()) {
+			dataFiles = append(dataFiles, filePath)
+			totalSize += info.Size()
+		}
+		return nil
+	})
+	return dataFiles, totalSize, err
+}
+
+//confirm writes the question to out and waits for a yes/no answer, anything other than yes is a no, including no
+//answer at all. The same reader has to be passed to every question, as it may have buffered the answers to the ones
+//after
+func confirm(question string, in *bufio.Reader, out io.Writer) bool {
+	color.New(color.FgYellow).Fprintf(out, "%v [y/N]: ", question)
+	answer, _ := in.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+//writeConfirmationQuestion asks whether to go ahead with filling the locations, saying how many data files left by
+//previous runs will be written over
+func writeConfirmationQuestion(opts SdcOptions, locations []string) string {
+	translatedLocations := make([]string, 0, len(locations))
+	var leftoverFiles int
+	for _, location := range locations {
+		location = utils.TranslatePath(location)
+		translatedLocations = append(translatedLocations, location)
+		if dataFiles, _, err := findCloverDataFiles(location, false); err == nil {
+			leftoverFiles += len(dataFiles)
 		}
 	}
-	return true
+	target := strings.Join(translatedLocations, ", ")
+	if len(locations) > 1 {
+		target = "each of " + target
+	}
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("This will write data to %v until it's full", target))
+	if leftoverFiles > 0 {
+		sb.WriteString(fmt.Sprintf(" and overwrite %v data files left by previous runs", leftoverFiles))
+	}
+	if !opts.DontDeleteFiles {
+		sb.WriteString(", deleting what it writes afterwards")
+	}
+	sb.WriteString(". Continue?")
+	return sb.String()
 }
 
-func check(err error) {
+//cleanLocation deletes leftover data files from interrupted or -nd runs without writing anything,
+//returning ErrNotConfirmed if deleting them wasn't confirmed
+func cleanLocation(location string, recursive bool, assumeYes bool, in *bufio.Reader, out io.Writer) (int, int64, error) {
+	yColor := color.New(color.FgYellow)
+	rColor := color.New(color.FgRed)
+
+	location = utils.TranslatePath(location)
+	yColor.Printf("Running StorageDeviceChecker tool -> Cleaning data files from %v\n", location)
+
+	dataFiles, totalSize, err := findCloverDataFiles(location, recursive)
 	if err != nil {
-		panic(err)
+		rColor.Printf("Unable to search %v -> %v\n", location, err)
+		return 0, 0, nil
+	}
+	if len(dataFiles) == 0 {
+		yColor.Println("No data files found...")
+		return 0, 0, nil
 	}
+
+	if !assumeYes && !confirm(fmt.Sprintf("Delete %v data files (%v)?", len(dataFiles), utils.FormatBytes(uint64(totalSize))), in, out) {
+		return 0, 0, ErrNotConfirmed
+	}
+
+	var removedCount int
+	var freedBytes int64
+	for _, dataFile := range dataFiles {
+		info, err := os.Stat(dataFile)
+		if err == nil {
+			err = os.Remove(dataFile)
+		}
+		if err != nil {
+			rColor.Printf("Unable to delete %v -> %v\n", dataFile, err)
+			continue
+		}
+		removedCount++
+		freedBytes += info.Size()
+	}
+
+	yColor.Printf("Removed %v data files, freed %v\n", removedCount, utils.FormatBytes(uint64(freedBytes)))
+	return removedCount, freedBytes, nil
 }
@@ -0,0 +1,102 @@
+package cltools
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	for _, test := range []struct {
+		answer   string
+		expected bool
+	}{
+		{"y\n", true},
+		{"Yes\n", true},
+		{" y \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"maybe\n", false},
+		//stdin closed or not a terminal
+		{"", false},
+	} {
+		var out bytes.Buffer
+		if confirmed := confirm("Continue?", bufio.NewReader(strings.NewReader(test.answer)), &out); confirmed != test.expected {
+			t.Errorf("Answering %q confirmed %t, expected %t", test.answer, confirmed, test.expected)
+		}
+		if out.String() != "Continue? [y/N]: " {
+			t.Errorf("Asked %q", out.String())
+		}
+	}
+}
+
+func TestRunSdcCleanConfirmation(t *testing.T) {
+	for _, test := range []struct {
+		answer   string
+		expected error
+	}{
+		{"n\n", ErrNotConfirmed},
+		{"", ErrNotConfirmed},
+		{"y\n", nil},
+	} {
+		location := t.TempDir()
+		dataFile := filepath.Join(location, "cloverdata1.bin")
+		if err := ioutil.WriteFile(dataFile, make([]byte, 16), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		err := runSdc(SdcOptions{LocationPath: location, Clean: true}, strings.NewReader(test.answer), &out)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Answering %q returned %v, expected %v", test.answer, err, test.expected)
+		}
+		if !strings.Contains(out.String(), "Delete 1 data files") {
+			t.Errorf("Answering %q asked %q", test.answer, out.String())
+		}
+		if _, statErr := os.Stat(dataFile); (statErr == nil) != (test.expected != nil) {
+			t.Errorf("Answering %q left the data file %t", test.answer, statErr == nil)
+		}
+	}
+}
+
+func TestRunSdcFillNotConfirmed(t *testing.T) {
+	location := t.TempDir()
+	var out bytes.Buffer
+	if err := runSdc(SdcOptions{LocationPath: location, Fill: true}, strings.NewReader("n\n"), &out); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("Returned %v, expected %v", err, ErrNotConfirmed)
+	}
+	if !strings.Contains(out.String(), "until it's full") {
+		t.Errorf("Asked %q", out.String())
+	}
+	if files, err := ioutil.ReadDir(location); err != nil || len(files) != 0 {
+		t.Errorf("Wrote %d files (%v), expected none", len(files), err)
+	}
+}
+
+func TestRunSdcSizedWriteNotAsked(t *testing.T) {
+	location := t.TempDir()
+	var out bytes.Buffer
+	//nothing to read, so it would be a no if it were asked
+	err := runSdc(SdcOptions{LocationPath: location, SizeToWrite: sdcChunkSize, Pattern: PatternZero}, strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("Asked %q", out.String())
+	}
+	if files, err := ioutil.ReadDir(location); err != nil || len(files) != 0 {
+		t.Errorf("Left %d files (%v), expected the written ones to be deleted", len(files), err)
+	}
+}
+
+func TestRunSdcMissingOptions(t *testing.T) {
+	for _, opts := range []SdcOptions{{}, {LocationPath: t.TempDir()}} {
+		if err := runSdc(opts, strings.NewReader(""), ioutil.Discard); !errors.Is(err, ErrMissingSdcOptions) {
+			t.Errorf("%+v returned %v, expected %v", opts, err, ErrMissingSdcOptions)
+		}
+	}
+}
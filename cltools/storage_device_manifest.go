@@ -0,0 +1,141 @@
+package cltools
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+//manifestEntry is a single data file's path and the checksum it had when it was written
+type manifestEntry struct {
+	filename string
+	checksum string
+}
+
+//manifestResult is the outcome of checking a single manifest entry
+type manifestResult struct {
+	filename string
+	missing  bool
+	drifted  bool
+	err      error
+}
+
+//writeManifest saves the checksum of each written data file, one per line in the same
+//format as sha256sum so the manifest can also be checked with 'sha256sum -c'
+func writeManifest(manifestPath string, timings []fileTiming) error {
+	manifestFile, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	bufferedWriter := bufio.NewWriter(manifestFile)
+	for _, timing := range timings {
+		if _, err = fmt.Fprintf(bufferedWriter, "%s  %s\n", hex.EncodeToString(timing.checksum[:]), timing.filename); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if closeErr := manifestFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//readManifest loads the entries from a manifest written by writeManifest
+func readManifest(manifestPath string) ([]manifestEntry, error) {
+	manifestFile, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer manifestFile.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(manifestFile)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("malformed manifest line %d", lineNum)
+		}
+		entries = append(entries, manifestEntry{checksum: strings.ToLower(fields[0]), filename: fields[1]})
+	}
+	return entries, scanner.Err()
+}
+
+//checkManifestEntry recomputes the checksum of the entry's file and compares it to the recorded one
+func checkManifestEntry(entry manifestEntry) manifestResult {
+	result := manifestResult{filename: entry.filename}
+
+	dataFile, err := os.Open(entry.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			result.missing = true
+		} else {
+			result.err = err
+		}
+		return result
+	}
+	defer dataFile.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, dataFile); err != nil {
+		result.err = err
+		return result
+	}
+	result.drifted = hex.EncodeToString(hasher.Sum(nil)) != entry.checksum
+	return result
+}
+
+//verifyManifest checks every data file listed in the manifest, returning the number of files
+//which passed and failed
+func verifyManifest(manifestPath string) (int, int) {
+	yColor := color.New(color.FgYellow)
+	yBoldColor := color.New(color.FgYellow).Add(color.Bold)
+	rColor := color.New(color.FgRed)
+	gColor := color.New(color.FgGreen)
+
+	yColor.Printf("Running StorageDeviceChecker tool -> Verifying data files against manifest %v\n", manifestPath)
+
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		rColor.Printf("Unable to read manifest %v -> %v\n", manifestPath, err)
+		return 0, 0
+	}
+
+	var passCount, failCount int
+	for _, entry := range entries {
+		result := checkManifestEntry(entry)
+		switch {
+		case result.err != nil:
+			rColor.Printf("Unable to read file -> %v (%v)\n", result.filename, result.err)
+		case result.missing:
+			rColor.Printf("Missing file -> %v\n", result.filename)
+		case result.drifted:
+			rColor.Printf("Checksum changed for file -> %v\n", result.filename)
+		default:
+			passCount++
+			continue
+		}
+		failCount++
+	}
+
+	yBoldColor.Println("------------- Summary -------------")
+	yColor.Printf("Verified %v data files from %v\n", len(entries), manifestPath)
+	if failCount == 0 {
+		gColor.Printf("File Integrity -> PASSED %v/%v...\n", passCount, len(entries))
+	} else {
+		rColor.Printf("File Integrity -> FAILED %v/%v...\n", failCount, len(entries))
+	}
+	return passCount, failCount
+}
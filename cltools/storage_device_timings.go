@@ -0,0 +1,177 @@
+package cltools
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/tacusci/clover/utils"
+)
+
+const histogramBuckets = 10
+const histogramWidth = 40
+
+//fileTiming holds the details of a single written data file, with how long it took to write,
+//and to read back if it was verified
+type fileTiming struct {
+	index         int
+	filename      string
+	size          int
+	checksum      [sha256.Size]byte
+	writeDuration time.Duration
+	readDuration  time.Duration
+}
+
+//megabytesPerSecond returns the throughput of moving size bytes in the duration
+func megabytesPerSecond(size int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(size) / 1000 / 1000 / duration.Seconds()
+}
+
+//writeTimingsCsv saves a row per data file, the rows are funnelled through a single writer goroutine
+func writeTimingsCsv(csvPath string, timings []fileTiming, verified bool) error {
+	csvFile, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+
+	recordsChan := make(chan []string, 32)
+	writeErrChan := make(chan error, 1)
+
+	go func() {
+		csvWriter := csv.NewWriter(csvFile)
+		for record := range recordsChan {
+			csvWriter.Write(record)
+		}
+		csvWriter.Flush()
+		writeErrChan <- csvWriter.Error()
+	}()
+
+	header := []string{"index", "bytes", "write_ms", "write_mb_s"}
+	if verified {
+		header = append(header, "read_ms", "read_mb_s")
+	}
+	recordsChan <- header
+
+	for _, timing := range timings {
+		record := []string{
+			strconv.Itoa(timing.index),
+			strconv.Itoa(timing.size),
+			formatMilliseconds(timing.writeDuration),
+			strconv.FormatFloat(megabytesPerSecond(timing.size, timing.writeDuration), 'f', 2, 64),
+		}
+		if verified {
+			record = append(record, formatMilliseconds(timing.readDuration), strconv.FormatFloat(megabytesPerSecond(timing.size, timing.readDuration), 'f', 2, 64))
+		}
+		recordsChan <- record
+	}
+	close(recordsChan)
+
+	return <-writeErrChan
+}
+
+func formatMilliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration.Nanoseconds())/1000000, 'f', 3, 64)
+}
+
+//throughputStats summarises the spread of a set of throughput samples
+type throughputStats struct {
+	count  int
+	min    float64
+	max    float64
+	mean   float64
+	stddev float64
+}
+
+//computeThroughputStats works out the min, max, mean and population standard deviation of the samples
+func computeThroughputStats(samples []float64) throughputStats {
+	stats := throughputStats{count: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	stats.min = samples[0]
+	stats.max = samples[0]
+	var sum float64
+	for _, sample := range samples {
+		if sample < stats.min {
+			stats.min = sample
+		}
+		if sample > stats.max {
+			stats.max = sample
+		}
+		sum += sample
+	}
+	stats.mean = sum / float64(len(samples))
+
+	var squaredDiffSum float64
+	for _, sample := range samples {
+		squaredDiffSum += (sample - stats.mean) * (sample - stats.mean)
+	}
+	stats.stddev = math.Sqrt(squaredDiffSum / float64(len(samples)))
+	return stats
+}
+
+//computeHistogram counts how many samples fall into each of the equal width buckets between min and max
+func computeHistogram(samples []float64, stats throughputStats, buckets int) []int {
+	counts := make([]int, buckets)
+	bucketWidth := (stats.max - stats.min) / float64(buckets)
+	for _, sample := range samples {
+		bucket := 0
+		if bucketWidth > 0 {
+			bucket = int((sample - stats.min) / bucketWidth)
+		}
+		//the max value lands just past the last bucket
+		if bucket >= buckets {
+			bucket = buckets - 1
+		}
+		counts[bucket]++
+	}
+	return counts
+}
+
+func writeThroughputSamples(timings []fileTiming) []float64 {
+	samples := make([]float64, 0, len(timings))
+	for _, timing := range timings {
+		samples = append(samples, megabytesPerSecond(timing.size, timing.writeDuration))
+	}
+	return samples
+}
+
+func outputThroughputStats(timings []fileTiming, histogram bool) {
+	samples := writeThroughputSamples(timings)
+	if len(samples) == 0 {
+		return
+	}
+	stats := computeThroughputStats(samples)
+
+	yColor := color.New(color.FgYellow)
+	yColor.Printf("Write speed -> min: %v, max: %v, mean: %v, stddev: %v\n",
+		utils.FormatRate(stats.min*1000*1000), utils.FormatRate(stats.max*1000*1000), utils.FormatRate(stats.mean*1000*1000), utils.FormatRate(stats.stddev*1000*1000))
+
+	if !histogram {
+		return
+	}
+
+	counts := computeHistogram(samples, stats, histogramBuckets)
+	largestCount := 0
+	for _, count := range counts {
+		if count > largestCount {
+			largestCount = count
+		}
+	}
+	bucketWidth := (stats.max - stats.min) / histogramBuckets
+	for i, count := range counts {
+		barLength := count * histogramWidth / largestCount
+		lowerBound := stats.min + float64(i)*bucketWidth
+		yColor.Printf("%10.2f - %10.2f | %-*s %d\n", lowerBound, lowerBound+bucketWidth, histogramWidth, strings.Repeat("#", barLength), count)
+	}
+}
@@ -2,6 +2,7 @@ package cltools
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -15,54 +16,181 @@ import (
 	"github.com/tacusci/logging"
 )
 
-func RunTee(ts bool, sdir string, odir string, itype string, showExportOutput bool, overwrite bool, recursive bool) {
-	if len(sdir) == 0 || len(odir) == 0 || len(itype) == 0 {
+//teeFieldKeys are the keys of the fields which can be picked for export with -fields, in output order
+var teeFieldKeys = []string{"bits", "compression", "orientation", "model", "make", "lens", "serial", "lensserial", "cfa", "gps"}
+
+//teeEXIFMapFields maps the field names of img's GetEXIFMap to the field keys they're picked by, GPS fields are all
+//picked by gps, and the rest, like ISO, are only exported when every field is
+var teeEXIFMapFields = map[string]string{
+	"BitsPerSample":    "bits",
+	"Compression":      "compression",
+	"Orientation":      "orientation",
+	"Model":            "model",
+	"Make":             "make",
+	"LensModel":        "lens",
+	"SerialNumber":     "serial",
+	"LensSerialNumber": "lensserial",
+}
+
+//formats the EXIF data can be exported as
+const (
+	teeFormatText = "txt"
+	teeFormatXMP  = "xmp"
+	teeFormatJSON = "json"
+)
+
+//teePixelsOrientedKey is the JSON export's key for whether the image's pixels are already the right way up
+const teePixelsOrientedKey = "pixels_oriented"
+
+//TeeOptions holds the settings for a run of the TIFF EXIF export tool
+type TeeOptions struct {
+	TimeStamp        bool
+	LocationPath     string
+	OutputDirectory  string
+	InputType        string
+	ShowExportOutput bool
+	Overwrite        bool
+	Recursive        bool
+	//Fields is a comma separated list of field keys to export, empty exports all of them
+	Fields       string
+	exportFields map[string]bool
+	//pickedFields is exportFields if only some fields were picked, nil if they all were
+	pickedFields map[string]bool
+	//OutputFormat is what to export the EXIF data as, either txt, json or an xmp sidecar
+	OutputFormat string
+	//Names is what JSON exports are keyed by, clover's own field names or exiftool's group:tag names
+	Names string
+	//Since skips images which haven't been modified since a time, or since the time recorded in a state file
+	//which is updated at the end of the run, "" exports every image
+	Since string
+	since *sinceFilter
+	//List prints the path of each image which would be exported, one per line, and exports nothing
+	List bool
+	//FailFast stops exporting once an image fails, the images which haven't been started yet are left alone
+	FailFast bool
+	//Summary is where to write a JSON summary of the run, - for stderr, "" doesn't write one
+	Summary string
+	//HexDump adds every IFD entry as it's stored in the file to text exports, after the picked fields
+	HexDump bool
+	//Hash adds a digest of the whole source file to text and JSON exports, md5 or sha256, "" adds none, the file is
+	//read through again to work it out
+	Hash string
+}
+
+//teeTotals are the running totals of a run of the TIFF EXIF export tool, there's only the one export goroutine
+//so they aren't updated atomically
+type teeTotals struct {
+	exportedImages int
+	//images are skipped if their export already exists or they're older than -since
+	skippedImages int
+	failedImages  int
+	failures      []RunFailure
+}
+
+//RunTee runs the TIFF EXIF export tool, returning the code to exit with
+func RunTee(opts TeeOptions) ExitCode {
+	if len(opts.LocationPath) == 0 || (len(opts.OutputDirectory) == 0 && !opts.List) || len(opts.InputType) == 0 {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
+	if opts.List {
+		//nothing else is printed, so the list can be read by other tools
+		if err := listImages(os.Stdout, []string{opts.LocationPath}, opts.InputType, opts.Recursive); err != nil {
+			logging.Error(err.Error())
+			return ExitBadArguments
+		}
+		return ExitOK
+	}
+
 	fmt.Printf("Clover - Running TIFF EXIF export tool...\n")
 
-	var st time.Time
-	if ts {
-		st = time.Now()
+	st := time.Now()
+
+	opts.OutputFormat = strings.ToLower(strings.TrimPrefix(opts.OutputFormat, "."))
+	if len(opts.OutputFormat) == 0 {
+		opts.OutputFormat = teeFormatText
+	}
+	if opts.OutputFormat != teeFormatText && opts.OutputFormat != teeFormatJSON && opts.OutputFormat != teeFormatXMP {
+		logging.Error(fmt.Sprintf("Output format %s not supported, it must be %s, %s or %s", opts.OutputFormat, teeFormatText, teeFormatJSON, teeFormatXMP))
+		return ExitBadArguments
+	}
+	if opts.HexDump && opts.OutputFormat != teeFormatText {
+		logging.Error(fmt.Sprintf("Hex dumps can only be added to %s exports", teeFormatText))
+		return ExitBadArguments
+	}
+	opts.Hash = strings.ToLower(opts.Hash)
+	if _, ok := teeHashes[opts.Hash]; len(opts.Hash) > 0 && !ok {
+		logging.Error(fmt.Sprintf("Hash %s not supported, it must be %s", opts.Hash, strings.Join(teeHashNames(), " or ")))
+		return ExitBadArguments
+	}
+	if len(opts.Hash) > 0 && opts.OutputFormat == teeFormatXMP {
+		logging.Error(fmt.Sprintf("Hashes can't be added to %s exports", teeFormatXMP))
+		return ExitBadArguments
+	}
+	opts.Names = strings.ToLower(opts.Names)
+	if len(opts.Names) == 0 {
+		opts.Names = teeNamesClover
+	}
+	if opts.Names != teeNamesClover && opts.Names != teeNamesExifTool {
+		logging.Error(fmt.Sprintf("Names %s not supported, they must be %s or %s", opts.Names, teeNamesClover, teeNamesExifTool))
+		return ExitBadArguments
 	}
 
-	err := createDirectoryIfNotExists(odir)
+	exportFields, err := parseTeeFields(opts.Fields)
 	if err != nil {
 		logging.Error(err.Error())
-		return
+		return ExitBadArguments
+	}
+	opts.exportFields = exportFields
+	if len(strings.TrimSpace(opts.Fields)) > 0 {
+		opts.pickedFields = exportFields
 	}
 
-	supportedInputTypes := []string{".nef"}
-	supportedOutputTypes := []string{".jpg", ".png"}
+	if opts.since, err = newSinceFilter(opts.Since); err != nil {
+		logging.Error(err.Error())
+		return ExitBadArguments
+	}
 
-	inputTypePrefixToMatch, itype, err := parseInputOutputTypes(itype, "", supportedInputTypes, supportedOutputTypes)
+	err = createDirectoryIfNotExists(opts.OutputDirectory)
 	if err != nil {
 		logging.Error(err.Error())
-		return
+		return ExitBadArguments
 	}
 
-	doneSearchingChan := make(chan bool, 32)
-	imagesToExportExifChan := make(chan img.TiffImage, 32)
+	supportedInputTypes := img.RegisteredTypes()
+	supportedOutputTypes := []string{".jpg", ".png"}
 
-	if isDir, err := isDirectory(sdir); isDir {
+	inputTypePrefixToMatch, inputType, err := parseInputOutputTypes(opts.InputType, "", supportedInputTypes, supportedOutputTypes)
+	if err != nil {
+		logging.Error(err.Error())
+		return ExitBadArguments
+	}
+	opts.InputType = inputType
+
+	var totals teeTotals
+	if isDir, err := isDirectory(opts.LocationPath); isDir {
+		//closed once the searching is done, which ends the export goroutine after it's exported what's left
+		imagesToExportExifChan := make(chan img.TiffImage, 32)
 		//file searching wait group
 		var fswg sync.WaitGroup
 		//images to export EXIF wait group
 		var ieewg sync.WaitGroup
 		//add a wait for the initial single call of 'findImagesInDir'
 		fswg.Add(1)
-		go findImagesInDir(&fswg, &imagesToExportExifChan, &doneSearchingChan, sdir, inputTypePrefixToMatch, itype, recursive)
+		go findImagesInDir(&fswg, &imagesToExportExifChan, opts.LocationPath, inputTypePrefixToMatch, opts.InputType, opts.Recursive)
 		ieewg.Add(1)
-		go exportRawImageEXIF(&ieewg, &imagesToExportExifChan, &doneSearchingChan, itype, showExportOutput, overwrite, recursive, sdir, odir)
+		go exportRawImageEXIF(&ieewg, &imagesToExportExifChan, opts, &totals)
 		//main thread doesn't wait after firing these goroutines, so force it to
 		//wait until the file searching thread has finished
 		fswg.Wait()
 		//then tell the image exif export goroutine that there's no more images coming to export exif's
-		doneSearchingChan <- true
+		close(imagesToExportExifChan)
 		//wait on the image exif export goroutine until it's finished with all images it's already been working on
 		ieewg.Wait()
+		if err := opts.since.save(); err != nil {
+			logging.Error(fmt.Sprintf("Unable to save state file %s -> %v", opts.Since, err))
+		}
 		//both worker goroutines have finished, main thread continues
 	} else {
 		if err != nil {
@@ -70,22 +198,55 @@ func RunTee(ts bool, sdir string, odir string, itype string, showExportOutput bo
 		}
 	}
 
-	if ts {
+	if opts.TimeStamp {
 		logging.Info(fmt.Sprintf("Time taken: %d ms", time.Since(st).Nanoseconds()/1000000))
 	}
+	if len(opts.Summary) > 0 {
+		summary := RunSummary{
+			Tool:     "tee",
+			Counts:   map[string]int{"exported": totals.exportedImages, "skipped": totals.skippedImages, "failed": totals.failedImages},
+			Failures: totals.failures,
+		}
+		if err := writeRunSummary(opts.Summary, summary, time.Since(st)); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+	return exitCodeForCounts(totals.exportedImages+totals.skippedImages+totals.failedImages, totals.failedImages)
 }
 
-func exportRawImageEXIF(wg *sync.WaitGroup, iteec *chan img.TiffImage, dsc *chan bool, itype string, showExportOutput bool, overwrite bool, recursive bool, sdir string, odir string) {
-	for {
-		if !<-*dsc {
-			ri := <-*iteec
-			wg.Add(1)
-			if ri != nil {
-				exportRawEXIFExport(ri, itype, showExportOutput, overwrite, sdir, odir)
+func exportRawImageEXIF(wg *sync.WaitGroup, iteec *chan img.TiffImage, opts TeeOptions, totals *teeTotals) {
+	defer wg.Done()
+	//set once an image fails with fail fast, the rest are then only closed so the search isn't left blocked
+	stopped := false
+	for ri := range *iteec {
+		if ri == nil {
+			continue
+		}
+		done := opts.since.track(ri)
+		if stopped {
+			//left alone, so it has to be tried again next run
+			done(false)
+			ri.GetRawImage().File.Close()
+			continue
+		}
+		if !opts.since.include(ri) {
+			ri.GetRawImage().File.Close()
+			totals.skippedImages++
+			continue
+		}
+		exported, err := exportRawEXIFExport(ri, opts)
+		done(err == nil)
+		if err != nil {
+			totals.failedImages++
+			totals.failures = append(totals.failures, newRunFailure(ri.GetRawImage().File.Name(), err))
+			if opts.FailFast {
+				logging.Error(fmt.Sprintf("Stopping on first failure, %s failed -> %v", ri.GetRawImage().File.Name(), err))
+				stopped = true
 			}
-			wg.Done()
+		} else if exported {
+			totals.exportedImages++
 		} else {
-			wg.Done()
+			totals.skippedImages++
 		}
 	}
 }
@@ -98,83 +259,198 @@ func bytesSliceTotalSum(bs []byte) uint32 {
 	return total
 }
 
-func exportRawEXIFExport(ti img.TiffImage, itype string, showExportOutput bool, overwrite bool, sdir string, odir string) {
-	if ti == nil {
-		return
+//parseTeeFields validates the comma separated field keys, returning the set of fields to export, an empty list
+//means all of them
+func parseTeeFields(fields string) (map[string]bool, error) {
+	exportFields := map[string]bool{}
+	if len(strings.TrimSpace(fields)) == 0 {
+		for _, key := range teeFieldKeys {
+			exportFields[key] = true
+		}
+		return exportFields, nil
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if len(field) == 0 {
+			continue
+		}
+		if !utils.SSliceContainsFold(teeFieldKeys, field) {
+			return nil, fmt.Errorf("Unknown field %s, valid fields are %s", field, strings.Join(teeFieldKeys, ","))
+		}
+		exportFields[field] = true
 	}
+	return exportFields, nil
+}
 
-	if ti.GetRawImage().File == nil {
-		return
+//exportRawEXIFExport writes the image's EXIF data to the output directory, returning false if it was skipped as
+//its export already exists, or why it couldn't be written
+func exportRawEXIFExport(ti img.TiffImage, opts TeeOptions) (bool, error) {
+	if ti == nil || ti.GetRawImage().File == nil {
+		return false, errors.New("Image has no file to export")
 	}
 
 	defer ti.GetRawImage().File.Close()
 
+	if !hasNameBeforeExtension(ti.GetRawImage().File.Name()) {
+		logging.Error(fmt.Sprintf("Skipping %s, it has no name before its extension to name its export with", ti.GetRawImage().File.Name()))
+		return false, nil
+	}
+
 	sb := strings.Builder{}
-	sb.WriteString(strings.TrimRight(odir, string(os.PathSeparator)))
+	sb.WriteString(strings.TrimRight(opts.OutputDirectory, string(os.PathSeparator)))
 	sb.WriteRune(os.PathSeparator)
 
-	var fileNameToAdd string
-	fileNameToAdd = filepath.Base(ti.GetRawImage().File.Name())
-	fileNameToAdd = strings.Replace(fileNameToAdd, itype, ".txt", 1)
-	fileNameToAdd = strings.Replace(fileNameToAdd, strings.ToUpper(itype), ".txt", 1)
+	fileNameToAdd := utils.ReplaceExtension(filepath.Base(ti.GetRawImage().File.Name()), "."+opts.OutputFormat)
 
 	sb.WriteString(fileNameToAdd)
 
 	outputPath := utils.TranslatePath(sb.String())
 
-	if showExportOutput {
+	if opts.ShowExportOutput {
 		fmt.Printf("Exporting image %s EXIFs", ti.GetRawImage().File.Name())
 	}
 
-	if _, err := os.Stat(outputPath); err == nil && !overwrite {
-		if showExportOutput {
+	if _, err := os.Stat(outputPath); err == nil && !opts.Overwrite {
+		if opts.ShowExportOutput {
 			logging.Error(" [FAILED] (Output result file already exists.)")
 		}
-		return
+		return false, nil
 	}
 
 	err := ti.Load()
 	if err != nil {
 		logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
-		return
+		return false, err
 	}
 
-	sb.Reset()
+	var digest string
+	if th, ok := teeHashes[opts.Hash]; ok {
+		if digest, err = hashImageFile(ti.GetRawImage().File, th); err != nil {
+			logging.Error(fmt.Sprintf(" [FAILED] (Unable to hash file -> %s)", err.Error()))
+			return false, err
+		}
+	}
 
-	for index, ifd := range ti.GetRawImage().Ifds {
+	var export string
+	switch opts.OutputFormat {
+	case teeFormatXMP:
+		export = buildXMPSidecar(ti.GetRawImage(), opts.pickedFields)
+	case teeFormatJSON:
+		extraFields := map[string]interface{}{}
+		if teeFieldPicked(opts.pickedFields, "orientation") {
+			extraFields[teePixelsOrientedKey] = pixelsOriented(ti)
+		}
+		if len(digest) > 0 {
+			extraFields[teeHashes[opts.Hash].jsonKey] = digest
+		}
+		if export, err = buildJSONExport(ti, opts.Names, opts.pickedFields, extraFields); err != nil {
+			logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
+			return false, err
+		}
+	default:
+		if len(digest) > 0 {
+			export = fmt.Sprintf("%s -> %s\n\n", teeHashes[opts.Hash].textLabel, digest)
+		}
+		export += buildEXIFText(ti.GetRawImage(), pixelsOriented(ti), opts)
+		if opts.HexDump {
+			//the file's still open, so the entries' data can be read
+			export += buildHexDump(ti.GetRawImage())
+		}
+	}
+
+	ofile, err := os.Create(outputPath)
+	defer ofile.Close()
+	if err != nil {
+		if opts.ShowExportOutput {
+			logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
+		}
+		return false, err
+	}
+	_, err = ofile.WriteString(export)
+	ofile.Sync()
+	if err != nil {
+		if opts.ShowExportOutput {
+			logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
+		}
+		return false, err
+	}
+	if opts.ShowExportOutput {
+		logging.Info(" [SUCCESS]")
+	}
+	return true, nil
+}
+
+//buildEXIFText lists the picked fields of each IFD as text, orientations are noted with whether the pixels are
+//already the right way up
+func buildEXIFText(ri img.RawImage, oriented bool, opts TeeOptions) string {
+	sb := strings.Builder{}
+	for index, ifd := range ri.Ifds {
 		sb.WriteString(fmt.Sprintf("--------- START IFD%d START ---------\n", index))
 
-		if ifd.BitsPerSample != nil && len(ifd.BitsPerSample) > 0 && bytesSliceTotalSum(ifd.BitsPerSample) > 0 {
+		if opts.exportFields["bits"] && ifd.BitsPerSample != nil && len(ifd.BitsPerSample) > 0 && bytesSliceTotalSum(ifd.BitsPerSample) > 0 {
 			sb.WriteString(fmt.Sprintf("Bits per sample -> %b\n", ifd.BitsPerSample))
 		}
 
-		if ifd.ImageModelTag != nil && len(ifd.ImageModelTag) > 0 {
+		if opts.exportFields["compression"] && ifd.CompressionFlag > 0 {
+			sb.WriteString(fmt.Sprintf("Compression -> %s\n", img.CompressionName(ifd.CompressionFlag)))
+		}
+
+		if opts.exportFields["orientation"] && ifd.OrientationFlag > 0 {
+			if oriented {
+				sb.WriteString(fmt.Sprintf("Orientation -> %d (pixels are already the right way up, don't rotate them)\n", ifd.OrientationFlag))
+			} else {
+				sb.WriteString(fmt.Sprintf("Orientation -> %d (pixels aren't rotated, rotate them by it)\n", ifd.OrientationFlag))
+			}
+		}
+
+		if opts.exportFields["model"] && ifd.ImageModelTag != nil && len(ifd.ImageModelTag) > 0 {
 			sb.WriteString(tidiedStringForOutput("Camera model", ifd.ImageModelTag))
 		}
 
-		if ifd.ImageMakeTag != nil && len(ifd.ImageMakeTag) > 0 {
+		if opts.exportFields["make"] && ifd.ImageMakeTag != nil && len(ifd.ImageMakeTag) > 0 {
 			sb.WriteString(tidiedStringForOutput("Camera make", ifd.ImageMakeTag))
 		}
 
-		if ifd.CFAPattern2 > 0 {
+		if opts.exportFields["lens"] && ifd.ExifIFD != nil && len(ifd.ExifIFD.LensModelTag) > 0 {
+			sb.WriteString(tidiedStringForOutput("Lens model", ifd.ExifIFD.LensModelTag))
+		}
+
+		if index == 0 {
+			if bodySerial := ri.GetBodySerial(); opts.exportFields["serial"] && len(bodySerial) > 0 {
+				sb.WriteString(fmt.Sprintf("Body serial number -> %s\n", bodySerial))
+			}
+			if lensSerial := ri.GetLensSerial(); opts.exportFields["lensserial"] && len(lensSerial) > 0 {
+				sb.WriteString(fmt.Sprintf("Lens serial number -> %s\n", lensSerial))
+			}
+		}
+
+		if opts.exportFields["cfa"] && ifd.CFAPattern2 > 0 {
 			sb.WriteString(fmt.Sprintf("CFA Pattern 2 %d", ifd.CFAPattern2))
 		}
 
 		sb.WriteString(fmt.Sprintf("--------- END IFD%d END  ---------\n\n", index))
 
-		if ifd.GpsIFD != nil {
+		if opts.exportFields["gps"] && ifd.GpsIFD != nil {
 
 			gpsTimeStamp := ifd.GpsIFD.GPSTimeStamp
-			timeStampValTotal := gpsTimeStamp[0] + gpsTimeStamp[1] + gpsTimeStamp[2]
+			timeStampValTotal := gpsTimeStamp[0].Numerator + gpsTimeStamp[1].Numerator + gpsTimeStamp[2].Numerator
 
-			if timeStampValTotal > 0 {
+			if timeStampValTotal > 0 || ifd.GpsIFD.HasFix() {
 				sb.WriteString("--------- START GPS IFD ---------\n")
 
 				if ifd.GpsIFD.GPSVersionID != nil && bytesSliceTotalSum(ifd.GpsIFD.GPSVersionID) > 0 {
 					sb.WriteString(fmt.Sprintf("GPS Version -> %d\n", ifd.GpsIFD.GPSVersionID))
 				}
 
-				sb.WriteString(fmt.Sprintf("GPS Time -> %d\n", ifd.GpsIFD.GPSTimeStamp))
+				if ifd.GpsIFD.HasFix() {
+					sb.WriteString(fmt.Sprintf("GPS Latitude -> %f\n", ifd.GpsIFD.Latitude()))
+					sb.WriteString(fmt.Sprintf("GPS Longitude -> %f\n", ifd.GpsIFD.Longitude()))
+					sb.WriteString(fmt.Sprintf("GPS Altitude -> %.1f m\n", ifd.GpsIFD.Altitude()))
+				}
+
+				if timeStampValTotal > 0 {
+					sb.WriteString(fmt.Sprintf("GPS Time -> %s\n", ifd.GpsIFD.TimeText()))
+				}
 
 				if len(ifd.GpsIFD.GPSSatellites) > 0 {
 					sb.WriteString(tidiedStringForOutput("GPS Satellites", []byte(ifd.GpsIFD.GPSSatellites)))
@@ -185,26 +461,33 @@ func exportRawEXIFExport(ti img.TiffImage, itype string, showExportOutput bool,
 
 		}
 	}
+	return sb.String()
+}
 
-	ofile, err := os.Create(outputPath)
-	defer ofile.Close()
-	if err != nil {
-		if showExportOutput {
-			logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
-		}
-		return
+//teeFieldPicked returns whether the field key is one of the picked fields, every field is picked if picked is nil,
+//and fields without a key, "", only are then
+func teeFieldPicked(picked map[string]bool, key string) bool {
+	return picked == nil || (len(key) > 0 && picked[key])
+}
+
+//teeEXIFMapFieldKey returns the field key the EXIF map field is picked by, "" if it has none
+func teeEXIFMapFieldKey(name string) string {
+	if strings.HasPrefix(name, "GPS") {
+		return "gps"
 	}
-	_, err = ofile.WriteString(sb.String())
-	ofile.Sync()
-	if err != nil {
-		if showExportOutput {
-			logging.Error(fmt.Sprintf(" [FAILED] (%s)", err.Error()))
-		}
-	} else {
-		if showExportOutput {
-			logging.Info(" [SUCCESS]")
-		}
+	return teeEXIFMapFields[name]
+}
+
+//pixelsOriented returns whether the image's pixels are already stored the right way up, so readers shouldn't
+//rotate them again by its orientation tag. Raw data is never rotated, so a raw's tag always has to be honored,
+//processed JPEGs and TIFFs only need rotating when their tag is set to something other than 1, top left
+func pixelsOriented(ti img.TiffImage) bool {
+	switch ti.(type) {
+	case *img.JpegImage, *img.TiffFileImage:
+		orientation, _ := ti.GetEXIFMap()["Orientation"].(int)
+		return orientation <= 1
 	}
+	return false
 }
 
 func tidiedStringForOutput(dt string, b []byte) string {
@@ -0,0 +1,58 @@
+package cltools
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/tacusci/logging"
+
+	"github.com/tacusci/clover/img"
+)
+
+//writeOutput encodes the decoded image to the output path, then if verifying outputs decodes it again to check
+//it was written whole, writing it again up to VerifyRetries times if it wasn't. The error is encodeImage's, or
+//why the last write didn't decode
+func writeOutput(decodedImage image.Image, outputType string, outputPath string, opts RtcOptions, metadata outputMetadata) error {
+	for attempt := 0; ; attempt++ {
+		err := encodeImage(decodedImage, outputType, outputPath, opts, metadata)
+		if !opts.VerifyOutput || (err != nil && err != img.ErrJPEGTargetSizeExceeded) {
+			return err
+		}
+		verifyErr := verifyOutput(outputPath, outputType, decodedImage.Bounds())
+		if verifyErr == nil {
+			return err
+		}
+		if attempt >= opts.VerifyRetries {
+			return verifyErr
+		}
+		logging.Error(fmt.Sprintf("%s, writing it again", verifyErr.Error()))
+	}
+}
+
+//verifyOutput decodes the output written to the output path, returning an error if it doesn't decode or isn't the
+//same size as the image that was encoded
+func verifyOutput(outputPath string, outputType string, bounds image.Rectangle) error {
+	outputFile, err := os.Open(outputPath)
+	if err != nil {
+		return fmt.Errorf("Unable to verify output %s -> %v", outputPath, err)
+	}
+	defer outputFile.Close()
+
+	var decodedOutput image.Image
+	if strings.ToLower(outputType) == ".png" {
+		decodedOutput, err = png.Decode(outputFile)
+	} else {
+		decodedOutput, err = jpeg.Decode(outputFile)
+	}
+	if err != nil {
+		return fmt.Errorf("Output %s doesn't decode -> %v", outputPath, err)
+	}
+	if decodedOutput.Bounds().Dx() != bounds.Dx() || decodedOutput.Bounds().Dy() != bounds.Dy() {
+		return fmt.Errorf("Output %s decodes as %dx%d, it should be %dx%d", outputPath, decodedOutput.Bounds().Dx(), decodedOutput.Bounds().Dy(), bounds.Dx(), bounds.Dy())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package cltools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tacusci/logging"
+
+	"github.com/tacusci/clover/img"
+)
+
+//watchStablePeriod is how often new files are checked on, a file is only converted once its size hasn't changed
+//between two checks, so it isn't read while the camera is still writing it
+const watchStablePeriod = time.Second
+
+//watchForImages is findImagesInDir for watch mode, rather than the images already in the location it finds each
+//new image as it's written there, until stop is closed
+func watchForImages(wg *sync.WaitGroup, itcc *chan img.TiffImage, locationPath string, inputTypePrefixToMatch string, inputType string, recursive bool, stop <-chan struct{}) {
+	defer wg.Done()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+	defer watcher.Close()
+	if _, err := watchDirectory(watcher, locationPath, recursive); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//sizes of the new files as of the last check, -1 if they've changed since
+	pendingSizes := map[string]int64{}
+	ticker := time.NewTicker(watchStablePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+			if isDir, _ := isDirectory(event.Name); isDir {
+				if recursive && event.Op&fsnotify.Create != 0 {
+					//files can be written to a new folder before it's being watched, so pick them up too
+					filePaths, err := watchDirectory(watcher, event.Name, recursive)
+					if err != nil {
+						logging.Error(err.Error())
+					}
+					for _, filePath := range filePaths {
+						if matchesInputType(filepath.Base(filePath), inputTypePrefixToMatch, inputType) {
+							pendingSizes[filePath] = -1
+						}
+					}
+				}
+				continue
+			}
+			if matchesInputType(filepath.Base(event.Name), inputTypePrefixToMatch, inputType) {
+				pendingSizes[event.Name] = -1
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logging.Error(err.Error())
+		case <-ticker.C:
+			for filePath, lastSize := range pendingSizes {
+				fileInfo, err := os.Stat(filePath)
+				if err != nil {
+					//removed or renamed before it was finished
+					delete(pendingSizes, filePath)
+					continue
+				}
+				if fileInfo.Size() != lastSize || fileInfo.Size() == 0 {
+					pendingSizes[filePath] = fileInfo.Size()
+					continue
+				}
+				delete(pendingSizes, filePath)
+				image, err := os.Open(filePath)
+				if err != nil {
+					logging.Error(err.Error())
+					continue
+				}
+				ti, ok := img.NewImage(inputType, img.RawImage{File: image})
+				if !ok {
+					image.Close()
+					continue
+				}
+				*itcc <- ti
+			}
+		}
+	}
+}
+
+//watchDirectory adds the directory to the watcher, along with all of its sub directories if recursive, returning
+//the files already in them
+func watchDirectory(watcher *fsnotify.Watcher, directory string, recursive bool) ([]string, error) {
+	var filePaths []string
+	err := filepath.Walk(directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			filePaths = append(filePaths, filePath)
+			return nil
+		}
+		if filePath != directory && !recursive {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(filePath); err != nil {
+			return fmt.Errorf("Unable to watch %s -> %v", filePath, err)
+		}
+		return nil
+	})
+	return filePaths, err
+}
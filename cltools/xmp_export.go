@@ -0,0 +1,142 @@
+package cltools
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/tacusci/clover/img"
+)
+
+//xmpNamespaces are declared on the sidecar's description, in output order
+var xmpNamespaces = [][2]string{
+	{"dc", "http://purl.org/dc/elements/1.1/"},
+	{"tiff", "http://ns.adobe.com/tiff/1.0/"},
+	{"exif", "http://ns.adobe.com/exif/1.0/"},
+	{"exifEX", "http://cipa.jp/exif/1.0/"},
+}
+
+//xmpPropertyFields maps the sidecar's properties to the field keys they're picked by, the rest, like the exposure,
+//are only written when every field is
+var xmpPropertyFields = map[string]string{
+	"tiff:Make":               "make",
+	"tiff:Model":              "model",
+	"exifEX:LensModel":        "lens",
+	"exifEX:BodySerialNumber": "serial",
+	"exifEX:LensSerialNumber": "lensserial",
+	"exif:GPSLatitude":        "gps",
+	"exif:GPSLongitude":       "gps",
+	"exif:GPSAltitudeRef":     "gps",
+	"exif:GPSAltitude":        "gps",
+	"exif:GPSTimeStamp":       "gps",
+}
+
+//buildXMPSidecar writes the image's make, model, capture time, exposure and GPS position as an XMP packet, which
+//photo managers like Lightroom and darktable read from a sidecar next to the image. Only the picked fields are
+//written, nil picks them all, the format is always written
+func buildXMPSidecar(ri img.RawImage, picked map[string]bool) string {
+	properties := [][2]string{}
+	addProperty := func(name string, value string) {
+		if len(value) > 0 && (name == "dc:format" || teeFieldPicked(picked, xmpPropertyFields[name])) {
+			properties = append(properties, [2]string{name, value})
+		}
+	}
+
+	addProperty("dc:format", xmpMIMEType(ri.File.Name()))
+	if len(ri.Ifds) > 0 {
+		addProperty("tiff:Make", trimEXIFText(ri.Ifds[0].ImageMakeTag))
+		addProperty("tiff:Model", trimEXIFText(ri.Ifds[0].ImageModelTag))
+	}
+	if captureTime, ok := ri.GetCaptureTime(); ok {
+		addProperty("exif:DateTimeOriginal", captureTime.Format("2006-01-02T15:04:05"))
+	}
+	for _, ifd := range ri.Ifds {
+		if ifd.ExifIFD == nil {
+			continue
+		}
+		if ifd.ExifIFD.ExposureTime.Denominator > 0 {
+			addProperty("exif:ExposureTime", ifd.ExifIFD.ExposureTime.String())
+		}
+		if ifd.ExifIFD.FNumber.Denominator > 0 {
+			addProperty("exif:FNumber", ifd.ExifIFD.FNumber.String())
+		}
+		if ifd.ExifIFD.FocalLength.Denominator > 0 {
+			addProperty("exif:FocalLength", ifd.ExifIFD.FocalLength.String())
+		}
+		if ifd.ExifIFD.ISO > 0 {
+			addProperty("exifEX:PhotographicSensitivity", fmt.Sprintf("%d", ifd.ExifIFD.ISO))
+		}
+		addProperty("exifEX:LensModel", trimEXIFText(ifd.ExifIFD.LensModelTag))
+		break
+	}
+	addProperty("exifEX:BodySerialNumber", ri.GetBodySerial())
+	addProperty("exifEX:LensSerialNumber", ri.GetLensSerial())
+	if gpsIFD := ri.GetGpsIFD(); gpsIFD.HasFix() {
+		addProperty("exif:GPSLatitude", xmpGPSCoordinate(gpsIFD.Latitude(), "N", "S"))
+		addProperty("exif:GPSLongitude", xmpGPSCoordinate(gpsIFD.Longitude(), "E", "W"))
+		if gpsIFD.GPSAltitude.Denominator > 0 {
+			addProperty("exif:GPSAltitudeRef", fmt.Sprintf("%d", gpsIFD.GPSAltitudeRef))
+			addProperty("exif:GPSAltitude", gpsIFD.GPSAltitude.String())
+		}
+		if gpsTime, ok := gpsIFD.Time(); ok {
+			addProperty("exif:GPSTimeStamp", gpsTime.Format("2006-01-02T15:04:05Z"))
+		}
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	sb.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	sb.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	sb.WriteString("  <rdf:Description rdf:about=\"\"")
+	for _, namespace := range xmpNamespaces {
+		sb.WriteString(fmt.Sprintf("\n    xmlns:%s=\"%s\"", namespace[0], namespace[1]))
+	}
+	for _, property := range properties {
+		sb.WriteString(fmt.Sprintf("\n   %s=\"%s\"", property[0], escapeXMLAttribute(property[1])))
+	}
+	sb.WriteString("/>\n")
+	sb.WriteString(" </rdf:RDF>\n")
+	sb.WriteString("</x:xmpmeta>\n")
+	sb.WriteString("<?xpacket end=\"w\"?>\n")
+	return sb.String()
+}
+
+//xmpGPSCoordinate formats decimal degrees the way XMP stores GPS coordinates, as "DDD,MM.mmmmmmK" where K is the
+//hemisphere reference
+func xmpGPSCoordinate(degrees float64, positiveRef string, negativeRef string) string {
+	ref := positiveRef
+	if degrees < 0 {
+		ref, degrees = negativeRef, -degrees
+	}
+	wholeDegrees := math.Floor(degrees)
+	return fmt.Sprintf("%d,%.6f%s", int(wholeDegrees), (degrees-wholeDegrees)*60, ref)
+}
+
+//xmpMIMEType guesses the MIME type of the image from its extension, raws get a vendor type named after it
+func xmpMIMEType(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	switch ext {
+	case "":
+		return ""
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "tif", "tiff":
+		return "image/tiff"
+	}
+	return "image/x-" + ext
+}
+
+//escapeXMLAttribute escapes the value for use between an attribute's double quotes
+func escapeXMLAttribute(value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
+//trimEXIFText returns the EXIF text without its null terminator or padding
+func trimEXIFText(text []byte) string {
+	return string(bytes.Trim(text, "\x00 "))
+}
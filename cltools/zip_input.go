@@ -0,0 +1,115 @@
+package cltools
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tacusci/clover/img"
+	"github.com/tacusci/logging"
+)
+
+//zipImageFile is an image inside a zip archive, its entry is only decompressed into memory once it's first read
+//so the images waiting to be converted don't all sit in memory at once
+type zipImageFile struct {
+	name    string
+	zipFile *zip.File
+	mu      sync.Mutex
+	data    io.ReaderAt
+	readErr error
+}
+
+func (zif *zipImageFile) Name() string {
+	return zif.name
+}
+
+func (zif *zipImageFile) Stat() (os.FileInfo, error) {
+	return zif.zipFile.FileInfo(), nil
+}
+
+func (zif *zipImageFile) ReadAt(p []byte, off int64) (int, error) {
+	zif.mu.Lock()
+	if zif.data == nil && zif.readErr == nil {
+		zif.data, zif.readErr = readZipEntry(zif.zipFile)
+	}
+	data, readErr := zif.data, zif.readErr
+	zif.mu.Unlock()
+	if readErr != nil {
+		return 0, readErr
+	}
+	return data.ReadAt(p, off)
+}
+
+//Close frees the decompressed entry, it's read again if the image is
+func (zif *zipImageFile) Close() error {
+	zif.mu.Lock()
+	defer zif.mu.Unlock()
+	zif.data, zif.readErr = nil, nil
+	return nil
+}
+
+func readZipEntry(zipFile *zip.File) (io.ReaderAt, error) {
+	entryReader, err := zipFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer entryReader.Close()
+	data, err := ioutil.ReadAll(entryReader)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+//isZipArchive returns true if the location is a zip archive rather than a directory
+func isZipArchive(locationPath string) bool {
+	if isDir, _ := isDirectory(locationPath); isDir {
+		return false
+	}
+	return strings.EqualFold(filepath.Ext(locationPath), ".zip")
+}
+
+//findImagesInZip is findImagesInDir for a zip archive, images in folders within the archive are only found if
+//recursive, each found image is read straight out of the archive, which has to be kept open until they're converted
+func findImagesInZip(wg *sync.WaitGroup, itcc *chan img.TiffImage, zipReader *zip.Reader, zipPath string, inputTypePrefixToMatch string, inputType string, recursive bool) {
+	defer wg.Done()
+	for _, zipFile := range zipReader.File {
+		imagePath, ok := matchZipEntry(zipFile, zipPath, inputTypePrefixToMatch, inputType, recursive)
+		if !ok {
+			continue
+		}
+		imageFile := &zipImageFile{name: imagePath, zipFile: zipFile}
+		ti, ok := img.NewImage(inputType, img.RawImage{File: imageFile})
+		if !ok {
+			continue
+		}
+		*itcc <- ti
+	}
+}
+
+//matchZipEntry returns the path of the image in the zip archive, which is the archive's path joined with the entry's
+//name, and true if the entry is an image of the input type which should be found
+func matchZipEntry(zipFile *zip.File, zipPath string, inputTypePrefixToMatch string, inputType string, recursive bool) (string, bool) {
+	if zipFile.FileInfo().IsDir() {
+		return "", false
+	}
+	entryName := path.Clean(strings.TrimLeft(zipFile.Name, "/"))
+	if strings.HasPrefix(entryName, "../") {
+		logging.Error(fmt.Sprintf("Skipping zip entry %s, it's outside of the archive", zipFile.Name))
+		return "", false
+	}
+	if !recursive && strings.Contains(entryName, "/") {
+		return "", false
+	}
+	if !matchesInputType(path.Base(entryName), inputTypePrefixToMatch, inputType) {
+		return "", false
+	}
+	return filepath.Join(zipPath, filepath.FromSlash(entryName)), true
+}
@@ -0,0 +1,107 @@
+package cltools
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/tacusci/logging"
+)
+
+//zipEntry is a converted image waiting to be added to the zip archive, it's already been written to a temporary
+//file by a conversion worker
+type zipEntry struct {
+	name     string
+	tempPath string
+}
+
+//zipOutput owns the zip archive that converted images are written into, the conversion workers send it their
+//outputs and a single goroutine adds them to the archive one at a time
+type zipOutput struct {
+	entries chan zipEntry
+	done    chan error
+	tempDir string
+}
+
+//newZipOutput creates the zip archive at the path and starts the goroutine adding entries to it
+func newZipOutput(zipPath string) (*zipOutput, error) {
+	tempDir, err := ioutil.TempDir("", "clover-rtc")
+	if err != nil {
+		return nil, err
+	}
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	zo := &zipOutput{
+		entries: make(chan zipEntry, 32),
+		done:    make(chan error, 1),
+		tempDir: tempDir,
+	}
+	go zo.write(zipFile)
+	return zo, nil
+}
+
+//tempPath creates an empty temporary file for a worker to write an output with the extension to
+func (zo *zipOutput) tempPath(ext string) (string, error) {
+	tempFile, err := ioutil.TempFile(zo.tempDir, "*"+ext)
+	if err != nil {
+		return "", err
+	}
+	return tempFile.Name(), tempFile.Close()
+}
+
+//add queues the output at the temporary path to be added to the archive under the name
+func (zo *zipOutput) add(name string, tempPath string) {
+	zo.entries <- zipEntry{name: name, tempPath: tempPath}
+}
+
+//close waits for every queued output to be added then finishes writing the archive, it has to be called once all
+//the workers are done, whether or not their conversions succeeded, or the archive is left unreadable
+func (zo *zipOutput) close() error {
+	close(zo.entries)
+	err := <-zo.done
+	if removeErr := os.RemoveAll(zo.tempDir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (zo *zipOutput) write(zipFile *os.File) {
+	zipWriter := zip.NewWriter(zipFile)
+	addedNames := map[string]bool{}
+	for entry := range zo.entries {
+		if addedNames[entry.name] {
+			logging.Error(fmt.Sprintf("Skipping %s, the zip archive already has an entry with that name", entry.name))
+		} else if err := addZipEntry(zipWriter, entry); err != nil {
+			logging.Error(fmt.Sprintf("Unable to add %s to zip archive -> %v", entry.name, err))
+		} else {
+			addedNames[entry.name] = true
+		}
+		os.Remove(entry.tempPath)
+	}
+	err := zipWriter.Close()
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	zo.done <- err
+}
+
+func addZipEntry(zipWriter *zip.Writer, entry zipEntry) error {
+	tempFile, err := os.Open(entry.tempPath)
+	if err != nil {
+		return err
+	}
+	defer tempFile.Close()
+	//JPEGs and PNGs are already compressed, so they're stored as they are
+	entryWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entryWriter, tempFile)
+	return err
+}
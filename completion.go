@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tacusci/clover/img"
+)
+
+//completionFlag is a flag of a tool as far as completing it goes, values are what it can be set to if it only
+//takes a few, and takesValue is false for bool flags
+type completionFlag struct {
+	name       string
+	takesValue bool
+	values     []string
+}
+
+//completionTool is a tool's flag, what it's for, and the flags it takes
+type completionTool struct {
+	name        string
+	description string
+	flags       []completionFlag
+}
+
+//completionShells are the shells completion scripts can be generated for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func valueFlag(name string, values ...string) completionFlag {
+	return completionFlag{name: name, takesValue: true, values: values}
+}
+
+func boolFlag(name string) completionFlag {
+	return completionFlag{name: name}
+}
+
+//completionTools lists the tools and their flags, it has to be kept in step with the flags runTool defines
+func completionTools() []completionTool {
+	var inputTypes []string
+	for _, ext := range img.RegisteredTypes() {
+		inputTypes = append(inputTypes, "*"+ext)
+	}
+	//every tool takes these as well
+	commonFlags := []completionFlag{boolFlag("debug"), valueFlag("color", "auto", "always", "never"), valueFlag("pprof"), boolFlag("syslog")}
+	tools := []completionTool{
+		{"/sdc", "Tool for checking size of storage devices", []completionFlag{
+			valueFlag("l"), valueFlag("s"), boolFlag("sic"), boolFlag("nd"), boolFlag("fill"), boolFlag("verify-only"),
+			valueFlag("pattern", "mixed", "zero", "one", "random", "counting", "alt"), valueFlag("csv"), boolFlag("hist"),
+			valueFlag("retries"), boolFlag("clean"), boolFlag("rs"), boolFlag("y"), boolFlag("yes"), valueFlag("manifest"),
+			valueFlag("verify-manifest"), boolFlag("force"), valueFlag("summary"), valueFlag("j"),
+		}},
+		{"/rtc", "Tool for batch compressing raw images", []completionFlag{
+			valueFlag("id"), valueFlag("od"), valueFlag("it", inputTypes...), valueFlag("ot", ".jpg", ".png", ".jpg,.png"),
+			valueFlag("onexist", "skip", "overwrite", "newer", "rename", "backup", "smaller", "larger"), boolFlag("ow"),
+			boolFlag("rs"), boolFlag("fs"), boolFlag("so"), boolFlag("ts"), valueFlag("since"), boolFlag("watch"), valueFlag("j"),
+			valueFlag("jcpu"), valueFlag("jio"), valueFlag("maxmem"), valueFlag("aspect"), boolFlag("gray"),
+			valueFlag("brightness"), valueFlag("contrast"),
+			valueFlag("rotate", "0", "90", "180", "270"), valueFlag("flip", "h", "v"), valueFlag("border"),
+			valueFlag("bordercolor"), valueFlag("zip"), valueFlag("dpi"), boolFlag("prog"), boolFlag("noscan"),
+			boolFlag("verify-output"), valueFlag("verify-retries"), valueFlag("name"), valueFlag("preview-max"),
+			valueFlag("minw"), valueFlag("minh"), boolFlag("stdout"), boolFlag("cp"), boolFlag("cg"), boolFlag("list"),
+			boolFlag("fail-fast"), valueFlag("summary"), valueFlag("from"), valueFlag("maxsize"),
+		}},
+		{"/tee", "Tool for batch exporting of raw images EXIF data", []completionFlag{
+			valueFlag("id"), valueFlag("od"), valueFlag("it", inputTypes...), boolFlag("ow"), boolFlag("rs"), boolFlag("so"),
+			boolFlag("ts"), valueFlag("since"), valueFlag("fields"), valueFlag("of", "txt", "json", "xmp"), boolFlag("list"),
+			boolFlag("fail-fast"), valueFlag("hash", "md5", "sha256"), boolFlag("hexdump"), valueFlag("summary"),
+			valueFlag("names", "clover", "exiftool"),
+		}},
+		{"/gpx", "Tool for exporting raw images GPS locations as a GPX file", []completionFlag{
+			valueFlag("id"), valueFlag("o"), valueFlag("it", inputTypes...), boolFlag("rs"), boolFlag("ts"),
+		}},
+		{"/stat", "Tool for printing counts of raw images per camera, lens and ISO", []completionFlag{
+			valueFlag("id"), valueFlag("it", inputTypes...), boolFlag("rs"), valueFlag("of", "txt", "json"),
+		}},
+		{"/serve", "Tool for converting raw images posted to a HTTP server", []completionFlag{
+			valueFlag("addr"), valueFlag("maxbody"), valueFlag("j"),
+		}},
+	}
+	for i := range tools {
+		tools[i].flags = append(tools[i].flags, commonFlags...)
+	}
+	return tools
+}
+
+//runCompletion writes the completion script for the shell named in args to stdout, returning the code to exit with
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Printf("Usage: %s completion <%s>\n", os.Args[0], strings.Join(completionShells, "|"))
+		return 1
+	}
+	var err error
+	switch args[0] {
+	case "bash":
+		err = writeBashCompletion(os.Stdout, completionTools())
+	case "zsh":
+		//zsh can run bash completion functions once bashcompinit is loaded
+		if _, err = io.WriteString(os.Stdout, "autoload -U +X bashcompinit && bashcompinit\n"); err == nil {
+			err = writeBashCompletion(os.Stdout, completionTools())
+		}
+	case "fish":
+		err = writeFishCompletion(os.Stdout, completionTools())
+	default:
+		fmt.Printf("Shell %s not supported, must be one of %s\n", args[0], strings.Join(completionShells, ", "))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write completion script -> %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+//writeBashCompletion writes a bash completion script, which completes the tool first, then its flags, then the
+//values of flags which only take a few, falling back to completing file names. Completions are read with mapfile
+//rather than word split, so they aren't expanded either
+func writeBashCompletion(w io.Writer, tools []completionTool) error {
+	sb := strings.Builder{}
+	toolNames := []string{"completion"}
+	for _, tool := range tools {
+		toolNames = append(toolNames, tool.name)
+	}
+	sb.WriteString("_clover() {\n")
+	sb.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	sb.WriteString("\tCOMPREPLY=()\n")
+	sb.WriteString("\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	sb.WriteString(fmt.Sprintf("\t\tmapfile -t COMPREPLY < <(compgen -W \"%s\" -- \"$cur\")\n", strings.Join(toolNames, " ")))
+	sb.WriteString("\t\treturn\n\tfi\n")
+	sb.WriteString("\tcase \"${COMP_WORDS[1]} $prev\" in\n")
+	for _, tool := range tools {
+		for _, f := range tool.flags {
+			if len(f.values) > 0 {
+				sb.WriteString(fmt.Sprintf("\t\"%s -%s\") mapfile -t COMPREPLY < <(compgen -W \"%s\" -- \"$cur\"); return ;;\n", tool.name, f.name, bashWords(f.values)))
+			}
+		}
+	}
+	sb.WriteString("\tesac\n")
+	sb.WriteString("\tcase \"${COMP_WORDS[1]}\" in\n")
+	sb.WriteString(fmt.Sprintf("\tcompletion) mapfile -t COMPREPLY < <(compgen -W \"%s\" -- \"$cur\") ;;\n", strings.Join(completionShells, " ")))
+	for _, tool := range tools {
+		var flagNames []string
+		for _, f := range tool.flags {
+			flagNames = append(flagNames, "-"+f.name)
+		}
+		sb.WriteString(fmt.Sprintf("\t%s) [[ \"$cur\" == -* ]] && mapfile -t COMPREPLY < <(compgen -W \"%s\" -- \"$cur\") ;;\n", tool.name, strings.Join(flagNames, " ")))
+	}
+	sb.WriteString("\tesac\n")
+	sb.WriteString("}\n")
+	sb.WriteString("complete -o default -F _clover clover\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+//bashWords joins the words for compgen -W, escaping the * of input types like *.nef so compgen doesn't expand them
+//into the file names they match
+func bashWords(words []string) string {
+	return strings.Replace(strings.Join(words, " "), "*", "\\*", -1)
+}
+
+//writeFishCompletion writes a fish completion script, flags are single dash old style options in fish's terms
+func writeFishCompletion(w io.Writer, tools []completionTool) error {
+	sb := strings.Builder{}
+	sb.WriteString("complete -c clover -n __fish_use_subcommand -f -a completion -d 'Generate a shell completion script'\n")
+	sb.WriteString(fmt.Sprintf("complete -c clover -n '__fish_seen_subcommand_from completion' -f -a '%s'\n", strings.Join(completionShells, " ")))
+	for _, tool := range tools {
+		sb.WriteString(fmt.Sprintf("complete -c clover -n __fish_use_subcommand -f -a %s -d '%s'\n", tool.name, tool.description))
+		for _, f := range tool.flags {
+			sb.WriteString(fmt.Sprintf("complete -c clover -n '__fish_seen_subcommand_from %s' -o %s", tool.name, f.name))
+			if len(f.values) > 0 {
+				sb.WriteString(fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " ")))
+			} else if f.takesValue {
+				sb.WriteString(" -r")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
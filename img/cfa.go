@@ -0,0 +1,90 @@
+package img
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/tacusci/clover/utils"
+)
+
+//CFA pattern colour values
+const (
+	cfaRed   uint8 = 0
+	cfaGreen uint8 = 1
+	cfaBlue  uint8 = 2
+)
+
+//maxCFADimension is the widest or tallest raw data decoded, well over any sensor, so a malformed width or height
+//can't make the decoded image's size overflow
+const maxCFADimension = 1 << 16
+
+//the most common 2x2 CFA layout, used if the IFD doesn't say otherwise
+var defaultCFAPattern = []uint8{cfaRed, cfaGreen, cfaGreen, cfaBlue}
+
+//decodeUncompressedCFA decodes uncompressed CFA data held in 16 bit containers, each 2x2 block of the
+//colour filter array becomes a single pixel so the result is half the width and height of the sensor data
+func decodeUncompressedCFA(reader io.ReaderAt, rawDataIFD TiffIFD, endianOrder utils.EndianOrder) (image.Image, error) {
+	width, height := int(rawDataIFD.ImageWidth), int(rawDataIFD.ImageHeight)
+	if width < 2 || height < 2 {
+		return nil, errors.New("Raw image data too small to decode")
+	}
+	if width > maxCFADimension || height > maxCFADimension {
+		return nil, fmt.Errorf("Raw image data of %dx%d is too large to decode", width, height)
+	}
+
+	bitsPerSample := 16
+	if len(rawDataIFD.BitsPerSample) > 0 && rawDataIFD.BitsPerSample[0] > 0 {
+		bitsPerSample = int(rawDataIFD.BitsPerSample[0])
+	}
+	if bitsPerSample > 16 {
+		return nil, fmt.Errorf("Raw image data with %d bits per sample not supported", bitsPerSample)
+	}
+	rowSize := width * 2
+	//both sides are bounded, so this can't overflow
+	dataLength := uint64(rowSize) * uint64(height)
+	if uint64(rawDataIFD.StripByteCounts) < dataLength {
+		return nil, errors.New("Packed raw image data not supported")
+	}
+	//the strip's offset and length are read from the file, so the image isn't allocated until it's known the data's there
+	if !fitsInReader(reader, rawDataIFD.StripOffsets, dataLength) {
+		return nil, errors.New("Raw image data runs past the end of the file")
+	}
+
+	cfaPattern := defaultCFAPattern
+	if len(rawDataIFD.CFAPattern) == 4 {
+		cfaPattern = rawDataIFD.CFAPattern
+	}
+
+	decodedImage := image.NewRGBA64(image.Rect(0, 0, width/2, height/2))
+	rows := make([]byte, rowSize*2)
+	for y := 0; y+1 < height; y += 2 {
+		//read the pair of rows making up this row of 2x2 blocks
+		if _, err := reader.ReadAt(rows, int64(rawDataIFD.StripOffsets)+int64(y*rowSize)); err != nil {
+			return nil, err
+		}
+		for x := 0; x+1 < width; x += 2 {
+			var channels [3]uint32
+			var channelCounts [3]uint32
+			for i, offset := range []int{x * 2, x*2 + 2, rowSize + x*2, rowSize + x*2 + 2} {
+				channel := cfaPattern[i]
+				if channel > cfaBlue {
+					continue
+				}
+				sample := uint32(utils.ConvertBytesSliceToUInt16(rows[offset:offset+2], endianOrder))
+				//scale up to the full 16 bit range
+				channels[channel] += sample << uint(16-bitsPerSample)
+				channelCounts[channel]++
+			}
+			for channel := range channels {
+				if channelCounts[channel] > 0 {
+					channels[channel] /= channelCounts[channel]
+				}
+			}
+			decodedImage.SetRGBA64(x/2, y/2, color.RGBA64{R: uint16(channels[cfaRed]), G: uint16(channels[cfaGreen]), B: uint16(channels[cfaBlue]), A: 0xffff})
+		}
+	}
+	return decodedImage, nil
+}
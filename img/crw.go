@@ -0,0 +1,217 @@
+package img
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+//CIFF record tag values, with the storage location bits masked off
+const (
+	ciffMakeModelTag  uint16 = 0x080a
+	ciffTimeStampTag  uint16 = 0x180e
+	ciffImageInfoTag  uint16 = 0x1810
+	ciffJpgFromRawTag uint16 = 0x2007
+)
+
+const (
+	ciffSignature = "HEAPCCDR"
+	//records are a tag, then either 8 bytes of data or a size and offset into the heap
+	ciffRecordSize = 10
+	//heaps hold other heaps, this stops a malformed file sending us round in circles
+	ciffMaxHeapDepth = 8
+)
+
+//CrwImage is a Canon raw from before the CR2, which uses the CIFF container rather than TIFF, so its records are
+//read into a single IFD to let everything else treat it like any other raw
+type CrwImage struct {
+	RawImage
+}
+
+func (ci *CrwImage) GetRawImage() RawImage {
+	return ci.RawImage
+}
+
+func (ci *CrwImage) Load() error {
+	return ci.loadOnce(ci.load)
+}
+
+func (ci *CrwImage) load() error {
+	logging.Debug(fmt.Sprintf("\nParsing %s CIFF image data", ci.File.Name()))
+	fileStats, err := ci.File.Stat()
+	if err != nil {
+		return err
+	}
+	headerBytes, err := readHeaderBytes(ci.File, fileStats.Size())
+	if err != nil {
+		return err
+	}
+	if len(headerBytes) < 14 || string(headerBytes[6:14]) != ciffSignature {
+		return errors.New("Not a CIFF image, missing HEAPCCDR signature")
+	}
+	endianOrder, err := utils.DetectEndian(headerBytes[:2])
+	if err != nil {
+		return err
+	}
+	endianReader := utils.NewEndianReader(ci.File, endianOrder)
+	headerLength, err := endianReader.Uint32(2)
+	if err != nil {
+		return err
+	}
+	if int64(headerLength) >= fileStats.Size() {
+		return errors.New("CIFF header length runs past the end of the file")
+	}
+
+	ci.Header = TiffHeader{EndianOrder: endianOrder, TiffOffset: uint64(headerLength)}
+	//loading again re-reads the records rather than adding to them
+	ci.Ifds = nil
+	ifd := TiffIFD{}
+	if err := parseCiffHeap(ci.File, endianOrder, int64(headerLength), fileStats.Size()-int64(headerLength), &ifd, 0); err != nil {
+		return err
+	}
+	ci.Ifds = append(ci.Ifds, ifd)
+	return nil
+}
+
+func (ci *CrwImage) Decode() (image.Image, error) {
+	if err := ci.Load(); err != nil {
+		return nil, err
+	}
+	previewIFD := ci.GetLargestPreviewIFD()
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	return ci.decodePreview(previewIFD)
+}
+
+func (ci *CrwImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := ci.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (ci *CrwImage) WritePNG(w io.Writer) error {
+	decodedImage, err := ci.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (ci *CrwImage) ConvertToJPEG(outputPath string) error {
+	defer ci.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return ci.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (ci *CrwImage) ConvertToPNG(outputPath string) error {
+	defer ci.RawImage.File.Close()
+	return writeImageFile(outputPath, ci.WritePNG)
+}
+
+//parseCiffHeap reads the records of the heap starting at heapStart, recursing into sub heaps, and sets the
+//fields of the IFD they map to
+func parseCiffHeap(reader io.ReaderAt, endianOrder utils.EndianOrder, heapStart int64, heapLength int64, ifd *TiffIFD, depth int) error {
+	if depth > ciffMaxHeapDepth {
+		return errors.New("CIFF heaps nested too deeply")
+	}
+	if heapLength < 4 {
+		return errors.New("CIFF heap too short")
+	}
+	endianReader := utils.NewEndianReader(reader, endianOrder)
+	//the offset of the record table is stored in the heap's last four bytes
+	tableOffset, err := endianReader.Uint32(heapStart + heapLength - 4)
+	if err != nil {
+		return err
+	}
+	if int64(tableOffset) >= heapLength {
+		return errors.New("CIFF record table runs past the end of its heap")
+	}
+	recordCount, err := endianReader.Uint16(heapStart + int64(tableOffset))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(recordCount); i++ {
+		recordStart := heapStart + int64(tableOffset) + 2 + int64(i*ciffRecordSize)
+		tag, err := endianReader.Uint16(recordStart)
+		if err != nil {
+			return err
+		}
+		//data of 8 bytes or less can be stored in the record itself
+		dataStart, dataLength := recordStart+2, int64(8)
+		if tag&0xc000 == 0 {
+			size, err := endianReader.Uint32(recordStart + 2)
+			if err != nil {
+				return err
+			}
+			offset, err := endianReader.Uint32(recordStart + 6)
+			if err != nil {
+				return err
+			}
+			dataStart, dataLength = heapStart+int64(offset), int64(size)
+			if int64(offset)+int64(size) > heapLength {
+				logging.Debug(fmt.Sprintf("Skipping CIFF record 0x%04x, it runs past the end of its heap", tag))
+				continue
+			}
+		}
+
+		switch tag & 0x3800 {
+		case 0x2800, 0x3000:
+			if err := parseCiffHeap(reader, endianOrder, dataStart, dataLength, ifd, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch tag & 0x3fff {
+		case ciffMakeModelTag:
+			//make and model are stored one after the other, each null terminated
+			data, err := readCiffData(reader, dataStart, dataLength)
+			if err != nil {
+				return err
+			}
+			makeAndModel := bytes.SplitN(data, []byte{0}, 3)
+			ifd.ImageMakeTag = makeAndModel[0]
+			if len(makeAndModel) > 1 {
+				ifd.ImageModelTag = makeAndModel[1]
+			}
+		case ciffTimeStampTag:
+			//seconds since the epoch on the camera's clock, so it's local time with no time zone like EXIF's
+			timeStamp, err := endianReader.Uint32(dataStart)
+			if err != nil {
+				return err
+			}
+			ifd.DateTimeOriginalText = []byte(time.Unix(int64(timeStamp), 0).UTC().Format(exifDateTimeLayout))
+		case ciffImageInfoTag:
+			if ifd.ImageWidth, err = endianReader.Uint32(dataStart); err != nil {
+				return err
+			}
+			if ifd.ImageHeight, err = endianReader.Uint32(dataStart + 4); err != nil {
+				return err
+			}
+		case ciffJpgFromRawTag:
+			ifd.JpegFromRawStart = uint64(dataStart)
+			ifd.JpegFromRawLength = uint32(dataLength)
+		}
+	}
+	return nil
+}
+
+func readCiffData(reader io.ReaderAt, dataStart int64, dataLength int64) ([]byte, error) {
+	data := make([]byte, dataLength)
+	if _, err := reader.ReadAt(data, dataStart); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
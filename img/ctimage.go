@@ -1,13 +1,18 @@
 package img
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"io/ioutil"
 	"math"
 	"os"
+	"time"
 
 	"github.com/tacusci/clover/utils"
 	"github.com/tacusci/logging"
@@ -615,6 +620,13 @@ const (
 	signedRationalType   uint8 = 10 //is 4 bytes in size
 	singleFloatType      uint8 = 11 //is 4 bytes in size
 	doubleFloatType      uint8 = 12 //is 8 bytes in size
+	ifdType              uint8 = 13 //is 4 bytes in size
+	unsignedLong8Type    uint8 = 16 //is 8 bytes in size, BigTIFF only
+	signedLong8Type      uint8 = 17 //is 8 bytes in size, BigTIFF only
+	ifd8Type             uint8 = 18 //is 8 bytes in size, BigTIFF only
+
+	classicTiffMagicNum uint16 = 0x002a
+	bigTiffMagicNum     uint16 = 0x002b
 
 	photometricInterpretationMinIsWhite       uint16 = 0
 	photometricInterpretationMinIsBlack       uint16 = 1
@@ -628,6 +640,7 @@ const (
 	photometricInterpretationITULAB           uint16 = 10
 	photometricInterpretationLOGL             uint16 = 32844
 	photometricInterpretationLOGLUV           uint16 = 32845
+	photometricInterpretationCFA              uint16 = 32803
 
 	compressionNone                uint16 = 1
 	compressionCCITTRLE            uint16 = 2
@@ -639,6 +652,14 @@ const (
 	compressionADOBEDEFLATE        uint16 = 8
 	compressionJBIGOnBlackAndWhite uint16 = 9
 	compressionJBIGOnColor         uint16 = 10
+	compressionPackBits            uint16 = 32773
+	compressionDeflate             uint16 = 32946
+	compressionNikonNEF            uint16 = 34713
+	compressionLossyJPEG           uint16 = 34892
+
+	resolutionUnitNone       uint16 = 1
+	resolutionUnitInch       uint16 = 2
+	resolutionUnitCentimeter uint16 = 3
 
 	subfileTypeReducedResolutionImage     SubfileType = 1
 	subfileTypeSinglePageOfMultipageImage SubfileType = 2
@@ -648,10 +669,21 @@ const (
 
 type SubfileType uint8
 
+const exifDateTimeLayout = "2006:01:02 15:04:05"
+
 type TiffHeader struct {
 	EndianOrder utils.EndianOrder
 	MagicNum    uint16
-	TiffOffset  uint32
+	BigTiff     bool
+	TiffOffset  uint64
+}
+
+//ifdEntrySize returns the length in bytes of a single IFD entry, which is 12 for classic TIFF and 20 for BigTIFF
+func (th TiffHeader) ifdEntrySize() int {
+	if th.BigTiff {
+		return 20
+	}
+	return 12
 }
 
 type TiffIFD struct {
@@ -665,40 +697,57 @@ type TiffIFD struct {
 	PhotometricInterpretationFlag uint16
 	ImageMakeTag                  []byte
 	ImageModelTag                 []byte
-	StripOffsets                  uint32
+	StripOffsets                  uint64
 	OrientationFlag               uint16
 	SamplesPerPixel               uint16
 	RowsPerStrip                  uint32
 	StripByteCounts               uint32
-	XResolution                   uint32
-	YResolution                   uint32
+	XResolution                   Rational
+	YResolution                   Rational
 	PlanarConfiguration           uint16
 	ResolutionUnit                uint16
 	SoftwareTextData              []byte
 	DateTimeText                  []byte
-	SubIFDOffsets                 []uint32
+	SubIFDOffsets                 []uint64
 	ReferenceBlackWhite           uint64
-	ExifOffset                    uint32
+	ExifOffset                    uint64
+	ExifIFD                       *TiffIFD
 	GpsInfo                       uint32
 	GpsIFD                        *GpsIFD
 	DateTimeOriginalText          []byte
 	TiffEPStandardID              []byte
-	JpegFromRawStart              uint32
+	JpegFromRawStart              uint64
 	JpegFromRawLength             uint32
+	LensModelTag                  []byte
+	ExposureTime                  Rational
+	FNumber                       Rational
+	ISO                           uint16
+	FocalLength                   Rational
+	BodySerialNumber              []byte
+	LensSerialNumber              []byte
+	MakerNoteSerialNumber         []byte
+	MakerNoteOffset               uint64
+	MakerNoteLength               uint32
 	YCbCrPositioning              uint16
 	CFARepeatPatternDim           uint16
 	CFAPattern2                   uint8
+	CFAPattern                    []uint8
 	SensingMethod                 uint16
+	ICCProfile                    []byte
+	//Entries are all of the IFD's entries as they're stored
+	Entries []IFDEntry
 }
 
 type GpsIFD struct {
 	GPSVersionID       []uint8
-	GPSLatitudeRef     [2]string
-	GPSLatitude        [3]uint64
-	GPSLongitudeRef    [2]string
-	GPSLongitude       [3]uint64
-	GPSAltitude        uint64
-	GPSTimeStamp       [3]uint64
+	GPSLatitudeRef     string
+	GPSLatitude        [3]Rational
+	GPSLongitudeRef    string
+	GPSLongitude       [3]Rational
+	GPSAltitudeRef     uint8
+	GPSAltitude        Rational
+	GPSTimeStamp       [3]Rational
+	GPSDateStamp       string
 	GPSSatellites      string
 	GPSStatus          [2]string
 	GPSMeasureMode     [2]string
@@ -709,49 +758,305 @@ type GpsIFD struct {
 	GPSTrack           uint16
 	GPSImgDirectionRef [2]string
 	GPSImgDirection    uint64
+	//Entries are all of the GPS IFD's entries as they're stored
+	Entries []IFDEntry
 }
 
+//Rational is a TIFF rational value, made up of two unsigned longs
+type Rational = utils.Rational
+
+//TiffImage is a raw image format, the name is historical as not every format is TIFF based. Implementations embed
+//RawImage and are made available to the tools with Register. Load parses the file's metadata into the RawImage's IFDs
+//without closing the file, only the first successful call reads the file and later calls, from any goroutine, reuse
+//its IFDs. Decode loads the image and returns it, or the largest embedded preview for formats which can't be decoded.
+//WriteJPEG and WritePNG decode the image and encode it to w, leaving the file open. ConvertToJPEG and ConvertToPNG
+//write it to the output path instead, JPEGs at the default quality, and close the file, even on error. GetRawImage
+//returns the embedded RawImage, and GetEXIFMap, GetThumbnail and GetPreviews the loaded metadata and embedded JPEGs,
+//which embedding RawImage provides
 type TiffImage interface {
 	Load() error
+	Decode() (image.Image, error)
+	WriteJPEG(w io.Writer, quality int) error
+	WritePNG(w io.Writer) error
 	ConvertToJPEG(outputPath string) error
 	ConvertToPNG(outputPath string) error
 	GetRawImage() RawImage
+	GetEXIFMap() map[string]interface{}
+	GetThumbnail() ([]byte, error)
+	GetPreviews() ([]Preview, error)
+}
+
+//ImageFile is what an image is read from, usually an *os.File, but anything else which can be read at offsets,
+//like an entry of an archive, works as well
+type ImageFile interface {
+	io.ReaderAt
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
 }
 
 type RawImage struct {
-	File           *os.File
+	File           ImageFile
 	Header         TiffHeader
 	Ifds           []TiffIFD
 	CompressedData []byte
 	Data           []byte
+	loadCache      *loadCache
 }
 
 func (ri *RawImage) GetRawImage() RawImage {
 	return *ri
 }
 
+//GetGpsIFD returns the first parsed GPS IFD, or nil if the image has none
+func (ri *RawImage) GetGpsIFD() *GpsIFD {
+	for _, ifd := range ri.Ifds {
+		if ifd.GpsIFD != nil {
+			return ifd.GpsIFD
+		}
+	}
+	return nil
+}
+
+//GetRawDataIFD returns the IFD holding the sensor's CFA data, or nil if the image has none
+func (ri *RawImage) GetRawDataIFD() *TiffIFD {
+	for i := range ri.Ifds {
+		if ri.Ifds[i].PhotometricInterpretationFlag == photometricInterpretationCFA {
+			return &ri.Ifds[i]
+		}
+	}
+	return nil
+}
+
+//GetCompression returns the compression of the image's CFA data, which for NEFs is either uncompressed (1)
+//or Nikon compressed (34713), or 0 if the image has no CFA data
+func (ri *RawImage) GetCompression() uint16 {
+	if rawDataIFD := ri.GetRawDataIFD(); rawDataIFD != nil {
+		return rawDataIFD.CompressionFlag
+	}
+	return 0
+}
+
+//compressionNames are the labels of the values of the Compression tag
+var compressionNames = map[uint16]string{
+	compressionNone:                "Uncompressed",
+	compressionCCITTRLE:            "CCITT RLE",
+	compressionCCITTFAX3:           "CCITT Group 3 fax",
+	compressionCCITTFAX4:           "CCITT Group 4 fax",
+	compressionLZW:                 "LZW",
+	compressionOJPEG:               "Old-style JPEG",
+	compressionJPEG:                "JPEG",
+	compressionADOBEDEFLATE:        "Adobe Deflate",
+	compressionJBIGOnBlackAndWhite: "JBIG black and white",
+	compressionJBIGOnColor:         "JBIG color",
+	compressionPackBits:            "PackBits",
+	compressionDeflate:             "Deflate",
+	compressionNikonNEF:            "Nikon NEF compressed",
+	compressionLossyJPEG:           "Lossy JPEG",
+}
+
+//CompressionName returns the value of the Compression tag with its label, e.g. "7 (JPEG)", or just the value if
+//it isn't known
+func CompressionName(compression uint16) string {
+	if name, ok := compressionNames[compression]; ok {
+		return fmt.Sprintf("%d (%s)", compression, name)
+	}
+	return fmt.Sprintf("%d", compression)
+}
+
+//GetCaptureTime returns when the image was taken, using the original date/time if present, otherwise the modify date/time
+func (ri *RawImage) GetCaptureTime() (time.Time, bool) {
+	for _, ifd := range ri.Ifds {
+		if t, err := parseExifDateTime(ifd.DateTimeOriginalText); err == nil {
+			return t, true
+		}
+		if ifd.ExifIFD != nil {
+			if t, err := parseExifDateTime(ifd.ExifIFD.DateTimeOriginalText); err == nil {
+				return t, true
+			}
+		}
+	}
+	for _, ifd := range ri.Ifds {
+		if t, err := parseExifDateTime(ifd.DateTimeText); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//parseExifDateTime parses EXIF's "YYYY:MM:DD HH:MM:SS" date/time text, which holds no time zone
+func parseExifDateTime(dateTimeText []byte) (time.Time, error) {
+	return time.Parse(exifDateTimeLayout, string(bytes.Trim(dateTimeText, "\x00 ")))
+}
+
+//Load parses the file's header and IFDs, only the first successful call reads the file, later ones reuse the IFDs
 func (ri *RawImage) Load() error {
+	return ri.loadOnce(ri.load)
+}
+
+func (ri *RawImage) load() error {
 	logging.Debug(fmt.Sprintf("\nParsing %s image data", ri.File.Name()))
-	headerBytes, err := readHeaderBytes(ri.File)
+	fileStats, err := ri.File.Stat()
 	if err != nil {
 		return err
 	}
+	//only the header, IFDs and their values are read, at their offsets, the image data itself is left on disk
+	headerBytes, err := readHeaderBytes(ri.File, fileStats.Size())
+	if err != nil {
+		return err
+	}
+	return ri.loadIFDs(ri.File, headerBytes, fileStats.Size())
+}
+
+//loadIFDs parses the TIFF structure read from reader, whose offsets are counted from the TIFF header at its start,
+//which is the whole file for TIFF based raws but only the EXIF segment of a JPEG
+func (ri *RawImage) loadIFDs(reader io.ReaderAt, headerBytes []byte, size int64) error {
+	var err error
 	ri.Header, err = parseHeaderBytes(headerBytes)
 	if err != nil {
 		return err
 	}
-	ifd0Bytes := readIFDBytes(ri.File, ri.Header.TiffOffset, ri.Header.EndianOrder)
+	//sized, so the lengths read from the file can be checked against it
+	reader = io.NewSectionReader(reader, 0, size)
+	//loading again re-reads the IFDs rather than adding to them
+	ri.Ifds = nil
+	ifd0Bytes, err := readIFDBytes(reader, ri.Header.TiffOffset, ri.Header)
+	if err != nil {
+		return err
+	}
 	logging.Debug("Parsing IFD0:")
-	ifd0 := parseIFDBytes(ri.File, ifd0Bytes, ri.Header)
+	ifd0 := parseIFDBytes(reader, ifd0Bytes, ri.Header)
 	ri.Ifds = append(ri.Ifds, ifd0)
 
 	for i := 0; i < len(ifd0.SubIFDOffsets); i++ {
 		logging.Debug(fmt.Sprintf("\nParsing SubIFD%d:", i))
-		ri.Ifds = append(ri.Ifds, parseIFDBytes(ri.File, readIFDBytes(ri.File, ifd0.SubIFDOffsets[i], ri.Header.EndianOrder), ri.Header))
+		subIFDBytes, err := readIFDBytes(reader, ifd0.SubIFDOffsets[i], ri.Header)
+		if err != nil {
+			return err
+		}
+		ri.Ifds = append(ri.Ifds, parseIFDBytes(reader, subIFDBytes, ri.Header))
+	}
+
+	//follow the chain of IFDs after IFD0, these go after the SubIFDs so their indexes stay the same
+	visitedOffsets := map[uint64]bool{ri.Header.TiffOffset: true}
+	nextIFDOffset := readNextIFDOffset(reader, ri.Header.TiffOffset, len(ifd0Bytes), ri.Header)
+	for ifdIndex := 1; nextIFDOffset != 0 && !visitedOffsets[nextIFDOffset] && nextIFDOffset < uint64(size); ifdIndex++ {
+		visitedOffsets[nextIFDOffset] = true
+		logging.Debug(fmt.Sprintf("\nParsing IFD%d:", ifdIndex))
+		ifdBytes, err := readIFDBytes(reader, nextIFDOffset, ri.Header)
+		if err != nil {
+			return err
+		}
+		ri.Ifds = append(ri.Ifds, parseIFDBytes(reader, ifdBytes, ri.Header))
+		nextIFDOffset = readNextIFDOffset(reader, nextIFDOffset, len(ifdBytes), ri.Header)
+	}
+
+	//the EXIF IFD holds the capture settings and MakerNote, only the IFDs above are checked for it so a
+	//malformed file can't point it at itself
+	for i := range ri.Ifds {
+		if ri.Ifds[i].ExifOffset != 0 && ri.Ifds[i].ExifOffset < uint64(size) {
+			logging.Debug(fmt.Sprintf("\nParsing EXIF IFD of IFD%d:", i))
+			exifIFDBytes, err := readIFDBytes(reader, ri.Ifds[i].ExifOffset, ri.Header)
+			if err != nil {
+				return err
+			}
+			exifIFD := parseIFDBytes(reader, exifIFDBytes, ri.Header)
+			ri.Ifds[i].ExifIFD = &exifIFD
+		}
+	}
+	ri.readMakerNoteSerialNumber(reader)
+	return nil
+}
+
+//GetBodySerial returns the camera body's serial number, from EXIF or failing that the MakerNote, or an empty
+//string if the image has neither
+func (ri *RawImage) GetBodySerial() string {
+	for _, ifd := range ri.Ifds {
+		for _, serialIFD := range []*TiffIFD{&ifd, ifd.ExifIFD} {
+			if serialIFD != nil && len(trimSerialNumber(serialIFD.BodySerialNumber)) > 0 {
+				return trimSerialNumber(serialIFD.BodySerialNumber)
+			}
+		}
+	}
+	if makerNoteIFD := ri.GetMakerNoteIFD(); makerNoteIFD != nil {
+		return trimSerialNumber(makerNoteIFD.MakerNoteSerialNumber)
+	}
+	return ""
+}
+
+//GetICCProfile returns the ICC color profile embedded in the first IFD which has one, and false if none do. Load
+//must have been called first
+func (ri *RawImage) GetICCProfile() ([]byte, bool) {
+	for _, ifd := range ri.Ifds {
+		if len(ifd.ICCProfile) > 0 {
+			return ifd.ICCProfile, true
+		}
+	}
+	return nil, false
+}
+
+//GetLensSerial returns the lens's serial number, or an empty string if the image doesn't have one
+func (ri *RawImage) GetLensSerial() string {
+	for _, ifd := range ri.Ifds {
+		for _, serialIFD := range []*TiffIFD{&ifd, ifd.ExifIFD} {
+			if serialIFD != nil && len(trimSerialNumber(serialIFD.LensSerialNumber)) > 0 {
+				return trimSerialNumber(serialIFD.LensSerialNumber)
+			}
+		}
+	}
+	return ""
+}
+
+//GetDPI returns the resolution of the image in dots per inch from its first IFD, or 0 if it doesn't have one
+func (ri *RawImage) GetDPI() int {
+	if len(ri.Ifds) == 0 {
+		return 0
+	}
+	resolution := ri.Ifds[0].XResolution.Float64()
+	switch ri.Ifds[0].ResolutionUnit {
+	case resolutionUnitNone:
+		return 0
+	case resolutionUnitCentimeter:
+		resolution *= 2.54
+	}
+	return int(resolution + 0.5)
+}
+
+func trimSerialNumber(serialNumber []byte) string {
+	return string(bytes.Trim(serialNumber, "\x00 "))
+}
+
+//GetMakerNoteIFD returns the EXIF IFD holding the camera's MakerNote, or nil if the image has none
+func (ri *RawImage) GetMakerNoteIFD() *TiffIFD {
+	for _, ifd := range ri.Ifds {
+		if ifd.ExifIFD != nil && ifd.ExifIFD.MakerNoteLength > 0 {
+			return ifd.ExifIFD
+		}
 	}
 	return nil
 }
 
+//GetLargestPreviewIFD returns the IFD with the largest embedded JPEG preview, or nil if the image has none
+func (ri *RawImage) GetLargestPreviewIFD() *TiffIFD {
+	var largestPreviewIFD *TiffIFD
+	for i := range ri.Ifds {
+		if ri.Ifds[i].JpegFromRawLength == 0 {
+			continue
+		}
+		if largestPreviewIFD == nil || ri.Ifds[i].JpegFromRawLength > largestPreviewIFD.JpegFromRawLength {
+			largestPreviewIFD = &ri.Ifds[i]
+		}
+	}
+	return largestPreviewIFD
+}
+
+//decodePreview decodes the JPEG preview referenced by the IFD
+func (ri *RawImage) decodePreview(previewIFD *TiffIFD) (image.Image, error) {
+	//decode the embedded preview straight from the file rather than buffering it all first
+	previewReader := io.NewSectionReader(ri.File, int64(previewIFD.JpegFromRawStart), int64(previewIFD.JpegFromRawLength))
+	return jpeg.Decode(bufio.NewReader(previewReader))
+}
+
 type NefImage struct {
 	RawImage
 }
@@ -764,71 +1069,165 @@ func (ni *NefImage) Load() error {
 	return ni.RawImage.Load()
 }
 
-func (ni *NefImage) ConvertToJPEG(outputPath string) error {
-	var conversionError error
-	err := ni.Load()
-	defer ni.RawImage.File.Close()
-	if err != nil {
-		conversionError = err
-	} else {
-		if len(ni.RawImage.Ifds) >= 2 {
-			jpgFile, err := os.Create(outputPath)
-			defer jpgFile.Close()
-			if err != nil {
-				logging.Error(err.Error())
-				conversionError = err
-				return conversionError
-			}
-			// subIFD1 := ri.ifds[2]
-			ni.RawImage.Data = make([]byte, ni.RawImage.Ifds[1].JpegFromRawLength)
-			ni.RawImage.File.ReadAt(ni.RawImage.Data, int64(ni.RawImage.Ifds[1].JpegFromRawStart))
-
-			bReader := bytes.NewReader(ni.RawImage.Data)
-			img, err := jpeg.Decode(bReader)
+//Decode loads the image and decodes its embedded full size JPEG preview, so it can be encoded to as many
+//output formats as needed without decoding it again
+func (ni *NefImage) Decode() (image.Image, error) {
+	if err := ni.Load(); err != nil {
+		return nil, err
+	}
+	if len(ni.RawImage.Ifds) >= 2 && ni.RawImage.Ifds[1].JpegFromRawLength > 0 {
+		return ni.decodePreview(&ni.RawImage.Ifds[1])
+	}
 
-			if err != nil {
-				logging.Error(err.Error())
-				conversionError = err
-			}
-			conversionError = jpeg.Encode(jpgFile, img, nil)
+	//without a preview the CFA data itself has to be decoded
+	rawDataIFD := ni.GetRawDataIFD()
+	if rawDataIFD == nil {
+		return nil, errors.New("No embedded preview or raw image data found")
+	}
+	switch rawDataIFD.CompressionFlag {
+	case compressionNone:
+		fileStats, err := ni.RawImage.File.Stat()
+		if err != nil {
+			return nil, err
 		}
-		conversionError = nil
+		//sized, so the strip can be checked to fit in the file before anything's allocated for it
+		return decodeUncompressedCFA(io.NewSectionReader(ni.RawImage.File, 0, fileStats.Size()), *rawDataIFD, ni.RawImage.Header.EndianOrder)
+	case compressionNikonNEF:
+		return nil, errors.New("Nikon compressed NEF raw data not supported, only uncompressed NEFs can be decoded without a preview")
 	}
-	return conversionError
+	return nil, fmt.Errorf("Raw data compression %d not supported", rawDataIFD.CompressionFlag)
+}
+
+func (ni *NefImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := ni.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (ni *NefImage) WritePNG(w io.Writer) error {
+	decodedImage, err := ni.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (ni *NefImage) ConvertToJPEG(outputPath string) error {
+	defer ni.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return ni.WriteJPEG(w, jpeg.DefaultQuality)
+	})
 }
 
-//experimental, work in progress DO NOT USE
 func (ni *NefImage) ConvertToPNG(outputPath string) error {
-	var conversionError error
-	err := ni.Load()
 	defer ni.RawImage.File.Close()
+	return writeImageFile(outputPath, ni.WritePNG)
+}
+
+//WriteJPEG encodes the image as a JPEG to the output path
+func WriteJPEG(decodedImage image.Image, outputPath string) error {
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return jpeg.Encode(w, decodedImage, nil)
+	})
+}
+
+//WritePNG encodes the image as a PNG to the output path
+func WritePNG(decodedImage image.Image, outputPath string) error {
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return png.Encode(w, decodedImage)
+	})
+}
+
+//writeImageFile creates the output path and encodes to it, removing the file again if that fails, so a partly
+//written image isn't left behind
+func writeImageFile(outputPath string, encode func(w io.Writer) error) error {
+	outputFile, err := os.Create(outputPath)
 	if err != nil {
-		conversionError = err
-	} else {
-		if len(ni.RawImage.Ifds) >= 2 {
-			pngFile, err := os.Create(outputPath)
-			defer pngFile.Close()
-			if err != nil {
-				logging.Error(err.Error())
-				conversionError = err
-				return conversionError
-			}
-			// subIFD1 := ri.ifds[2]
-			ni.RawImage.Data = make([]byte, ni.RawImage.Ifds[1].JpegFromRawLength)
-			ni.RawImage.File.ReadAt(ni.RawImage.Data, int64(ni.RawImage.Ifds[1].JpegFromRawStart))
+		return err
+	}
+	bufferedWriter := bufio.NewWriter(outputFile)
+	err = encode(bufferedWriter)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+	}
+	return err
+}
+
+//rewriteImageFile reads the whole of the image file at the output path, and writes it again as the bytes returned
+//by change
+func rewriteImageFile(outputPath string, change func(data []byte) ([]byte, error)) error {
+	data, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		return err
+	}
+	if data, err = change(data); err != nil {
+		return err
+	}
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
 
-			bReader := bytes.NewReader(ni.RawImage.Data)
-			img, err := jpeg.Decode(bReader)
+//NrwImage is a Nikon Coolpix raw, laid out like a NEF but with its JPEG preview in a different IFD depending on
+//the camera, so the largest preview found in any IFD is used
+type NrwImage struct {
+	RawImage
+}
 
-			if err != nil {
-				logging.Error(err.Error())
-				conversionError = err
-			}
-			conversionError = png.Encode(pngFile, img)
-		}
-		conversionError = nil
+func (ni *NrwImage) GetRawImage() RawImage {
+	return ni.RawImage
+}
+
+func (ni *NrwImage) Load() error {
+	return ni.RawImage.Load()
+}
+
+func (ni *NrwImage) Decode() (image.Image, error) {
+	if err := ni.Load(); err != nil {
+		return nil, err
 	}
-	return conversionError
+	previewIFD := ni.GetLargestPreviewIFD()
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	return ni.decodePreview(previewIFD)
+}
+
+func (ni *NrwImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := ni.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (ni *NrwImage) WritePNG(w io.Writer) error {
+	decodedImage, err := ni.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (ni *NrwImage) ConvertToJPEG(outputPath string) error {
+	defer ni.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return ni.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (ni *NrwImage) ConvertToPNG(outputPath string) error {
+	defer ni.RawImage.File.Close()
+	return writeImageFile(outputPath, ni.WritePNG)
 }
 
 type Cr2Image struct {
@@ -843,317 +1242,567 @@ func (ci *Cr2Image) Load() error {
 	return ci.RawImage.Load()
 }
 
+func (ci *Cr2Image) Decode() (image.Image, error) {
+	return nil, errors.New("CR2 decoding not supported")
+}
+
+func (ci *Cr2Image) WriteJPEG(w io.Writer, quality int) error {
+	_, err := ci.Decode()
+	return err
+}
+
+func (ci *Cr2Image) WritePNG(w io.Writer) error {
+	_, err := ci.Decode()
+	return err
+}
+
 func (ci *Cr2Image) ConvertToJPEG(outputPath string) error {
 	return nil
 }
 
 func (ci *Cr2Image) ConvertToPNG(outputPath string) error { return nil }
 
-func parseIFDBytes(file *os.File, ifdData []byte, tiffHeaderData TiffHeader) TiffIFD {
-	ifd := &TiffIFD{}
-	//for each byte in the IFD0
-	for i := range ifdData {
-		if math.Mod(float64(i), float64(12)) == 0 {
-			//get the tag value, it's two bytes long, so get byte we're on and second byte from offset
-			tagAsInt := utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder)
-			dataFormatAsInt := utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder)
-			numOfElementsAsInt := utils.ConvertBytesToUInt32(ifdData[i+4], ifdData[i+5], ifdData[i+6], ifdData[i+7], tiffHeaderData.EndianOrder)
-			dataValueOrDataOffsetAsInt := utils.ConvertBytesToUInt32(ifdData[i+8], ifdData[i+9], ifdData[i+10], ifdData[i+11], tiffHeaderData.EndianOrder)
-
-			switch tagAsInt {
-			case subfileTypeTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					if numOfElementsAsInt == 1 {
-						firstBitFlag := ifdData[i+11]  //if first bit is 1 then its reduced resolution
-						secondBitFlag := ifdData[i+10] //if second bit is 1 then its a single page image of a multi-page image
-						thirdBitFlag := ifdData[i+9]   //if the third bit is 1 then image defines transparency mask for another image in tiff file. The Photometric interpritation value must be 4
-						fourthBitFlag := ifdData[i+8]  //if the forth bit is 1 then MRC imaging model
-
-						if firstBitFlag == 1 {
-							logging.Debug(fmt.Sprintf("Image type is -> Reduced resolution image"))
-							ifd.SubFileType = subfileTypeReducedResolutionImage
-						} else if secondBitFlag == 1 {
-							logging.Debug(fmt.Sprintf("Image type is -> Single page of multipage image"))
-							ifd.SubFileType = subfileTypeSinglePageOfMultipageImage
-						} else if thirdBitFlag == 1 {
-							logging.Debug(fmt.Sprintf("Image type is -> Transparency mask image"))
-							ifd.SubFileType = subfileTypeTransparencyMaskImage
-						} else if fourthBitFlag == 1 {
-							logging.Debug(fmt.Sprintf("Image type is -> MRC imaging model?"))
-							ifd.SubFileType = subfileTypeMRCImagingModel
-						}
-					}
-				}
-			case imageWidthTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Image width -> %d", dataValueOrDataOffsetAsInt))
-					ifd.ImageWidth = dataValueOrDataOffsetAsInt
-				}
-			case imageHeightTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Image height -> %d", dataValueOrDataOffsetAsInt))
-					ifd.ImageHeight = dataValueOrDataOffsetAsInt
-				}
-			case imageFullWidthTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Image full width -> %d", dataValueOrDataOffsetAsInt))
-					ifd.ImageFullWidth = dataValueOrDataOffsetAsInt
-				}
-			case imageFullHeightTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Image full height -> %d", dataValueOrDataOffsetAsInt))
-					ifd.ImageFullHeight = dataValueOrDataOffsetAsInt
-				}
-			case bitsPerSampleTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					bitsPerSampleData := make([]byte, numOfElementsAsInt)
-					file.Read(bitsPerSampleData)
-					logging.Debug(fmt.Sprintf("Bits per sample -> %d", bitsPerSampleData))
-					ifd.BitsPerSample = bitsPerSampleData
-				}
-			case compressionTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					imageCompressionValue := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					if imageCompressionValue == compressionNone {
-						logging.Debug(fmt.Sprintf("Compression -> None"))
-					}
-					ifd.CompressionFlag = imageCompressionValue
-				}
-			case photometricInterpretationTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					photometricInterpretationValue := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					if photometricInterpretationValue == photometricInterpretationRGB {
-						logging.Debug(fmt.Sprintf("Photometric interpretation -> RGB"))
+func parseIFDBytes(reader io.ReaderAt, ifdData []byte, tiffHeaderData TiffHeader) TiffIFD {
+	ifd := &TiffIFD{Entries: readIFDEntries(reader, ifdData, tiffHeaderData)}
+	entrySize := tiffHeaderData.ifdEntrySize()
+	//for each entry in the IFD
+	for i := 0; i+entrySize <= len(ifdData); i += entrySize {
+		//get the tag value, it's two bytes long, so get byte we're on and second byte from offset
+		tagAsInt := utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder)
+		dataFormatAsInt := utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder)
+		numOfElementsAsInt, valueField := splitIFDEntry(ifdData[i:i+entrySize], tiffHeaderData)
+		//BYTE, SHORT, LONG and LONG8 values decoded by their declared type
+		unsignedValue, unsignedValueErr := readUnsignedValue(valueField, uint8(dataFormatAsInt), tiffHeaderData.EndianOrder)
+		//offsets take up the whole value field, so are 64-bit in BigTIFF
+		dataOffset := readOffset(valueField, tiffHeaderData.EndianOrder)
+
+		switch tagAsInt {
+		case subfileTypeTag:
+			if uint8(dataFormatAsInt) == unsignedLongType {
+				if numOfElementsAsInt == 1 {
+					firstBitFlag := unsignedValue & 1       //if first bit is 1 then its reduced resolution
+					secondBitFlag := unsignedValue >> 1 & 1 //if second bit is 1 then its a single page image of a multi-page image
+					thirdBitFlag := unsignedValue >> 2 & 1  //if the third bit is 1 then image defines transparency mask for another image in tiff file. The Photometric interpritation value must be 4
+					fourthBitFlag := unsignedValue >> 3 & 1 //if the forth bit is 1 then MRC imaging model
+
+					if firstBitFlag == 1 {
+						logging.Debug(fmt.Sprintf("Image type is -> Reduced resolution image"))
+						ifd.SubFileType = subfileTypeReducedResolutionImage
+					} else if secondBitFlag == 1 {
+						logging.Debug(fmt.Sprintf("Image type is -> Single page of multipage image"))
+						ifd.SubFileType = subfileTypeSinglePageOfMultipageImage
+					} else if thirdBitFlag == 1 {
+						logging.Debug(fmt.Sprintf("Image type is -> Transparency mask image"))
+						ifd.SubFileType = subfileTypeTransparencyMaskImage
+					} else if fourthBitFlag == 1 {
+						logging.Debug(fmt.Sprintf("Image type is -> MRC imaging model?"))
+						ifd.SubFileType = subfileTypeMRCImagingModel
 					}
-					ifd.PhotometricInterpretationFlag = photometricInterpretationValue
-				}
-			case makeTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					imageMakeTagData := make([]byte, numOfElementsAsInt)
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					file.Read(imageMakeTagData)
-					logging.Debug(fmt.Sprintf("Camera make -> %s", imageMakeTagData))
-					ifd.ImageMakeTag = imageMakeTagData
-				}
-			case modelTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					imageModelTagData := make([]byte, numOfElementsAsInt)
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					file.Read(imageModelTagData)
-					logging.Debug(fmt.Sprintf("Camera model -> %s", imageModelTagData))
-					ifd.ImageModelTag = imageModelTagData
-				}
-			case stripOffsetsTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Strip offsets -> %d", dataValueOrDataOffsetAsInt))
-					ifd.StripOffsets = dataValueOrDataOffsetAsInt
 				}
-			case orientationTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					orientationTagData := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("Orientation flag -> %d", orientationTagData))
-					ifd.OrientationFlag = orientationTagData
-				}
-			case samplesPerPixelTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					samplesPerPixelTagData := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("Samples per pixel flag -> %d", samplesPerPixelTagData))
-					ifd.SamplesPerPixel = samplesPerPixelTagData
-				}
-			case rowsPerStripTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Rows per strip -> %d", dataValueOrDataOffsetAsInt))
-					ifd.RowsPerStrip = dataValueOrDataOffsetAsInt
-				}
-			case stripByteCountsTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("Strip byte counts -> %d", dataValueOrDataOffsetAsInt))
-					ifd.StripByteCounts = dataValueOrDataOffsetAsInt
-				}
-			case xResolutionTag:
-				if uint8(dataFormatAsInt) == unsignedRationalType {
-					logging.Debug(fmt.Sprintf("X Resolution -> %d", dataValueOrDataOffsetAsInt))
-					ifd.XResolution = dataValueOrDataOffsetAsInt
-				}
-			case yResolutionTag:
-				if uint8(dataFormatAsInt) == unsignedRationalType {
-					logging.Debug(fmt.Sprintf("Y Resolution -> %d", dataValueOrDataOffsetAsInt))
-					ifd.YResolution = dataValueOrDataOffsetAsInt
-				}
-			case planarConfigurationTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					planarConfigurationTagData := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("Planar configuration -> %d", planarConfigurationTagData))
-					ifd.PlanarConfiguration = planarConfigurationTagData
-				}
-			case resolutionUnitTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					resolutionUnitTagData := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("Resolution unit -> %d", resolutionUnitTagData))
-					ifd.ResolutionUnit = resolutionUnitTagData
-				}
-			case softwareTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					softwareTextData := make([]byte, numOfElementsAsInt)
-					file.Read(softwareTextData)
-					logging.Debug(fmt.Sprintf("Software -> %s", softwareTextData))
-					ifd.SoftwareTextData = softwareTextData
-				}
-			case modifyDateTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					modifyDateTextData := make([]byte, numOfElementsAsInt)
-					file.Read(modifyDateTextData)
-					logging.Debug(fmt.Sprintf("Date/Time (is editable) -> %s", modifyDateTextData))
-					ifd.DateTimeText = modifyDateTextData
+			}
+		case imageWidthTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Image width -> %d", unsignedValue))
+				ifd.ImageWidth = uint32(unsignedValue)
+			}
+		case imageHeightTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Image height -> %d", unsignedValue))
+				ifd.ImageHeight = uint32(unsignedValue)
+			}
+		case imageFullWidthTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Image full width -> %d", unsignedValue))
+				ifd.ImageFullWidth = uint32(unsignedValue)
+			}
+		case imageFullHeightTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Image full height -> %d", unsignedValue))
+				ifd.ImageFullHeight = uint32(unsignedValue)
+			}
+		case bitsPerSampleTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				//each sample's bit count is a short, but always small enough for a byte
+				bitsPerSampleShorts := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				bitsPerSampleData := make([]byte, 0, len(bitsPerSampleShorts)/2)
+				for start := 0; start+2 <= len(bitsPerSampleShorts); start += 2 {
+					bitsPerSampleData = append(bitsPerSampleData, byte(utils.ConvertBytesSliceToUInt16(bitsPerSampleShorts[start:start+2], tiffHeaderData.EndianOrder)))
 				}
-			case artistTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					artistTextData := make([]byte, numOfElementsAsInt)
-					file.Read(artistTextData)
-					logging.Debug(fmt.Sprintf("Artist: %s", artistTextData))
+				logging.Debug(fmt.Sprintf("Bits per sample -> %d", bitsPerSampleData))
+				ifd.BitsPerSample = bitsPerSampleData
+			}
+		case compressionTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				imageCompressionValue := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Compression -> %s", CompressionName(imageCompressionValue)))
+				ifd.CompressionFlag = imageCompressionValue
+			}
+		case photometricInterpretationTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				photometricInterpretationValue := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				if photometricInterpretationValue == photometricInterpretationRGB {
+					logging.Debug(fmt.Sprintf("Photometric interpretation -> RGB"))
 				}
-			case subIFDA100DataOffsetTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					subIfdDataOffsetData := make([]byte, 4*numOfElementsAsInt)
-					file.Read(subIfdDataOffsetData)
-					ifd.SubIFDOffsets = make([]uint32, 0)
-					var i uint32
-					start := 0
-					end := 4
-					for ; i < numOfElementsAsInt; i++ {
-						ifd.SubIFDOffsets = append(ifd.SubIFDOffsets, utils.ConvertBytesSliceToUInt32(subIfdDataOffsetData[start:end], tiffHeaderData.EndianOrder))
-						start += 4
-						end += 4
-					}
-					logging.Debug(fmt.Sprintf("SubIFDOffsets -> %d", ifd.SubIFDOffsets))
+				ifd.PhotometricInterpretationFlag = photometricInterpretationValue
+			}
+		case makeTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				imageMakeTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Camera make -> %s", imageMakeTagData))
+				ifd.ImageMakeTag = imageMakeTagData
+			}
+		case modelTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				imageModelTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Camera model -> %s", imageModelTagData))
+				ifd.ImageModelTag = imageModelTagData
+			}
+		case stripOffsetsTag:
+			if isOffsetType(uint8(dataFormatAsInt)) {
+				stripOffsets := readOffset(valueField[:dataTypeSize(uint8(dataFormatAsInt))], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Strip offsets -> %d", stripOffsets))
+				ifd.StripOffsets = stripOffsets
+			}
+		case orientationTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				orientationTagData := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Orientation flag -> %d", orientationTagData))
+				ifd.OrientationFlag = orientationTagData
+			}
+		case samplesPerPixelTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				samplesPerPixelTagData := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Samples per pixel flag -> %d", samplesPerPixelTagData))
+				ifd.SamplesPerPixel = samplesPerPixelTagData
+			}
+		case rowsPerStripTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Rows per strip -> %d", unsignedValue))
+				ifd.RowsPerStrip = uint32(unsignedValue)
+			}
+		case stripByteCountsTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("Strip byte counts -> %d", unsignedValue))
+				ifd.StripByteCounts = uint32(unsignedValue)
+			}
+		case xResolutionTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				ifd.XResolution = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), 1, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("X Resolution -> %v", ifd.XResolution.Float64()))
+			}
+		case yResolutionTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				ifd.YResolution = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), 1, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("Y Resolution -> %v", ifd.YResolution.Float64()))
+			}
+		case planarConfigurationTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				planarConfigurationTagData := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Planar configuration -> %d", planarConfigurationTagData))
+				ifd.PlanarConfiguration = planarConfigurationTagData
+			}
+		case resolutionUnitTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				resolutionUnitTagData := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("Resolution unit -> %d", resolutionUnitTagData))
+				ifd.ResolutionUnit = resolutionUnitTagData
+			}
+		case softwareTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				softwareTextData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Software -> %s", softwareTextData))
+				ifd.SoftwareTextData = softwareTextData
+			}
+		case modifyDateTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				modifyDateTextData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Date/Time (is editable) -> %s", modifyDateTextData))
+				ifd.DateTimeText = modifyDateTextData
+			}
+		case artistTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				artistTextData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Artist: %s", artistTextData))
+			}
+		case subIFDA100DataOffsetTag:
+			if isOffsetType(uint8(dataFormatAsInt)) {
+				subIfdDataOffsetData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				offsetSize := dataTypeSize(uint8(dataFormatAsInt))
+				ifd.SubIFDOffsets = make([]uint64, 0)
+				for start := 0; start+offsetSize <= len(subIfdDataOffsetData); start += offsetSize {
+					ifd.SubIFDOffsets = append(ifd.SubIFDOffsets, readOffset(subIfdDataOffsetData[start:start+offsetSize], tiffHeaderData.EndianOrder))
 				}
-			case referenceBlackWhiteTag:
-				if uint8(dataFormatAsInt) == unsignedRationalType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					referenceBlackWhiteTagData := make([]byte, 8*numOfElementsAsInt)
-					file.Read(referenceBlackWhiteTagData)
+				logging.Debug(fmt.Sprintf("SubIFDOffsets -> %d", ifd.SubIFDOffsets))
+			}
+		case referenceBlackWhiteTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				referenceBlackWhiteTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				//a count of 0, or data past the end of the file, leaves nothing to decode
+				if len(referenceBlackWhiteTagData) >= 8 {
 					//THIS IS ALL WRONG NEED TO WORK IT OUT,
-					referenceBlackWhiteTagInt := utils.ConvertBytesToUInt64(referenceBlackWhiteTagData[0], referenceBlackWhiteTagData[1],
-						referenceBlackWhiteTagData[2], referenceBlackWhiteTagData[3],
-						referenceBlackWhiteTagData[4], referenceBlackWhiteTagData[5],
-						referenceBlackWhiteTagData[6], referenceBlackWhiteTagData[7], tiffHeaderData.EndianOrder)
+					referenceBlackWhiteTagInt := utils.ConvertBytesSliceToUInt64(referenceBlackWhiteTagData[:8], tiffHeaderData.EndianOrder)
 					logging.Debug(fmt.Sprintf("Reference black white tag -> %d", referenceBlackWhiteTagInt))
 					ifd.ReferenceBlackWhite = referenceBlackWhiteTagInt
 				}
-			case exifOffsetTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("EXIF offset -> %d", dataValueOrDataOffsetAsInt))
-					ifd.ExifOffset = dataValueOrDataOffsetAsInt
-				}
-			case gpsInfoTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					gifdData := readIFDBytes(file, dataValueOrDataOffsetAsInt, tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("GPS SubIFD pointer -> %d", dataValueOrDataOffsetAsInt))
-					ifd.GpsIFD = parseGPSIFDBytes(file, gifdData, tiffHeaderData)
-				}
-			case dateTimeOriginalTag:
-				if uint8(dataFormatAsInt) == asciiStringsType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					dateTimeOriginalTagData := make([]byte, numOfElementsAsInt)
-					file.Read(dateTimeOriginalTagData)
-					logging.Debug(fmt.Sprintf("Date/Time original (standard says cannot be edited) -> %s", dateTimeOriginalTagData))
-					ifd.DateTimeOriginalText = dateTimeOriginalTagData
-				}
-			case tiffEPStandardIDTag:
-				if uint8(dataFormatAsInt) == unsignedByteType {
-					file.Seek(int64(dataValueOrDataOffsetAsInt), os.SEEK_SET)
-					tiffEPStandardIDTagData := make([]byte, numOfElementsAsInt)
-					file.Read(tiffEPStandardIDTagData)
-					logging.Debug(fmt.Sprintf("Tiff EP Standard tag: %d", tiffEPStandardIDTagData))
-					ifd.TiffEPStandardID = tiffEPStandardIDTagData
-				}
-			case jpegFromRawStartTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("JPEG raw start: %d", dataValueOrDataOffsetAsInt))
-					ifd.JpegFromRawStart = dataValueOrDataOffsetAsInt
-				}
-			case jpegFromRawLengthTag:
-				if uint8(dataFormatAsInt) == unsignedLongType {
-					logging.Debug(fmt.Sprintf("JPEG raw length: %d", dataValueOrDataOffsetAsInt))
-					ifd.JpegFromRawLength = dataValueOrDataOffsetAsInt
-				}
-			case yCbCrPositioningTag:
-				if uint8(dataFormatAsInt) == unsignedShortType {
-					yCbCrPositioningTagData := utils.ConvertBytesToUInt16(ifdData[i+8], ifdData[i+9], tiffHeaderData.EndianOrder)
-					logging.Debug(fmt.Sprintf("YCbCr Positioning: %d", yCbCrPositioningTagData))
-					ifd.YCbCrPositioning = yCbCrPositioningTagData
+			}
+		case exifOffsetTag:
+			if isOffsetType(uint8(dataFormatAsInt)) {
+				exifOffset := readOffset(valueField[:dataTypeSize(uint8(dataFormatAsInt))], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("EXIF offset -> %d", exifOffset))
+				ifd.ExifOffset = exifOffset
+			}
+		case iccProfileTag:
+			//the profile's length is checked so a corrupt count can't allocate more than a profile could need
+			if (uint8(dataFormatAsInt) == undefinedType || uint8(dataFormatAsInt) == unsignedByteType) && numOfElementsAsInt <= maxICCProfileLength {
+				ifd.ICCProfile = readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("ICC profile -> %d bytes", len(ifd.ICCProfile)))
+			}
+		case exposureTimeTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				ifd.ExposureTime = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), 1, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("Exposure time -> %s", ifd.ExposureTime))
+			}
+		case fNumberTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				ifd.FNumber = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), 1, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("F number -> %v", ifd.FNumber.Float64()))
+			}
+		case isoTag:
+			//only the first of the ISO speeds is kept, cameras don't write more than one
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("ISO -> %d", unsignedValue))
+				ifd.ISO = uint16(unsignedValue)
+			}
+		case focalLengthTag:
+			if uint8(dataFormatAsInt) == unsignedRationalType {
+				ifd.FocalLength = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), 1, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("Focal length -> %v mm", ifd.FocalLength.Float64()))
+			}
+		case lensModelTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				lensModelTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Lens model -> %s", lensModelTagData))
+				ifd.LensModelTag = lensModelTagData
+			}
+		case serialNumberTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				bodySerialNumberData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Body serial number -> %s", bodySerialNumberData))
+				ifd.BodySerialNumber = bodySerialNumberData
+			}
+		case lensSerialNumberTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				lensSerialNumberData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Lens serial number -> %s", lensSerialNumberData))
+				ifd.LensSerialNumber = lensSerialNumberData
+			}
+		case makerNoteUknownTag:
+			if uint8(dataFormatAsInt) == undefinedType && numOfElementsAsInt > uint64(len(valueField)) && numOfElementsAsInt <= math.MaxUint32 {
+				logging.Debug(fmt.Sprintf("MakerNote offset -> %d length -> %d", dataOffset, numOfElementsAsInt))
+				ifd.MakerNoteOffset = dataOffset
+				ifd.MakerNoteLength = uint32(numOfElementsAsInt)
+			}
+		case gpsInfoTag:
+			if isOffsetType(uint8(dataFormatAsInt)) {
+				gpsOffset := readOffset(valueField[:dataTypeSize(uint8(dataFormatAsInt))], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("GPS SubIFD pointer -> %d", gpsOffset))
+				//a GPS IFD which doesn't fit in the file is left out, the rest of the image is still usable
+				if gifdData, err := readIFDBytes(reader, gpsOffset, tiffHeaderData); err == nil {
+					ifd.GpsIFD = parseGPSIFDBytes(reader, gifdData, tiffHeaderData)
+				} else {
+					logging.Debug(err.Error())
 				}
 			}
+		case dateTimeOriginalTag:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				dateTimeOriginalTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Date/Time original (standard says cannot be edited) -> %s", dateTimeOriginalTagData))
+				ifd.DateTimeOriginalText = dateTimeOriginalTagData
+			}
+		case tiffEPStandardIDTag:
+			if uint8(dataFormatAsInt) == unsignedByteType {
+				tiffEPStandardIDTagData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("Tiff EP Standard tag: %d", tiffEPStandardIDTagData))
+				ifd.TiffEPStandardID = tiffEPStandardIDTagData
+			}
+		case cfaPattern2Tag:
+			if uint8(dataFormatAsInt) == unsignedByteType {
+				cfaPatternData := readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData)
+				logging.Debug(fmt.Sprintf("CFA pattern -> %d", cfaPatternData))
+				ifd.CFAPattern = cfaPatternData
+			}
+		case jpegFromRawStartTag:
+			if isOffsetType(uint8(dataFormatAsInt)) {
+				jpegFromRawStart := readOffset(valueField[:dataTypeSize(uint8(dataFormatAsInt))], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("JPEG raw start: %d", jpegFromRawStart))
+				ifd.JpegFromRawStart = jpegFromRawStart
+			}
+		case jpegFromRawLengthTag:
+			if unsignedValueErr == nil {
+				logging.Debug(fmt.Sprintf("JPEG raw length: %d", unsignedValue))
+				ifd.JpegFromRawLength = uint32(unsignedValue)
+			}
+		case yCbCrPositioningTag:
+			if uint8(dataFormatAsInt) == unsignedShortType {
+				yCbCrPositioningTagData := utils.ConvertBytesToUInt16(valueField[0], valueField[1], tiffHeaderData.EndianOrder)
+				logging.Debug(fmt.Sprintf("YCbCr Positioning: %d", yCbCrPositioningTagData))
+				ifd.YCbCrPositioning = yCbCrPositioningTagData
+			}
 		}
 	}
 	return *ifd
 }
 
-func parseGPSIFDBytes(file *os.File, ifdData []byte, tiffHeaderData TiffHeader) *GpsIFD {
-	gifd := &GpsIFD{}
-	for i := range ifdData {
-		if math.Mod(float64(i), float64(12)) == 0 {
-			//get the tag value, it's two bytes long, so get byte we're on and second byte from offset
-			tagAsInt := utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder)
-			dataFormatAsInt := utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder)
-			numOfElementsAsInt := utils.ConvertBytesToUInt32(ifdData[i+4], ifdData[i+5], ifdData[i+6], ifdData[i+7], tiffHeaderData.EndianOrder)
-			// dataValueOrDataOffsetAsInt := utils.ConvertBytesToUInt32(ifdData[i+8], ifdData[i+9], ifdData[i+10], ifdData[i+11], tiffHeaderData.endianOrder)
-
-			switch tagAsInt {
-			case GPSVersionID:
-				if uint8(dataFormatAsInt) == unsignedByteType {
-					if numOfElementsAsInt == 4 {
-						var gpsVersionData []uint8
-						if tiffHeaderData.EndianOrder == utils.BigEndian {
-							gpsVersionData = []uint8{uint8(ifdData[i+8]), uint8(ifdData[i+9]), uint8(ifdData[i+10]), uint8(ifdData[i+11])}
-						} else {
-							if tiffHeaderData.EndianOrder == utils.LittleEndian {
-								gpsVersionData = []uint8{uint8(ifdData[i+11]), uint8(ifdData[i+10]), uint8(ifdData[i+9]), uint8(ifdData[i+8])}
-							}
+func parseGPSIFDBytes(reader io.ReaderAt, ifdData []byte, tiffHeaderData TiffHeader) *GpsIFD {
+	gifd := &GpsIFD{Entries: readIFDEntries(reader, ifdData, tiffHeaderData)}
+	entrySize := tiffHeaderData.ifdEntrySize()
+	for i := 0; i+entrySize <= len(ifdData); i += entrySize {
+		//get the tag value, it's two bytes long, so get byte we're on and second byte from offset
+		tagAsInt := utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder)
+		dataFormatAsInt := utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder)
+		numOfElementsAsInt, valueField := splitIFDEntry(ifdData[i:i+entrySize], tiffHeaderData)
+
+		switch tagAsInt {
+		case GPSVersionID:
+			if uint8(dataFormatAsInt) == unsignedByteType {
+				if numOfElementsAsInt == 4 {
+					var gpsVersionData []uint8
+					if tiffHeaderData.EndianOrder == utils.BigEndian {
+						gpsVersionData = []uint8{uint8(valueField[0]), uint8(valueField[1]), uint8(valueField[2]), uint8(valueField[3])}
+					} else {
+						if tiffHeaderData.EndianOrder == utils.LittleEndian {
+							gpsVersionData = []uint8{uint8(valueField[3]), uint8(valueField[2]), uint8(valueField[1]), uint8(valueField[0])}
 						}
-						gifd.GPSVersionID = gpsVersionData
-						logging.Debug(fmt.Sprintf("GPS Version -> %d", gpsVersionData))
 					}
+					gifd.GPSVersionID = gpsVersionData
+					logging.Debug(fmt.Sprintf("GPS Version -> %d", gpsVersionData))
 				}
 			}
+		case GPSLatitudeRef:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				gifd.GPSLatitudeRef = string(bytes.Trim(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), "\x00"))
+				logging.Debug(fmt.Sprintf("GPS Latitude ref -> %s", gifd.GPSLatitudeRef))
+			}
+		case GPSLatitude:
+			if uint8(dataFormatAsInt) == unsignedRationalType && numOfElementsAsInt == 3 {
+				copy(gifd.GPSLatitude[:], readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("GPS Latitude -> %v", gifd.GPSLatitude))
+			}
+		case GPSLongitudeRef:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				gifd.GPSLongitudeRef = string(bytes.Trim(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), "\x00"))
+				logging.Debug(fmt.Sprintf("GPS Longitude ref -> %s", gifd.GPSLongitudeRef))
+			}
+		case GPSLongitude:
+			if uint8(dataFormatAsInt) == unsignedRationalType && numOfElementsAsInt == 3 {
+				copy(gifd.GPSLongitude[:], readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("GPS Longitude -> %v", gifd.GPSLongitude))
+			}
+		case GPSAltitudeRef:
+			if uint8(dataFormatAsInt) == unsignedByteType {
+				gifd.GPSAltitudeRef = valueField[0]
+				logging.Debug(fmt.Sprintf("GPS Altitude ref -> %d", gifd.GPSAltitudeRef))
+			}
+		case GPSAltitude:
+			if uint8(dataFormatAsInt) == unsignedRationalType && numOfElementsAsInt == 1 {
+				gifd.GPSAltitude = firstRational(readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("GPS Altitude -> %v", gifd.GPSAltitude))
+			}
+		case GPSTimeStamp:
+			if uint8(dataFormatAsInt) == unsignedRationalType && numOfElementsAsInt == 3 {
+				copy(gifd.GPSTimeStamp[:], readRationals(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), tiffHeaderData.EndianOrder))
+				logging.Debug(fmt.Sprintf("GPS Time stamp -> %v", gifd.GPSTimeStamp))
+			}
+		case GPSDateStamp:
+			if uint8(dataFormatAsInt) == asciiStringsType {
+				gifd.GPSDateStamp = string(bytes.Trim(readIFDEntryData(reader, valueField, uint8(dataFormatAsInt), numOfElementsAsInt, tiffHeaderData), "\x00"))
+				logging.Debug(fmt.Sprintf("GPS Date stamp -> %s", gifd.GPSDateStamp))
+			}
 		}
 	}
 	return gifd
 }
 
-func readIFDBytes(file *os.File, ifdOffset uint32, endianOrder utils.EndianOrder) []byte {
-	ifdTagCountBytes := make([]byte, 2)
-	file.Seek(int64(ifdOffset), os.SEEK_SET)
-	file.Read(ifdTagCountBytes)
+//splitIFDEntry returns the element count and value field of an IFD entry, the count is 4 bytes and the value field
+//is 4 bytes in classic TIFF, both are 8 bytes in BigTIFF
+func splitIFDEntry(entry []byte, tiffHeaderData TiffHeader) (uint64, []byte) {
+	countSize := 4
+	if tiffHeaderData.BigTiff {
+		countSize = 8
+	}
+	numOfElements, _ := utils.ConvertBytesSliceToUInt(entry[4:4+countSize], tiffHeaderData.EndianOrder)
+	return numOfElements, entry[4+countSize : 4+countSize*2]
+}
 
-	ifdTagCount := utils.ConvertBytesToUInt16(ifdTagCountBytes[0], ifdTagCountBytes[1], endianOrder)
+//readOffset converts a 4 byte (classic TIFF) or 8 byte (BigTIFF) offset value
+func readOffset(btc []byte, endianOrder utils.EndianOrder) uint64 {
+	if len(btc) != 8 {
+		btc = btc[:4]
+	}
+	offset, _ := utils.ConvertBytesSliceToUInt(btc, endianOrder)
+	return offset
+}
 
-	//each IFD tag length is 12 bytes
-	ifdData := make([]byte, ifdTagCount*12)
-	file.Seek(int64(ifdOffset+2), os.SEEK_SET)
-	file.Read(ifdData)
+//readUnsignedValue decodes the first element of an entry's value field using the width of its unsigned data type
+func readUnsignedValue(valueField []byte, dataFormat uint8, endianOrder utils.EndianOrder) (uint64, error) {
+	switch dataFormat {
+	case unsignedByteType, unsignedShortType, unsignedLongType, unsignedLong8Type:
+	default:
+		return 0, fmt.Errorf("data type %d is not an unsigned int", dataFormat)
+	}
+	size := dataTypeSize(dataFormat)
+	if size > len(valueField) {
+		return 0, fmt.Errorf("data type %d does not fit in the value field", dataFormat)
+	}
+	return utils.ConvertBytesSliceToUInt(valueField[:size], endianOrder)
+}
 
-	return ifdData
+//isOffsetType returns whether the data type can hold a file offset
+func isOffsetType(dataFormat uint8) bool {
+	return dataFormat == unsignedLongType || dataFormat == ifdType || dataFormat == unsignedLong8Type || dataFormat == ifd8Type
 }
 
-func readHeaderBytes(file *os.File) ([]byte, error) {
-	header := make([]byte, 8)
+//dataTypeSize returns the size in bytes of a single element of the given data type
+func dataTypeSize(dataFormat uint8) int {
+	switch dataFormat {
+	case unsignedByteType, asciiStringsType, signedByteType, undefinedType:
+		return 1
+	case unsignedShortType, signedShortType:
+		return 2
+	case unsignedLongType, signedLongType, singleFloatType, ifdType:
+		return 4
+	case unsignedRationalType, signedRationalType, doubleFloatType, unsignedLong8Type, signedLong8Type, ifd8Type:
+		return 8
+	}
+	return 1
+}
 
-	fileStats, err := file.Stat()
-	if err != nil {
-		return nil, err
+//readRationals converts each 8 byte pair of unsigned longs into a rational
+func readRationals(data []byte, endianOrder utils.EndianOrder) []Rational {
+	endianReader := utils.NewEndianReader(bytes.NewReader(data), endianOrder)
+	rationals := make([]Rational, 0, len(data)/8)
+	for start := 0; start+8 <= len(data); start += 8 {
+		rational, _ := endianReader.RationalAt(int64(start))
+		rationals = append(rationals, rational)
 	}
-	if fileStats.Size() <= 1024 {
+	return rationals
+}
+
+//readIFDEntryData reads all of an entry's element data, which is held within the value field itself if it fits,
+//otherwise the value field holds the offset to where the data is. Data which would run past the end of the reader
+//is read as nil, so a malformed count can't make it allocate more than the file holds
+func readIFDEntryData(reader io.ReaderAt, valueField []byte, dataFormat uint8, numOfElements uint64, tiffHeaderData TiffHeader) []byte {
+	length, ok := entryDataLength(dataFormat, numOfElements)
+	if !ok {
+		logging.Debug(fmt.Sprintf("Entry data of %d elements is too long to read", numOfElements))
+		return nil
+	}
+	if length <= uint64(len(valueField)) {
+		data := make([]byte, length)
+		copy(data, valueField)
+		return data
+	}
+	offset := readOffset(valueField, tiffHeaderData.EndianOrder)
+	if !fitsInReader(reader, offset, length) {
+		logging.Debug(fmt.Sprintf("Entry data of %d bytes at offset %d runs past the end of the file", length, offset))
+		return nil
+	}
+	data := make([]byte, length)
+	if n, err := reader.ReadAt(data, int64(offset)); err != nil && n < len(data) {
+		logging.Debug(fmt.Sprintf("Unable to read entry data at offset %d -> %v", offset, err))
+		return nil
+	}
+	return data
+}
+
+//entryDataLength returns the number of bytes taken up by the elements of the data format, or false if the count is
+//so large it overflows, which BigTIFF's 8 byte counts can be
+func entryDataLength(dataFormat uint8, numOfElements uint64) (uint64, bool) {
+	size := uint64(dataTypeSize(dataFormat))
+	if size > 0 && numOfElements > math.MaxUint64/size {
+		return 0, false
+	}
+	return size * numOfElements, true
+}
+
+func readIFDBytes(reader io.ReaderAt, ifdOffset uint64, tiffHeaderData TiffHeader) ([]byte, error) {
+	endianReader := utils.NewEndianReader(reader, tiffHeaderData.EndianOrder)
+
+	//the tag count is 2 bytes long in classic TIFF and 8 bytes in BigTIFF
+	var ifdTagCount uint64
+	var ifdTagCountSize uint64 = 2
+	if tiffHeaderData.BigTiff {
+		ifdTagCount, _ = endianReader.Uint64(int64(ifdOffset))
+		ifdTagCountSize = 8
+	} else {
+		tagCount, _ := endianReader.Uint16(int64(ifdOffset))
+		ifdTagCount = uint64(tagCount)
+	}
+
+	//each IFD tag length is 12 bytes, or 20 bytes for BigTIFF, the count is checked against what's left of the
+	//file before multiplying it up, so a huge count can't overflow
+	entrySize := uint64(tiffHeaderData.ifdEntrySize())
+	if !fitsInReader(reader, ifdOffset, ifdTagCountSize) || ifdTagCount > readerRemaining(reader, ifdOffset+ifdTagCountSize)/entrySize {
+		return nil, fmt.Errorf("IFD at offset %d has %d entries, more than fit in the file", ifdOffset, ifdTagCount)
+	}
+	ifdData := make([]byte, ifdTagCount*entrySize)
+	reader.ReadAt(ifdData, int64(ifdOffset+ifdTagCountSize))
+
+	return ifdData, nil
+}
+
+//maxUnsizedReadLength is the most read from a reader which can't tell how many bytes it holds
+const maxUnsizedReadLength = 16 << 20
+
+//readerRemaining returns how many bytes the reader holds from the offset on, readers which can't tell how many
+//bytes they hold, unlike files and section readers, are taken to hold maxUnsizedReadLength
+func readerRemaining(reader io.ReaderAt, offset uint64) uint64 {
+	sized, ok := reader.(interface{ Size() int64 })
+	if !ok {
+		return maxUnsizedReadLength
+	}
+	size := uint64(sized.Size())
+	if offset >= size {
+		return 0
+	}
+	return size - offset
+}
+
+//fitsInReader returns whether length bytes from the offset lie within the reader, offsets and lengths are read from
+//the file, so they're checked with this before anything's allocated for them
+func fitsInReader(reader io.ReaderAt, offset uint64, length uint64) bool {
+	return length <= readerRemaining(reader, offset)
+}
+
+//firstRational returns the first of the rationals, or a zero rational if there are none
+func firstRational(rationals []Rational) Rational {
+	if len(rationals) == 0 {
+		return Rational{}
+	}
+	return rationals[0]
+}
+
+//readNextIFDOffset returns the offset of the IFD following the one at ifdOffset, which is stored straight after
+//its entries, 0 means there are no more IFDs
+func readNextIFDOffset(reader io.ReaderAt, ifdOffset uint64, ifdDataLength int, tiffHeaderData TiffHeader) uint64 {
+	endianReader := utils.NewEndianReader(reader, tiffHeaderData.EndianOrder)
+	if tiffHeaderData.BigTiff {
+		nextIFDOffset, _ := endianReader.Uint64(int64(ifdOffset) + 8 + int64(ifdDataLength))
+		return nextIFDOffset
+	}
+	nextIFDOffset, _ := endianReader.Uint32(int64(ifdOffset) + 2 + int64(ifdDataLength))
+	return uint64(nextIFDOffset)
+}
+
+func readHeaderBytes(reader io.ReaderAt, size int64) ([]byte, error) {
+	//a classic TIFF header is 8 bytes, BigTIFF's is 16 bytes
+	header := make([]byte, 16)
+
+	if size <= 1024 {
 		return nil, errors.New("File is less than 1KB in size")
 	}
 
-	file.Seek(0, 0)
-	_, err = file.Read(header)
+	_, err := reader.ReadAt(header, 0)
 
 	if err != nil {
 		return header, err
@@ -1166,16 +1815,21 @@ func parseHeaderBytes(header []byte) (TiffHeader, error) {
 	tiffData.EndianOrder = getEdianOrder(header)
 
 	if len(header) >= 8 {
+		tiffData.MagicNum = utils.ConvertBytesToUInt16(header[2], header[3], tiffData.EndianOrder)
 
-		var magicNum uint16
-		if tiffData.EndianOrder == utils.BigEndian {
-			magicNum |= uint16(header[2]) | uint16(header[3])
-		} else if tiffData.EndianOrder == utils.LittleEndian {
-			magicNum |= uint16(header[3]) | uint16(header[2])
+		if tiffData.MagicNum == bigTiffMagicNum {
+			if len(header) < 16 {
+				return *tiffData, errors.New("BigTIFF header incorrect length")
+			}
+			//BigTIFF always uses 8 byte offsets, followed by 2 bytes of padding
+			if offsetByteSize := utils.ConvertBytesToUInt16(header[4], header[5], tiffData.EndianOrder); offsetByteSize != 8 {
+				return *tiffData, fmt.Errorf("BigTIFF offset byte size %d not supported", offsetByteSize)
+			}
+			tiffData.BigTiff = true
+			tiffData.TiffOffset = utils.ConvertBytesSliceToUInt64(header[8:16], tiffData.EndianOrder)
+		} else {
+			tiffData.TiffOffset = uint64(utils.ConvertBytesToUInt32(header[4], header[5], header[6], header[7], tiffData.EndianOrder))
 		}
-
-		tiffData.MagicNum = magicNum
-		tiffData.TiffOffset = utils.ConvertBytesToUInt32(header[4], header[5], header[6], header[7], tiffData.EndianOrder)
 	} else {
 		return *tiffData, errors.New("Header incorrect length")
 	}
@@ -1183,16 +1837,7 @@ func parseHeaderBytes(header []byte) (TiffHeader, error) {
 }
 
 func getEdianOrder(header []byte) utils.EndianOrder {
-	if len(header) >= 4 {
-		var endianFlag uint16
-		//add the bits to the 2 byte int and shove them to the left to make room for the other bits
-		endianFlag |= uint16(header[0]) << 8
-		endianFlag |= uint16(header[1])
-		if endianFlag == 0x4d4d {
-			return utils.BigEndian
-		} else if endianFlag == 0x4949 {
-			return utils.LittleEndian
-		}
-	}
-	return utils.BigEndian
+	//default to big endian if the byte order mark isn't recognised
+	endianOrder, _ := utils.DetectEndian(header)
+	return endianOrder
 }
@@ -0,0 +1,168 @@
+package img
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+//testIFDEntry is an IFD entry to lay out in a test TIFF, value is written little endian into the value field
+type testIFDEntry struct {
+	tag      uint16
+	dataType uint8
+	count    uint64
+	value    uint64
+}
+
+//buildTestTIFF lays out a little endian classic TIFF or BigTIFF with an IFD for each list of entries, chained in
+//order, padded to the smallest file size which is read
+func buildTestTIFF(bigTiff bool, ifds ...[]testIFDEntry) []byte {
+	countSize, entrySize, offsetSize := 2, 12, 4
+	data := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	if bigTiff {
+		countSize, entrySize, offsetSize = 8, 20, 8
+		data = []byte{'I', 'I', 43, 0, 8, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0}
+	}
+	putUint := func(b []byte, v uint64, size int) {
+		for i := 0; i < size; i++ {
+			b[i] = byte(v >> (8 * uint(i)))
+		}
+	}
+	for i, entries := range ifds {
+		ifd := make([]byte, countSize+len(entries)*entrySize+offsetSize)
+		putUint(ifd, uint64(len(entries)), countSize)
+		for j, entry := range entries {
+			field := ifd[countSize+j*entrySize:]
+			binary.LittleEndian.PutUint16(field, entry.tag)
+			binary.LittleEndian.PutUint16(field[2:], uint16(entry.dataType))
+			putUint(field[4:], entry.count, offsetSize)
+			putUint(field[4+offsetSize:], entry.value, offsetSize)
+		}
+		if i < len(ifds)-1 {
+			putUint(ifd[len(ifd)-offsetSize:], uint64(len(data)+len(ifd)), offsetSize)
+		}
+		data = append(data, ifd...)
+	}
+	if len(data) <= 1024 {
+		data = append(data, make([]byte, 1025-len(data))...)
+	}
+	return data
+}
+
+//loadTestTIFF loads the TIFF's IFDs from memory
+func loadTestTIFF(t *testing.T, data []byte) RawImage {
+	t.Helper()
+	ri := RawImage{File: NewMemoryFile("test.tif", data)}
+	if err := ri.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return ri
+}
+
+func TestLoadReferenceBlackWhite(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		count    uint64
+		value    uint64
+		expected uint64
+	}{
+		//the value doesn't fit in a classic TIFF's value field, so it's an offset, here to the start of the IFD
+		{"in file", 6, 8, 0x0001000301000002},
+		{"no elements", 0, 0, 0},
+		{"past the end of the file", 1 << 31, 64, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ri := loadTestTIFF(t, buildTestTIFF(false, []testIFDEntry{
+				{imageWidthTag, unsignedShortType, 1, 16},
+				{referenceBlackWhiteTag, unsignedRationalType, test.count, test.value},
+			}))
+			if len(ri.Ifds) != 1 {
+				t.Fatalf("Loaded %d IFDs, expected 1", len(ri.Ifds))
+			}
+			if ri.Ifds[0].ReferenceBlackWhite != test.expected {
+				t.Errorf("Reference black white %d, expected %d", ri.Ifds[0].ReferenceBlackWhite, test.expected)
+			}
+		})
+	}
+}
+
+func TestLoadBigTIFF(t *testing.T) {
+	ri := loadTestTIFF(t, buildTestTIFF(true, []testIFDEntry{
+		{imageWidthTag, unsignedShortType, 1, 640},
+		{imageHeightTag, unsignedLongType, 1, 480},
+		{jpegFromRawStartTag, unsignedLong8Type, 1, 1 << 33},
+		{jpegFromRawLengthTag, unsignedLongType, 1, 4096},
+	}, []testIFDEntry{
+		{imageWidthTag, unsignedLong8Type, 1, 160},
+		{imageHeightTag, unsignedLong8Type, 1, 120},
+	}))
+	if !ri.Header.BigTiff {
+		t.Error("Not loaded as a BigTIFF")
+	}
+	if len(ri.Ifds) != 2 {
+		t.Fatalf("Loaded %d IFDs, expected 2", len(ri.Ifds))
+	}
+	if ri.Ifds[0].ImageWidth != 640 || ri.Ifds[0].ImageHeight != 480 {
+		t.Errorf("IFD0 is %dx%d, expected 640x480", ri.Ifds[0].ImageWidth, ri.Ifds[0].ImageHeight)
+	}
+	//offsets are 8 bytes in BigTIFF, so can be past 4GB
+	if ri.Ifds[0].JpegFromRawStart != 1<<33 || ri.Ifds[0].JpegFromRawLength != 4096 {
+		t.Errorf("Preview at %d of %d bytes, expected at %d of 4096 bytes", ri.Ifds[0].JpegFromRawStart, ri.Ifds[0].JpegFromRawLength, uint64(1<<33))
+	}
+	if ri.Ifds[1].ImageWidth != 160 || ri.Ifds[1].ImageHeight != 120 {
+		t.Errorf("IFD1 is %dx%d, expected 160x120", ri.Ifds[1].ImageWidth, ri.Ifds[1].ImageHeight)
+	}
+}
+
+func TestLoadBigTIFFCountPast32Bits(t *testing.T) {
+	//a count which only fits in 8 bytes mustn't be cut down to its low 32 bits, which would read the value field as
+	//a single element
+	ri := loadTestTIFF(t, buildTestTIFF(true, []testIFDEntry{
+		{imageWidthTag, unsignedShortType, 1, 640},
+		{referenceBlackWhiteTag, unsignedRationalType, 1<<32 + 1, 0x0102030405060708},
+	}))
+	if len(ri.Ifds) != 1 {
+		t.Fatalf("Loaded %d IFDs, expected 1", len(ri.Ifds))
+	}
+	if ri.Ifds[0].ReferenceBlackWhite != 0 {
+		t.Errorf("Reference black white %#x read from an entry too large for the file", ri.Ifds[0].ReferenceBlackWhite)
+	}
+	if entries := ri.Ifds[0].Entries; len(entries) != 2 || entries[1].Count != 1<<32+1 {
+		t.Errorf("Read entries %+v, expected the second to have a count of %d", entries, uint64(1<<32+1))
+	}
+}
+
+func TestLoadExifIFD(t *testing.T) {
+	//IFD0 has two entries, so the EXIF IFD laid out after it starts at 8 + 2 + 2*12 + 4
+	const exifOffset = 38
+	data := buildTestTIFF(false, []testIFDEntry{
+		{imageWidthTag, unsignedShortType, 1, 640},
+		{exifOffsetTag, unsignedLongType, 1, exifOffset},
+	}, []testIFDEntry{
+		{isoTag, unsignedShortType, 1, 400},
+		{imageWidthTag, unsignedShortType, 1, 320},
+	})
+	//the EXIF IFD is only reachable through its pointer, not the chain of IFDs after IFD0
+	binary.LittleEndian.PutUint32(data[exifOffset-4:], 0)
+
+	ri := loadTestTIFF(t, data)
+	if len(ri.Ifds) != 1 {
+		t.Fatalf("Loaded %d IFDs, expected only IFD0", len(ri.Ifds))
+	}
+	if ri.Ifds[0].ExifOffset != exifOffset {
+		t.Errorf("EXIF offset %d, expected %d", ri.Ifds[0].ExifOffset, exifOffset)
+	}
+	exifIFD := ri.Ifds[0].ExifIFD
+	if exifIFD == nil {
+		t.Fatal("EXIF IFD not followed")
+	}
+	if len(exifIFD.Entries) != 2 || exifIFD.Entries[0].Tag != isoTag {
+		t.Errorf("EXIF IFD entries %+v, expected ISO and image width", exifIFD.Entries)
+	}
+	if exifIFD.ISO != 400 || exifIFD.ImageWidth != 320 {
+		t.Errorf("EXIF IFD has ISO %d and width %d, expected 400 and 320", exifIFD.ISO, exifIFD.ImageWidth)
+	}
+	//the EXIF IFD's fields stay out of IFD0
+	if ri.Ifds[0].ISO != 0 || ri.Ifds[0].ImageWidth != 640 {
+		t.Errorf("IFD0 has ISO %d and width %d, expected 0 and 640", ri.Ifds[0].ISO, ri.Ifds[0].ImageWidth)
+	}
+}
@@ -0,0 +1,104 @@
+package img
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+//JFIFSegmentLength is the number of bytes SetDPI adds to JPEGs which don't already start with a JFIF segment
+const JFIFSegmentLength = 18
+
+//pngSignature starts every PNG file, after it are the chunks, IHDR first
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+//SetDPI writes the resolution into the JPEG or PNG file at the path, as the JFIF density of a JPEG or the pHYs
+//chunk of a PNG, the encoders of both leave it out
+func SetDPI(outputPath string, dpi int) error {
+	return rewriteImageFile(outputPath, func(data []byte) ([]byte, error) {
+		return AddDPI(data, dpi)
+	})
+}
+
+//AddDPI is SetDPI for an encoded JPEG or PNG held in memory, returning it with the resolution written into it
+func AddDPI(data []byte, dpi int) ([]byte, error) {
+	if dpi <= 0 || dpi > math.MaxUint16 {
+		return nil, fmt.Errorf("DPI of %d not supported, must be from 1 to %d", dpi, math.MaxUint16)
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{jpegMarkerPrefix, jpegSOIMarker}):
+		return setJPEGDPI(data, dpi), nil
+	case bytes.HasPrefix(data, pngSignature):
+		return setPNGDPI(data, dpi)
+	}
+	return nil, errors.New("Only the DPI of JPEGs and PNGs can be set")
+}
+
+//setJPEGDPI sets the density of the JFIF segment, straight after the SOI marker, adding the segment if the JPEG
+//doesn't start with one
+func setJPEGDPI(data []byte, dpi int) []byte {
+	//the JFIF segment is its marker, length, identifier, version, density units, then x and y density
+	if len(data) >= 20 && data[2] == jpegMarkerPrefix && data[3] == jpegAPP0Marker && bytes.Equal(data[6:11], []byte("JFIF\x00")) {
+		data[13] = 1
+		binary.BigEndian.PutUint16(data[14:16], uint16(dpi))
+		binary.BigEndian.PutUint16(data[16:18], uint16(dpi))
+		return data
+	}
+	jfif := make([]byte, JFIFSegmentLength)
+	copy(jfif, []byte{jpegMarkerPrefix, jpegAPP0Marker, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 1})
+	binary.BigEndian.PutUint16(jfif[12:14], uint16(dpi))
+	binary.BigEndian.PutUint16(jfif[14:16], uint16(dpi))
+	withJFIF := make([]byte, 0, len(data)+len(jfif))
+	withJFIF = append(withJFIF, data[:2]...)
+	withJFIF = append(withJFIF, jfif...)
+	return append(withJFIF, data[2:]...)
+}
+
+//setPNGDPI adds a pHYs chunk after the IHDR chunk, in pixels per meter as that's the only unit PNG has, replacing
+//any pHYs chunk already there
+func setPNGDPI(data []byte, dpi int) ([]byte, error) {
+	pixelsPerMeter := uint32(float64(dpi)/0.0254 + 0.5)
+	phys := make([]byte, 9)
+	binary.BigEndian.PutUint32(phys[0:4], pixelsPerMeter)
+	binary.BigEndian.PutUint32(phys[4:8], pixelsPerMeter)
+	phys[8] = 1
+	return replacePNGChunk(data, "pHYs", phys)
+}
+
+//replacePNGChunk adds a chunk of the type after the IHDR chunk, removing any chunks of the type already there
+func replacePNGChunk(data []byte, chunkType string, chunkData []byte) ([]byte, error) {
+	withChunk := append([]byte{}, pngSignature...)
+	for offset := len(pngSignature); offset < len(data); {
+		if offset+12 > len(data) {
+			return nil, errors.New("PNG chunk runs past the end of the file")
+		}
+		chunkLength := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		chunkEnd := offset + 12 + chunkLength
+		if chunkLength < 0 || chunkEnd > len(data) || chunkEnd < offset {
+			return nil, errors.New("PNG chunk runs past the end of the file")
+		}
+		existingType := string(data[offset+4 : offset+8])
+		if existingType != chunkType {
+			withChunk = append(withChunk, data[offset:chunkEnd]...)
+		}
+		if existingType == "IHDR" {
+			withChunk = append(withChunk, pngChunk(chunkType, chunkData)...)
+		}
+		offset = chunkEnd
+	}
+	return withChunk, nil
+}
+
+//pngChunk lays out a PNG chunk, its length, type, data then the CRC of the type and data
+func pngChunk(chunkType string, chunkData []byte) []byte {
+	chunk := make([]byte, 8, 12+len(chunkData))
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(chunkData)))
+	copy(chunk[4:8], chunkType)
+	chunk = append(chunk, chunkData...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
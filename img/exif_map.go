@@ -0,0 +1,120 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+//GetEXIFMap returns the tags parsed from IFD0, its EXIF IFD and the GPS IFD, keyed by their EXIF field names.
+//Text is returned as strings, numbers as ints or floats and rationals as numerator/denominator strings, tags the
+//image doesn't have are left out. Load must have been called first
+func (ri *RawImage) GetEXIFMap() map[string]interface{} {
+	exifMap := map[string]interface{}{}
+	if len(ri.Ifds) == 0 {
+		return exifMap
+	}
+	ifd0 := &ri.Ifds[0]
+	addIFDToEXIFMap(exifMap, ifd0)
+	if ifd0.ExifIFD != nil {
+		addIFDToEXIFMap(exifMap, ifd0.ExifIFD)
+	}
+	if serialNumber := ri.GetBodySerial(); len(serialNumber) > 0 {
+		exifMap["SerialNumber"] = serialNumber
+	}
+	if lensSerialNumber := ri.GetLensSerial(); len(lensSerialNumber) > 0 {
+		exifMap["LensSerialNumber"] = lensSerialNumber
+	}
+	if dpi := ri.GetDPI(); dpi > 0 {
+		exifMap["DPI"] = dpi
+	}
+	if gpsIFD := ri.GetGpsIFD(); gpsIFD != nil {
+		addGPSToEXIFMap(exifMap, gpsIFD)
+	}
+	return exifMap
+}
+
+//addIFDToEXIFMap adds the IFD's set tags to the map, replacing any already there, so tags of the EXIF IFD win
+//over those of IFD0
+func addIFDToEXIFMap(exifMap map[string]interface{}, ifd *TiffIFD) {
+	addEXIFText(exifMap, "Make", ifd.ImageMakeTag)
+	addEXIFText(exifMap, "Model", ifd.ImageModelTag)
+	addEXIFText(exifMap, "Software", ifd.SoftwareTextData)
+	addEXIFText(exifMap, "ModifyDate", ifd.DateTimeText)
+	addEXIFText(exifMap, "DateTimeOriginal", ifd.DateTimeOriginalText)
+	addEXIFText(exifMap, "LensModel", ifd.LensModelTag)
+	if ifd.ImageWidth > 0 && ifd.ImageHeight > 0 {
+		exifMap["ImageWidth"] = int(ifd.ImageWidth)
+		exifMap["ImageHeight"] = int(ifd.ImageHeight)
+	}
+	if len(ifd.BitsPerSample) > 0 && bytes.Count(ifd.BitsPerSample, []byte{0}) < len(ifd.BitsPerSample) {
+		exifMap["BitsPerSample"] = int(ifd.BitsPerSample[0])
+	}
+	if ifd.CompressionFlag > 0 {
+		exifMap["Compression"] = int(ifd.CompressionFlag)
+	}
+	if ifd.OrientationFlag > 0 {
+		exifMap["Orientation"] = int(ifd.OrientationFlag)
+	}
+	if ifd.XResolution.Denominator > 0 {
+		exifMap["XResolution"] = ifd.XResolution.String()
+	}
+	if ifd.YResolution.Denominator > 0 {
+		exifMap["YResolution"] = ifd.YResolution.String()
+	}
+	if ifd.ResolutionUnit > 0 {
+		exifMap["ResolutionUnit"] = int(ifd.ResolutionUnit)
+	}
+	if ifd.ExposureTime.Denominator > 0 {
+		exifMap["ExposureTime"] = ifd.ExposureTime.String()
+	}
+	if ifd.FNumber.Denominator > 0 {
+		exifMap["FNumber"] = ifd.FNumber.Float64()
+	}
+	if ifd.ISO > 0 {
+		exifMap["ISO"] = int(ifd.ISO)
+	}
+	if ifd.FocalLength.Denominator > 0 {
+		exifMap["FocalLength"] = ifd.FocalLength.Float64()
+	}
+}
+
+//addGPSToEXIFMap adds the GPS IFD's position and time, along with the position in decimal degrees
+func addGPSToEXIFMap(exifMap map[string]interface{}, gpsIFD *GpsIFD) {
+	if gpsIFD.HasFix() {
+		exifMap["GPSLatitudeRef"] = gpsIFD.GPSLatitudeRef
+		exifMap["GPSLatitude"] = formatRationals(gpsIFD.GPSLatitude[:])
+		exifMap["GPSLongitudeRef"] = gpsIFD.GPSLongitudeRef
+		exifMap["GPSLongitude"] = formatRationals(gpsIFD.GPSLongitude[:])
+		exifMap["GPSPosition"] = fmt.Sprintf("%.6f, %.6f", gpsIFD.Latitude(), gpsIFD.Longitude())
+	}
+	if gpsIFD.GPSAltitude.Denominator > 0 {
+		exifMap["GPSAltitudeRef"] = int(gpsIFD.GPSAltitudeRef)
+		exifMap["GPSAltitude"] = gpsIFD.GPSAltitude.String()
+	}
+	if len(gpsIFD.GPSDateStamp) > 0 {
+		exifMap["GPSDateStamp"] = gpsIFD.GPSDateStamp
+	}
+	if gpsIFD.GPSTimeStamp[0].Denominator > 0 {
+		exifMap["GPSTimeStamp"] = gpsIFD.TimeText()
+	}
+	if len(gpsIFD.GPSSatellites) > 0 {
+		exifMap["GPSSatellites"] = gpsIFD.GPSSatellites
+	}
+}
+
+//addEXIFText adds the text tag to the map with its padding trimmed, unless it's empty
+func addEXIFText(exifMap map[string]interface{}, name string, text []byte) {
+	if trimmedText := string(bytes.Trim(text, "\x00 ")); len(trimmedText) > 0 {
+		exifMap[name] = trimmedText
+	}
+}
+
+//formatRationals renders rationals space separated, like the degrees, minutes and seconds of a GPS position
+func formatRationals(rationals []Rational) string {
+	formatted := make([]string, 0, len(rationals))
+	for _, rational := range rationals {
+		formatted = append(formatted, rational.String())
+	}
+	return strings.Join(formatted, " ")
+}
@@ -0,0 +1,63 @@
+package img
+
+import (
+	"fmt"
+	"time"
+)
+
+//HasFix returns whether the GPS IFD holds a usable latitude and longitude
+func (gifd *GpsIFD) HasFix() bool {
+	if gifd == nil {
+		return false
+	}
+	return len(gifd.GPSLatitudeRef) > 0 && len(gifd.GPSLongitudeRef) > 0 && gifd.GPSLatitude[0].Denominator > 0 && gifd.GPSLongitude[0].Denominator > 0
+}
+
+//Latitude returns the latitude in decimal degrees, negative being south of the equator
+func (gifd *GpsIFD) Latitude() float64 {
+	latitude := degreesMinutesSecondsToDecimal(gifd.GPSLatitude)
+	if gifd.GPSLatitudeRef == "S" {
+		return -latitude
+	}
+	return latitude
+}
+
+//Longitude returns the longitude in decimal degrees, negative being west of the prime meridian
+func (gifd *GpsIFD) Longitude() float64 {
+	longitude := degreesMinutesSecondsToDecimal(gifd.GPSLongitude)
+	if gifd.GPSLongitudeRef == "W" {
+		return -longitude
+	}
+	return longitude
+}
+
+//Altitude returns the altitude in metres, negative being below sea level
+func (gifd *GpsIFD) Altitude() float64 {
+	//altitude ref of 1 means below sea level
+	if gifd.GPSAltitudeRef == 1 {
+		return -gifd.GPSAltitude.Float64()
+	}
+	return gifd.GPSAltitude.Float64()
+}
+
+//Time returns the UTC time of the GPS fix, which is only known if both the date and time stamps were present
+func (gifd *GpsIFD) Time() (time.Time, bool) {
+	if gifd == nil || len(gifd.GPSDateStamp) == 0 || gifd.GPSTimeStamp[0].Denominator == 0 {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("2006:01:02", gifd.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	seconds := gifd.GPSTimeStamp[0].Float64()*3600 + gifd.GPSTimeStamp[1].Float64()*60 + gifd.GPSTimeStamp[2].Float64()
+	return date.Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+//TimeText returns the GPS time stamp formatted as hh:mm:ss
+func (gifd *GpsIFD) TimeText() string {
+	return fmt.Sprintf("%02.0f:%02.0f:%02.0f", gifd.GPSTimeStamp[0].Float64(), gifd.GPSTimeStamp[1].Float64(), gifd.GPSTimeStamp[2].Float64())
+}
+
+func degreesMinutesSecondsToDecimal(dms [3]Rational) float64 {
+	return dms[0].Float64() + dms[1].Float64()/60 + dms[2].Float64()/3600
+}
@@ -0,0 +1,138 @@
+package img
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+//exifEntry is an IFD entry to be written, value is its data in big endian order
+type exifEntry struct {
+	tag      uint16
+	dataType uint8
+	count    uint32
+	value    []byte
+}
+
+//SetGPS writes the latitude, longitude, altitude and time of the GPS IFD into the JPEG file at the path, as an
+//EXIF APP1 segment holding nothing but the GPS IFD, after the JFIF segment if it has one. The encoder writes no
+//EXIF of its own, so the rest of the source's metadata is left out
+func SetGPS(outputPath string, gifd *GpsIFD) error {
+	return rewriteImageFile(outputPath, func(data []byte) ([]byte, error) {
+		return AddGPS(data, gifd)
+	})
+}
+
+//AddGPS is SetGPS for an encoded JPEG held in memory, returning it with the GPS IFD written into it
+func AddGPS(data []byte, gifd *GpsIFD) ([]byte, error) {
+	if !gifd.HasFix() {
+		return nil, errors.New("GPS IFD has no latitude and longitude to write")
+	}
+	if !bytes.HasPrefix(data, []byte{jpegMarkerPrefix, jpegSOIMarker}) {
+		return nil, errors.New("GPS can only be written into JPEGs")
+	}
+	//the JFIF segment has to come straight after the SOI marker, so the EXIF segment goes after it
+	insertAt := 2
+	if len(data) >= 6 && data[2] == jpegMarkerPrefix && data[3] == jpegAPP0Marker {
+		insertAt = 4 + int(binary.BigEndian.Uint16(data[4:6]))
+		if insertAt > len(data) {
+			return nil, errors.New("JFIF segment runs past the end of the file")
+		}
+	}
+	segment := gpsExifSegment(gifd)
+	withGPS := make([]byte, 0, len(data)+len(segment))
+	withGPS = append(withGPS, data[:insertAt]...)
+	withGPS = append(withGPS, segment...)
+	return append(withGPS, data[insertAt:]...), nil
+}
+
+//GPSSegmentLength is the number of bytes SetGPS adds to JPEGs for the GPS IFD
+func GPSSegmentLength(gifd *GpsIFD) int {
+	return len(gpsExifSegment(gifd))
+}
+
+//gpsExifSegment lays out the APP1 segment, a big endian TIFF header followed by an IFD0 holding only the pointer
+//to the GPS IFD
+func gpsExifSegment(gifd *GpsIFD) []byte {
+	const ifd0Offset = 8
+	//IFD0's entry count, single entry and next IFD offset
+	const gpsIFDOffset = ifd0Offset + 2 + 12 + 4
+
+	tiffData := []byte{'M', 'M', 0, 42, 0, 0, 0, ifd0Offset}
+	tiffData = append(tiffData, layoutIFD([]exifEntry{{tag: gpsInfoTag, dataType: unsignedLongType, count: 1, value: uint32Bytes(gpsIFDOffset)}}, ifd0Offset)...)
+	tiffData = append(tiffData, layoutIFD(gpsEntries(gifd), gpsIFDOffset)...)
+
+	segment := []byte{jpegMarkerPrefix, jpegAPP1Marker, 0, 0}
+	//the length counts itself but not the marker
+	binary.BigEndian.PutUint16(segment[2:4], uint16(2+len(jpegExifHeader)+len(tiffData)))
+	segment = append(segment, jpegExifHeader...)
+	return append(segment, tiffData...)
+}
+
+//gpsEntries returns the entries of the GPS IFD to write in tag order, the time is only written if both its date
+//and time stamps are known
+func gpsEntries(gifd *GpsIFD) []exifEntry {
+	entries := []exifEntry{
+		{tag: GPSVersionID, dataType: unsignedByteType, count: 4, value: []byte{2, 3, 0, 0}},
+		{tag: GPSLatitudeRef, dataType: asciiStringsType, count: 2, value: []byte(gifd.GPSLatitudeRef[:1] + "\x00")},
+		{tag: GPSLatitude, dataType: unsignedRationalType, count: 3, value: rationalBytes(gifd.GPSLatitude[:]...)},
+		{tag: GPSLongitudeRef, dataType: asciiStringsType, count: 2, value: []byte(gifd.GPSLongitudeRef[:1] + "\x00")},
+		{tag: GPSLongitude, dataType: unsignedRationalType, count: 3, value: rationalBytes(gifd.GPSLongitude[:]...)},
+	}
+	if gifd.GPSAltitude.Denominator > 0 {
+		entries = append(entries,
+			exifEntry{tag: GPSAltitudeRef, dataType: unsignedByteType, count: 1, value: []byte{gifd.GPSAltitudeRef}},
+			exifEntry{tag: GPSAltitude, dataType: unsignedRationalType, count: 1, value: rationalBytes(gifd.GPSAltitude)},
+		)
+	}
+	if _, ok := gifd.Time(); ok {
+		entries = append(entries,
+			exifEntry{tag: GPSTimeStamp, dataType: unsignedRationalType, count: 3, value: rationalBytes(gifd.GPSTimeStamp[:]...)},
+			exifEntry{tag: GPSDateStamp, dataType: asciiStringsType, count: 11, value: []byte(gifd.GPSDateStamp[:10] + "\x00")},
+		)
+	}
+	return entries
+}
+
+//layoutIFD lays out the IFD at the offset from the start of the TIFF data, with no next IFD, the values of entries
+//which don't fit in 4 bytes are put straight after it
+func layoutIFD(entries []exifEntry, ifdOffset uint32) []byte {
+	ifd := make([]byte, 2, 2+12*len(entries)+4)
+	binary.BigEndian.PutUint16(ifd, uint16(len(entries)))
+	var values []byte
+	valuesOffset := ifdOffset + uint32(2+12*len(entries)+4)
+	for _, entry := range entries {
+		field := make([]byte, 12)
+		binary.BigEndian.PutUint16(field[0:2], entry.tag)
+		binary.BigEndian.PutUint16(field[2:4], uint16(entry.dataType))
+		binary.BigEndian.PutUint32(field[4:8], entry.count)
+		if len(entry.value) <= 4 {
+			copy(field[8:], entry.value)
+		} else {
+			binary.BigEndian.PutUint32(field[8:], valuesOffset+uint32(len(values)))
+			values = append(values, entry.value...)
+			//values start on word boundaries
+			if len(values)%2 == 1 {
+				values = append(values, 0)
+			}
+		}
+		ifd = append(ifd, field...)
+	}
+	ifd = append(ifd, 0, 0, 0, 0)
+	return append(ifd, values...)
+}
+
+func uint32Bytes(value uint32) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, value)
+	return data
+}
+
+func rationalBytes(rationals ...Rational) []byte {
+	data := make([]byte, 0, 8*len(rationals))
+	for _, rational := range rationals {
+		data = append(data, uint32Bytes(rational.Numerator)...)
+		data = append(data, uint32Bytes(rational.Denominator)...)
+	}
+	return data
+}
@@ -0,0 +1,90 @@
+package img
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+//HasselbladImage is a Hasselblad 3FR raw, which is TIFF based, possibly BigTIFF, and can run to hundreds of
+//megabytes, so only the IFDs and the preview are ever read from the file
+type HasselbladImage struct {
+	RawImage
+}
+
+func (hi *HasselbladImage) GetRawImage() RawImage {
+	return hi.RawImage
+}
+
+func (hi *HasselbladImage) Load() error {
+	return hi.RawImage.Load()
+}
+
+func (hi *HasselbladImage) Decode() (image.Image, error) {
+	if err := hi.Load(); err != nil {
+		return nil, err
+	}
+	fileStats, err := hi.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	previewIFD := hi.getLargestJPEGStripIFD()
+	if largestPreviewIFD := hi.GetLargestPreviewIFD(); previewIFD == nil || (largestPreviewIFD != nil && largestPreviewIFD.JpegFromRawLength > previewIFD.JpegFromRawLength) {
+		previewIFD = largestPreviewIFD
+	}
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	if previewIFD.JpegFromRawStart+uint64(previewIFD.JpegFromRawLength) > uint64(fileStats.Size()) {
+		return nil, errors.New("Embedded preview image runs past the end of the file")
+	}
+	return hi.decodePreview(previewIFD)
+}
+
+func (hi *HasselbladImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := hi.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (hi *HasselbladImage) WritePNG(w io.Writer) error {
+	decodedImage, err := hi.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (hi *HasselbladImage) ConvertToJPEG(outputPath string) error {
+	defer hi.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return hi.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (hi *HasselbladImage) ConvertToPNG(outputPath string) error {
+	defer hi.RawImage.File.Close()
+	return writeImageFile(outputPath, hi.WritePNG)
+}
+
+//getLargestJPEGStripIFD returns the largest JPEG image stored as a single strip rather than referenced by the
+//JpegFromRaw tags, as a preview IFD, or nil if there isn't one
+func (hi *HasselbladImage) getLargestJPEGStripIFD() *TiffIFD {
+	var largestStripIFD *TiffIFD
+	for _, ifd := range hi.Ifds {
+		if ifd.PhotometricInterpretationFlag == photometricInterpretationCFA || ifd.StripOffsets == 0 || ifd.StripByteCounts == 0 {
+			continue
+		}
+		if ifd.CompressionFlag != compressionOJPEG && ifd.CompressionFlag != compressionJPEG {
+			continue
+		}
+		if largestStripIFD == nil || ifd.StripByteCounts > largestStripIFD.JpegFromRawLength {
+			largestStripIFD = &TiffIFD{JpegFromRawStart: ifd.StripOffsets, JpegFromRawLength: ifd.StripByteCounts}
+		}
+	}
+	return largestStripIFD
+}
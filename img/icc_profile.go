@@ -0,0 +1,109 @@
+package img
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+)
+
+//maxICCProfileLength is the largest ICC profile read from an IFD, real profiles are well under it
+const maxICCProfileLength = 4 << 20
+
+const jpegAPP2Marker byte = 0xe2
+
+//iccJPEGIdentifier starts each APP2 segment holding part of an ICC profile
+var iccJPEGIdentifier = []byte("ICC_PROFILE\x00")
+
+//iccJPEGChunkLength is the most profile bytes one APP2 segment can hold, after its length, identifier, and the
+//segment's number and count
+var iccJPEGChunkLength = 0xffff - 2 - len(iccJPEGIdentifier) - 2
+
+//SetICCProfile embeds the ICC color profile into the JPEG or PNG file at the path, as APP2 segments after any
+//JFIF and EXIF segments of a JPEG, or the iCCP chunk of a PNG
+func SetICCProfile(outputPath string, profile []byte) error {
+	return rewriteImageFile(outputPath, func(data []byte) ([]byte, error) {
+		return AddICCProfile(data, profile)
+	})
+}
+
+//AddICCProfile is SetICCProfile for an encoded JPEG or PNG held in memory, returning it with the profile embedded
+func AddICCProfile(data []byte, profile []byte) ([]byte, error) {
+	if len(profile) == 0 {
+		return nil, errors.New("ICC profile is empty")
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{jpegMarkerPrefix, jpegSOIMarker}):
+		return setJPEGICCProfile(data, profile)
+	case bytes.HasPrefix(data, pngSignature):
+		return setPNGICCProfile(data, profile)
+	}
+	return nil, errors.New("ICC profiles can only be embedded into JPEGs and PNGs")
+}
+
+//ICCSegmentsLength is the number of bytes SetICCProfile adds to JPEGs for the profile
+func ICCSegmentsLength(profile []byte) int {
+	length := 0
+	for _, segment := range iccJPEGSegments(profile) {
+		length += len(segment)
+	}
+	return length
+}
+
+//setJPEGICCProfile inserts the profile's APP2 segments after the APP0 and APP1 segments straight after the SOI
+//marker, where readers expect to find them
+func setJPEGICCProfile(data []byte, profile []byte) ([]byte, error) {
+	if len(profile) > iccJPEGChunkLength*0xff {
+		return nil, errors.New("ICC profile is too large to embed into a JPEG")
+	}
+	insertAt := 2
+	for insertAt+4 <= len(data) && data[insertAt] == jpegMarkerPrefix && (data[insertAt+1] == jpegAPP0Marker || data[insertAt+1] == jpegAPP1Marker) {
+		insertAt += 2 + int(binary.BigEndian.Uint16(data[insertAt+2:insertAt+4]))
+	}
+	if insertAt > len(data) {
+		return nil, errors.New("JPEG segment runs past the end of the file")
+	}
+	withProfile := make([]byte, 0, len(data)+ICCSegmentsLength(profile))
+	withProfile = append(withProfile, data[:insertAt]...)
+	for _, segment := range iccJPEGSegments(profile) {
+		withProfile = append(withProfile, segment...)
+	}
+	return append(withProfile, data[insertAt:]...), nil
+}
+
+//iccJPEGSegments splits the profile across as many APP2 segments as it needs, each numbered from 1 along with how
+//many there are
+func iccJPEGSegments(profile []byte) [][]byte {
+	count := (len(profile) + iccJPEGChunkLength - 1) / iccJPEGChunkLength
+	segments := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := profile[i*iccJPEGChunkLength:]
+		if len(chunk) > iccJPEGChunkLength {
+			chunk = chunk[:iccJPEGChunkLength]
+		}
+		segment := make([]byte, 4, 4+len(iccJPEGIdentifier)+2+len(chunk))
+		segment[0], segment[1] = jpegMarkerPrefix, jpegAPP2Marker
+		binary.BigEndian.PutUint16(segment[2:4], uint16(2+len(iccJPEGIdentifier)+2+len(chunk)))
+		segment = append(segment, iccJPEGIdentifier...)
+		segment = append(segment, byte(i+1), byte(count))
+		segments = append(segments, append(segment, chunk...))
+	}
+	return segments
+}
+
+//setPNGICCProfile adds an iCCP chunk after the IHDR chunk, the profile's name, which nothing reads, then the
+//profile zlib compressed, replacing any iCCP chunk already there
+func setPNGICCProfile(data []byte, profile []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	compressed.WriteString("ICC Profile\x00")
+	//compression method, zlib is the only one there is
+	compressed.WriteByte(0)
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return replacePNGChunk(data, "iCCP", compressed.Bytes())
+}
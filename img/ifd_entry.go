@@ -0,0 +1,63 @@
+package img
+
+import (
+	"io"
+	"math"
+
+	"github.com/tacusci/clover/utils"
+)
+
+//IFDEntry is an IFD entry as it's stored, before its value is decoded, kept so the raw metadata of formats which
+//aren't fully supported yet can be inspected. ValueField is the entry's value, or the offset of it if it doesn't fit
+type IFDEntry struct {
+	Tag        uint16
+	DataType   uint16
+	Count      uint64
+	ValueField []byte
+	reader     io.ReaderAt
+	header     TiffHeader
+}
+
+//Size returns the number of bytes of the entry's element data
+func (entry IFDEntry) Size() uint64 {
+	size, ok := entryDataLength(uint8(entry.DataType), entry.Count)
+	if !ok {
+		return math.MaxUint64
+	}
+	return size
+}
+
+//Data reads up to maxLength bytes of the entry's element data, from the file if it isn't held in the value field,
+//so the file the image was loaded from has to still be open. The count of malformed entries can be far larger
+//than the file, so it's never read past maxLength
+func (entry IFDEntry) Data(maxLength int) []byte {
+	size := entry.Size()
+	if size > uint64(maxLength) {
+		size = uint64(maxLength)
+	}
+	data := make([]byte, size)
+	if int(size) <= len(entry.ValueField) || entry.reader == nil {
+		copy(data, entry.ValueField)
+		return data
+	}
+	n, _ := entry.reader.ReadAt(data, int64(readOffset(entry.ValueField, entry.header.EndianOrder)))
+	return data[:n]
+}
+
+//readIFDEntries splits the IFD's data into its entries, without decoding any of them
+func readIFDEntries(reader io.ReaderAt, ifdData []byte, tiffHeaderData TiffHeader) []IFDEntry {
+	entrySize := tiffHeaderData.ifdEntrySize()
+	entries := make([]IFDEntry, 0, len(ifdData)/entrySize)
+	for i := 0; i+entrySize <= len(ifdData); i += entrySize {
+		numOfElements, valueField := splitIFDEntry(ifdData[i:i+entrySize], tiffHeaderData)
+		entries = append(entries, IFDEntry{
+			Tag:        utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder),
+			DataType:   utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder),
+			Count:      numOfElements,
+			ValueField: valueField,
+			reader:     reader,
+			header:     tiffHeaderData,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,160 @@
+package img
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+const (
+	jpegMarkerPrefix byte = 0xff
+	jpegSOIMarker    byte = 0xd8
+	jpegEOIMarker    byte = 0xd9
+	jpegSOSMarker    byte = 0xda
+	jpegAPP1Marker   byte = 0xe1
+)
+
+//jpegExifHeader starts an APP1 segment holding EXIF data, it's followed by a TIFF header and IFDs
+var jpegExifHeader = []byte("Exif\x00\x00")
+
+//JpegImage is an already compressed JPEG, its EXIF is read from the APP1 segment into the same IFDs as a raw's
+type JpegImage struct {
+	RawImage
+	exifReader *io.SectionReader
+}
+
+func (ji *JpegImage) GetRawImage() RawImage {
+	return ji.RawImage
+}
+
+func (ji *JpegImage) Load() error {
+	return ji.loadOnce(ji.load)
+}
+
+func (ji *JpegImage) load() error {
+	logging.Debug(fmt.Sprintf("\nParsing %s JPEG EXIF data", ji.File.Name()))
+	ji.exifReader = nil
+	fileStats, err := ji.File.Stat()
+	if err != nil {
+		return err
+	}
+	exifStart, exifLength, err := findJpegExifSegment(ji.File, fileStats.Size())
+	if err != nil {
+		return err
+	}
+	//offsets in the EXIF data are counted from its TIFF header, so read it as if it were a file of its own
+	ji.exifReader = io.NewSectionReader(ji.File, exifStart, exifLength)
+	headerBytes := make([]byte, 16)
+	if n, err := ji.exifReader.ReadAt(headerBytes, 0); n < 8 {
+		return err
+	}
+	return ji.loadIFDs(ji.exifReader, headerBytes, exifLength)
+}
+
+//GetThumbnail returns the thumbnail from the EXIF data, whose offsets are counted from its TIFF header
+func (ji *JpegImage) GetThumbnail() ([]byte, error) {
+	if ji.exifReader == nil {
+		return nil, ErrNoPreview
+	}
+	return readThumbnail(ji.exifReader, ji.exifReader.Size(), ji.Ifds)
+}
+
+//GetPreviews returns the JPEGs embedded in the EXIF data, not including the image itself
+func (ji *JpegImage) GetPreviews() ([]Preview, error) {
+	if ji.exifReader == nil {
+		return nil, ErrNoPreview
+	}
+	return readPreviews(ji.exifReader, ji.exifReader.Size(), ji.Ifds)
+}
+
+func (ji *JpegImage) Decode() (image.Image, error) {
+	fileStats, err := ji.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(bufio.NewReader(io.NewSectionReader(ji.File, 0, fileStats.Size())))
+}
+
+func (ji *JpegImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := ji.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (ji *JpegImage) WritePNG(w io.Writer) error {
+	decodedImage, err := ji.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (ji *JpegImage) ConvertToJPEG(outputPath string) error {
+	defer ji.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return ji.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (ji *JpegImage) ConvertToPNG(outputPath string) error {
+	defer ji.RawImage.File.Close()
+	return writeImageFile(outputPath, ji.WritePNG)
+}
+
+//findJpegExifSegment walks the JPEG's marker segments up to the start of the image data, returning the offset
+//and length of the TIFF data in its EXIF APP1 segment
+func findJpegExifSegment(reader io.ReaderAt, size int64) (int64, int64, error) {
+	marker := make([]byte, 2)
+	if _, err := reader.ReadAt(marker, 0); err != nil {
+		return 0, 0, err
+	}
+	if marker[0] != jpegMarkerPrefix || marker[1] != jpegSOIMarker {
+		return 0, 0, errors.New("Not a JPEG image, missing start of image marker")
+	}
+
+	endianReader := utils.NewEndianReader(reader, utils.BigEndian)
+	offset := int64(2)
+	for offset+4 <= size {
+		if _, err := reader.ReadAt(marker, offset); err != nil {
+			return 0, 0, err
+		}
+		if marker[0] != jpegMarkerPrefix {
+			return 0, 0, fmt.Errorf("Invalid JPEG marker at offset %d", offset)
+		}
+		//markers can be padded with any number of 0xff fill bytes
+		if marker[1] == jpegMarkerPrefix {
+			offset++
+			continue
+		}
+		if marker[1] == jpegSOSMarker || marker[1] == jpegEOIMarker {
+			break
+		}
+		segmentLength, err := endianReader.Uint16(offset + 2)
+		if err != nil {
+			return 0, 0, err
+		}
+		//the segment length includes its own two bytes but not the marker's
+		segmentDataStart, segmentDataLength := offset+4, int64(segmentLength)-2
+		if marker[1] == jpegAPP1Marker && segmentDataLength > int64(len(jpegExifHeader)) {
+			exifHeader := make([]byte, len(jpegExifHeader))
+			if _, err := reader.ReadAt(exifHeader, segmentDataStart); err != nil {
+				return 0, 0, err
+			}
+			if bytes.Equal(exifHeader, jpegExifHeader) {
+				return segmentDataStart + int64(len(jpegExifHeader)), segmentDataLength - int64(len(jpegExifHeader)), nil
+			}
+		}
+		offset = segmentDataStart + segmentDataLength
+	}
+	return 0, 0, errors.New("No EXIF data found")
+}
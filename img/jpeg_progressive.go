@@ -0,0 +1,426 @@
+package img
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+//image/jpeg only writes baseline JPEGs, so progressive ones are encoded here, using spectral selection only,
+//the DC coefficients of every component go first, then two bands of AC coefficients for each component in turn
+
+const (
+	jpegSOF2Marker byte = 0xc2
+	jpegDHTMarker  byte = 0xc4
+	jpegDQTMarker  byte = 0xdb
+	jpegAPP0Marker byte = 0xe0
+)
+
+//jpegZigzag maps the zigzag index of a coefficient to its natural, row by row, index within the block
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+//jpegBaseQuantTables are the example luminance and chrominance tables of the JPEG spec (Annex K), in zigzag order
+var jpegBaseQuantTables = [2][64]int{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+//jpegHuffmanSpec is a Huffman table as stored in a DHT segment, the count of codes of each length from 1 to 16
+//bits, then the values in code order
+type jpegHuffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+//jpegHuffmanSpecs are the example luminance DC, luminance AC, chrominance DC and chrominance AC tables of the JPEG
+//spec (Annex K), the AC tables hold every run/size pair and end of band, so suit progressive scans too
+var jpegHuffmanSpecs = [4]jpegHuffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+//jpegProgressiveACBands are the zigzag ranges of AC coefficients sent in each AC scan, the low frequencies in the
+//first give a usable image early on
+var jpegProgressiveACBands = [][2]int{{1, 5}, {6, 63}}
+
+//jpegDCTCosines holds C(u)/2 * cos((2x+1)uπ/16) for the forward DCT
+var jpegDCTCosines = func() [8][8]float64 {
+	var cosines [8][8]float64
+	for u := 0; u < 8; u++ {
+		scale := 0.5
+		if u == 0 {
+			scale = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			cosines[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return cosines
+}()
+
+type jpegHuffmanCode struct {
+	code   uint32
+	length uint
+}
+
+//jpegBitWriter writes Huffman coded bits, stuffing a zero byte after any 0xff byte as the JPEG spec requires
+type jpegBitWriter struct {
+	w     *bufio.Writer
+	bits  uint32
+	nBits uint
+	err   error
+}
+
+func (bw *jpegBitWriter) emit(bits uint32, length uint) {
+	bw.bits = bw.bits<<length | bits&(1<<length-1)
+	bw.nBits += length
+	for bw.nBits >= 8 {
+		b := byte(bw.bits >> (bw.nBits - 8))
+		bw.writeByte(b)
+		if b == 0xff {
+			bw.writeByte(0)
+		}
+		bw.nBits -= 8
+	}
+	bw.bits &= 1<<bw.nBits - 1
+}
+
+func (bw *jpegBitWriter) emitHuffman(code jpegHuffmanCode) {
+	bw.emit(code.code, code.length)
+}
+
+//emitValue writes a coefficient's size category, then its bits, negative values are stored as their one's
+//complement
+func (bw *jpegBitWriter) emitValue(code [256]jpegHuffmanCode, run int, value int32) {
+	magnitude := value
+	if magnitude < 0 {
+		magnitude = -magnitude
+		value--
+	}
+	size := uint(0)
+	for magnitude > 0 {
+		size++
+		magnitude >>= 1
+	}
+	bw.emitHuffman(code[run<<4|int(size)])
+	if size > 0 {
+		bw.emit(uint32(value), size)
+	}
+}
+
+//flush pads the final byte of a scan with one bits
+func (bw *jpegBitWriter) flush() {
+	if bw.nBits > 0 {
+		bw.emit(1<<(8-bw.nBits)-1, 8-bw.nBits)
+	}
+}
+
+func (bw *jpegBitWriter) writeByte(b byte) {
+	if bw.err == nil {
+		bw.err = bw.w.WriteByte(b)
+	}
+}
+
+func (bw *jpegBitWriter) write(p []byte) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(p)
+	}
+}
+
+func (bw *jpegBitWriter) writeSegment(marker byte, data []byte) {
+	bw.write([]byte{0xff, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)})
+	bw.write(data)
+}
+
+//WriteProgressiveJPEG writes the image as a progressive JPEG of the given quality, from 1 to 100
+func WriteProgressiveJPEG(decodedImage image.Image, outputPath string, quality int) error {
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return EncodeProgressiveJPEG(w, decodedImage, quality)
+	})
+}
+
+//ConvertToProgressiveJPEG decodes the image and writes it as a progressive JPEG of the default quality
+func ConvertToProgressiveJPEG(ti TiffImage, outputPath string) error {
+	defer ti.GetRawImage().File.Close()
+	decodedImage, err := ti.Decode()
+	if err != nil {
+		return err
+	}
+	return WriteProgressiveJPEG(decodedImage, outputPath, jpeg.DefaultQuality)
+}
+
+//EncodeProgressiveJPEG writes the image to w as a progressive JPEG of the given quality, from 1 to 100, grayscale
+//images have a single component, everything else is YCbCr with no chroma subsampling
+func EncodeProgressiveJPEG(w io.Writer, m image.Image, quality int) error {
+	bounds := m.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 0xffff || height > 0xffff {
+		return errors.New("JPEG image dimensions must be from 1 to 65535")
+	}
+	quality = clampInt(quality, 1, 100)
+	componentCount := 3
+	if _, ok := m.(*image.Gray); ok {
+		componentCount = 1
+	}
+
+	var quantTables [2][64]int
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for t := range quantTables {
+		for k := range quantTables[t] {
+			quantTables[t][k] = clampInt((jpegBaseQuantTables[t][k]*scale+50)/100, 1, 255)
+		}
+	}
+
+	blocksWide, blocksHigh := (width+7)/8, (height+7)/8
+	coefficients := make([][][64]int32, componentCount)
+	for c := range coefficients {
+		coefficients[c] = make([][64]int32, blocksWide*blocksHigh)
+	}
+	var samples [3][64]float64
+	for by := 0; by < blocksHigh; by++ {
+		for bx := 0; bx < blocksWide; bx++ {
+			for i := 0; i < 64; i++ {
+				//edge blocks repeat the last row and column rather than padding with black
+				x := bounds.Min.X + minInt(bx*8+i%8, width-1)
+				y := bounds.Min.Y + minInt(by*8+i/8, height-1)
+				if componentCount == 1 {
+					samples[0][i] = float64(color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y) - 128
+					continue
+				}
+				r, g, b, _ := m.At(x, y).RGBA()
+				yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+				samples[0][i], samples[1][i], samples[2][i] = float64(yy)-128, float64(cb)-128, float64(cr)-128
+			}
+			for c := 0; c < componentCount; c++ {
+				quantTable := quantTables[minInt(c, 1)]
+				dct := forwardDCT(&samples[c])
+				block := &coefficients[c][by*blocksWide+bx]
+				for k := 0; k < 64; k++ {
+					block[k] = int32(math.Round(dct[jpegZigzag[k]] / float64(quantTable[k])))
+				}
+			}
+		}
+	}
+
+	var huffmanCodes [4][256]jpegHuffmanCode
+	for t := range jpegHuffmanSpecs {
+		huffmanCodes[t] = buildJPEGHuffmanCodes(jpegHuffmanSpecs[t])
+	}
+
+	bw := &jpegBitWriter{w: bufio.NewWriter(w)}
+	bw.write([]byte{0xff, jpegSOIMarker})
+	bw.writeSegment(jpegAPP0Marker, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+
+	tableCount := minInt(componentCount, 2)
+	var dqt []byte
+	for t := 0; t < tableCount; t++ {
+		dqt = append(dqt, byte(t))
+		for _, q := range quantTables[t] {
+			dqt = append(dqt, byte(q))
+		}
+	}
+	bw.writeSegment(jpegDQTMarker, dqt)
+
+	sof := []byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(componentCount)}
+	for c := 0; c < componentCount; c++ {
+		sof = append(sof, byte(c+1), 0x11, byte(minInt(c, 1)))
+	}
+	bw.writeSegment(jpegSOF2Marker, sof)
+
+	var dht []byte
+	for t := 0; t < tableCount*2; t++ {
+		//DC tables are class 0 and AC tables class 1, each with the ID of the luminance or chrominance table
+		dht = append(dht, byte((t%2)<<4|t/2))
+		dht = append(dht, jpegHuffmanSpecs[t].counts[:]...)
+		dht = append(dht, jpegHuffmanSpecs[t].values...)
+	}
+	bw.writeSegment(jpegDHTMarker, dht)
+
+	//the DC scan interleaves all the components, each block's DC is coded as the difference from the previous one
+	sos := []byte{byte(componentCount)}
+	for c := 0; c < componentCount; c++ {
+		sos = append(sos, byte(c+1), byte(minInt(c, 1)<<4|minInt(c, 1)))
+	}
+	bw.writeSegment(jpegSOSMarker, append(sos, 0, 0, 0))
+	previousDC := make([]int32, componentCount)
+	for b := 0; b < blocksWide*blocksHigh; b++ {
+		for c := 0; c < componentCount; c++ {
+			dc := coefficients[c][b][0]
+			bw.emitValue(huffmanCodes[minInt(c, 1)*2], 0, dc-previousDC[c])
+			previousDC[c] = dc
+		}
+	}
+	bw.flush()
+
+	//each AC scan holds a single component, blocks that end in zeros end with an end of band code
+	for _, band := range jpegProgressiveACBands {
+		for c := 0; c < componentCount; c++ {
+			bw.writeSegment(jpegSOSMarker, []byte{1, byte(c + 1), byte(minInt(c, 1)), byte(band[0]), byte(band[1]), 0})
+			acCodes := huffmanCodes[minInt(c, 1)*2+1]
+			for b := range coefficients[c] {
+				run := 0
+				for k := band[0]; k <= band[1]; k++ {
+					value := coefficients[c][b][k]
+					if value == 0 {
+						run++
+						continue
+					}
+					for run > 15 {
+						bw.emitHuffman(acCodes[0xf0])
+						run -= 16
+					}
+					bw.emitValue(acCodes, run, value)
+					run = 0
+				}
+				if run > 0 {
+					bw.emitHuffman(acCodes[0x00])
+				}
+			}
+			bw.flush()
+		}
+	}
+
+	bw.write([]byte{0xff, jpegEOIMarker})
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+//forwardDCT transforms a block of level shifted samples into its DCT coefficients, in natural order
+func forwardDCT(samples *[64]float64) [64]float64 {
+	var rows, dct [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < 8; x++ {
+				sum += jpegDCTCosines[u][x] * samples[y*8+x]
+			}
+			rows[y*8+u] = sum
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			sum := 0.0
+			for y := 0; y < 8; y++ {
+				sum += jpegDCTCosines[v][y] * rows[y*8+u]
+			}
+			dct[v*8+u] = sum
+		}
+	}
+	return dct
+}
+
+//buildJPEGHuffmanCodes assigns the canonical Huffman codes of the spec to its values
+func buildJPEGHuffmanCodes(spec jpegHuffmanSpec) [256]jpegHuffmanCode {
+	var codes [256]jpegHuffmanCode
+	code, valueIndex := uint32(0), 0
+	for length := uint(1); length <= 16; length++ {
+		for i := 0; i < int(spec.counts[length-1]); i++ {
+			codes[spec.values[valueIndex]] = jpegHuffmanCode{code: code, length: length}
+			code++
+			valueIndex++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,111 @@
+package img
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+//testGradient fills an image of a size which isn't a multiple of 8, so the edge blocks are covered, with smooth
+//gradients which a high quality JPEG should keep close to
+func testGradient(gray bool) image.Image {
+	bounds := image.Rect(0, 0, 37, 29)
+	if gray {
+		m := image.NewGray(bounds)
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				m.SetGray(x, y, color.Gray{Y: uint8(x * 6)})
+			}
+		}
+		return m
+	}
+	m := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			m.SetRGBA(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 8), B: uint8(255 - x*3), A: 255})
+		}
+	}
+	return m
+}
+
+//meanDifference returns the mean absolute difference between the 8-bit channels of the two images
+func meanDifference(a image.Image, b image.Image) float64 {
+	var total, count float64
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ar, ag, ab, _ := a.At(x, y).RGBA()
+			br, bg, bb, _ := b.At(x, y).RGBA()
+			for _, d := range [][2]uint32{{ar, br}, {ag, bg}, {ab, bb}} {
+				diff := float64(d[0]>>8) - float64(d[1]>>8)
+				if diff < 0 {
+					diff = -diff
+				}
+				total += diff
+				count++
+			}
+		}
+	}
+	return total / count
+}
+
+//frameMarker walks the segments before the first scan, returning the marker of the start of frame segment, or 0
+//if there isn't one
+func frameMarker(data []byte) byte {
+	for i := 2; i+4 <= len(data) && data[i] == jpegMarkerPrefix; {
+		marker := data[i+1]
+		if marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc {
+			return marker
+		}
+		if marker == 0xda {
+			break
+		}
+		i += 2 + (int(data[i+2])<<8 | int(data[i+3]))
+	}
+	return 0
+}
+
+func TestEncodeProgressiveJPEG(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		gray bool
+	}{{"rgb", false}, {"gray", true}} {
+		t.Run(test.name, func(t *testing.T) {
+			m := testGradient(test.gray)
+			var buf bytes.Buffer
+			if err := EncodeProgressiveJPEG(&buf, m, 90); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			if marker := frameMarker(data); marker != jpegSOF2Marker {
+				t.Errorf("Written with frame marker %#x, expected SOF2", marker)
+			}
+
+			decoded, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds() != m.Bounds() {
+				t.Fatalf("Decoded as %v, expected %v", decoded.Bounds(), m.Bounds())
+			}
+			if _, isGray := decoded.(*image.Gray); isGray != test.gray {
+				t.Errorf("Decoded as %T", decoded)
+			}
+			if difference := meanDifference(m, decoded); difference > 3 {
+				t.Errorf("Decoded image is a mean of %.2f off the original", difference)
+			}
+		})
+	}
+}
+
+func TestEncodeProgressiveJPEGDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeProgressiveJPEG(&buf, image.NewGray(image.Rect(0, 0, 0, 8)), 90); err == nil {
+		t.Error("Encoded an image with no width")
+	}
+	if err := EncodeProgressiveJPEG(&buf, image.NewGray(image.Rect(0, 0, 0x10000, 1)), 90); err == nil {
+		t.Error("Encoded an image wider than 65535")
+	}
+}
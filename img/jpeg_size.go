@@ -0,0 +1,70 @@
+package img
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+//ErrJPEGTargetSizeExceeded is returned when even the lowest quality JPEG is larger than the target size, the lowest
+//quality JPEG is still written
+var ErrJPEGTargetSizeExceeded = errors.New("JPEG is larger than the target size even at the lowest quality")
+
+//EncodeJPEGTargetSize binary searches for the highest JPEG quality whose output fits in maxBytes, returning the
+//encoded JPEG and its quality
+func EncodeJPEGTargetSize(decodedImage image.Image, maxBytes int64) ([]byte, int, error) {
+	var best []byte
+	bestQuality := 0
+	low, high := 1, 100
+	for low <= high {
+		quality := (low + high) / 2
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, decodedImage, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, 0, err
+		}
+		if int64(encoded.Len()) <= maxBytes {
+			best, bestQuality = encoded.Bytes(), quality
+			low = quality + 1
+		} else {
+			high = quality - 1
+		}
+	}
+	if best != nil {
+		return best, bestQuality, nil
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, decodedImage, &jpeg.Options{Quality: 1}); err != nil {
+		return nil, 0, err
+	}
+	return encoded.Bytes(), 1, ErrJPEGTargetSizeExceeded
+}
+
+//WriteJPEGTargetSize writes the image as a JPEG of the highest quality which fits in maxBytes, returning the quality
+//used, if it doesn't fit at any quality the lowest quality JPEG is written and ErrJPEGTargetSizeExceeded returned
+func WriteJPEGTargetSize(decodedImage image.Image, outputPath string, maxBytes int64) (int, error) {
+	encoded, quality, encodeErr := EncodeJPEGTargetSize(decodedImage, maxBytes)
+	if encoded == nil {
+		return 0, encodeErr
+	}
+	if err := writeImageFile(outputPath, func(w io.Writer) error {
+		_, err := w.Write(encoded)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return quality, encodeErr
+}
+
+//ConvertToJPEGTargetSize decodes the image and writes it as a JPEG no larger than maxBytes, see WriteJPEGTargetSize
+func ConvertToJPEGTargetSize(ti TiffImage, outputPath string, maxBytes int64) error {
+	defer ti.GetRawImage().File.Close()
+	decodedImage, err := ti.Decode()
+	if err != nil {
+		return err
+	}
+	_, err = WriteJPEGTargetSize(decodedImage, outputPath, maxBytes)
+	return err
+}
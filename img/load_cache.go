@@ -0,0 +1,35 @@
+package img
+
+import "sync"
+
+//loadCache remembers that an image has been loaded, so loading it again, say once to estimate its memory and again
+//to decode it, doesn't read and parse the file a second time. It's shared by every copy of the RawImage
+type loadCache struct {
+	mu     sync.Mutex
+	loaded bool
+}
+
+//loadCachesMutex guards giving a RawImage its cache, for images which weren't created by NewImage
+var loadCachesMutex sync.Mutex
+
+//loadOnce calls load unless a call has already succeeded, it's safe to call from more than one goroutine at once
+//with the others waiting for the load to finish. Failed loads aren't remembered, so they're tried again
+func (ri *RawImage) loadOnce(load func() error) error {
+	loadCachesMutex.Lock()
+	if ri.loadCache == nil {
+		ri.loadCache = &loadCache{}
+	}
+	cache := ri.loadCache
+	loadCachesMutex.Unlock()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.loaded {
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	cache.loaded = true
+	return nil
+}
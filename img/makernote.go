@@ -0,0 +1,114 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+//MakerNote tag values shared across formats
+const (
+	nikonSerialNumberTag uint16 = 0x001d
+	canonSerialNumberTag uint16 = 0x000c
+)
+
+//makerNoteEntry is a single IFD entry of a manufacturer's MakerNote
+type makerNoteEntry struct {
+	dataFormat    uint8
+	numOfElements uint64
+	valueField    []byte
+}
+
+//readMakerNoteEntries reads the entries of a MakerNote IFD at the offset, keyed by tag, these are laid out like
+//any other IFD but their byte order and offset base vary between manufacturers
+func readMakerNoteEntries(reader io.ReaderAt, ifdOffset uint64, tiffHeaderData TiffHeader) map[uint16]makerNoteEntry {
+	entries := map[uint16]makerNoteEntry{}
+	ifdData, err := readIFDBytes(reader, ifdOffset, tiffHeaderData)
+	if err != nil {
+		return entries
+	}
+	entrySize := tiffHeaderData.ifdEntrySize()
+	for i := 0; i+entrySize <= len(ifdData); i += entrySize {
+		tag := utils.ConvertBytesToUInt16(ifdData[i], ifdData[i+1], tiffHeaderData.EndianOrder)
+		dataFormat := utils.ConvertBytesToUInt16(ifdData[i+2], ifdData[i+3], tiffHeaderData.EndianOrder)
+		numOfElements, valueField := splitIFDEntry(ifdData[i:i+entrySize], tiffHeaderData)
+		entries[tag] = makerNoteEntry{
+			dataFormat:    uint8(dataFormat),
+			numOfElements: numOfElements,
+			valueField:    valueField,
+		}
+	}
+	return entries
+}
+
+//unsignedValue decodes the entry's first element, if it's an unsigned int
+func (mne makerNoteEntry) unsignedValue(endianOrder utils.EndianOrder) (uint64, error) {
+	return readUnsignedValue(mne.valueField, mne.dataFormat, endianOrder)
+}
+
+//data reads all of the entry's element data, offsets are relative to baseOffset which is where the manufacturer
+//counts them from, either the TIFF header or the MakerNote itself. Data which would run past the end of the reader
+//is read as nil
+func (mne makerNoteEntry) data(reader io.ReaderAt, baseOffset uint64, endianOrder utils.EndianOrder) []byte {
+	length, ok := entryDataLength(mne.dataFormat, mne.numOfElements)
+	if !ok {
+		return nil
+	}
+	if length <= uint64(len(mne.valueField)) {
+		data := make([]byte, length)
+		copy(data, mne.valueField)
+		return data
+	}
+	offset := baseOffset + readOffset(mne.valueField, endianOrder)
+	if offset < baseOffset || !fitsInReader(reader, offset, length) {
+		return nil
+	}
+	data := make([]byte, length)
+	reader.ReadAt(data, int64(offset))
+	return data
+}
+
+//readMakerNoteSerialNumber reads the body serial number from Nikon and Canon MakerNotes, as older bodies of both
+//leave the EXIF serial number tag out
+func (ri *RawImage) readMakerNoteSerialNumber(reader io.ReaderAt) {
+	makerNoteIFD := ri.GetMakerNoteIFD()
+	if makerNoteIFD == nil || len(ri.Ifds) == 0 {
+		return
+	}
+	prefix := make([]byte, 10)
+	if _, err := reader.ReadAt(prefix, int64(makerNoteIFD.MakerNoteOffset)); err != nil {
+		return
+	}
+
+	switch {
+	case bytes.HasPrefix(prefix, []byte("Nikon\x00")):
+		//after the version is a TIFF header of its own, which offsets in the MakerNote are from
+		tiffHeaderOffset := makerNoteIFD.MakerNoteOffset + 10
+		headerBytes := make([]byte, 8)
+		if _, err := reader.ReadAt(headerBytes, int64(tiffHeaderOffset)); err != nil {
+			return
+		}
+		makerNoteHeader, err := parseHeaderBytes(headerBytes)
+		if err != nil {
+			return
+		}
+		entries := readMakerNoteEntries(reader, tiffHeaderOffset+makerNoteHeader.TiffOffset, makerNoteHeader)
+		if entry, ok := entries[nikonSerialNumberTag]; ok && entry.dataFormat == asciiStringsType {
+			makerNoteIFD.MakerNoteSerialNumber = entry.data(reader, tiffHeaderOffset, makerNoteHeader.EndianOrder)
+		}
+	case bytes.HasPrefix(bytes.ToUpper(ri.Ifds[0].ImageMakeTag), []byte("CANON")):
+		//Canon's MakerNote is a bare IFD in the file's byte order, with the serial number stored as a number
+		entries := readMakerNoteEntries(reader, makerNoteIFD.MakerNoteOffset, TiffHeader{EndianOrder: ri.Header.EndianOrder})
+		if entry, ok := entries[canonSerialNumberTag]; ok {
+			if serialNumber, err := entry.unsignedValue(ri.Header.EndianOrder); err == nil {
+				makerNoteIFD.MakerNoteSerialNumber = []byte(fmt.Sprintf("%010d", serialNumber))
+			}
+		}
+	}
+	if len(makerNoteIFD.MakerNoteSerialNumber) > 0 {
+		logging.Debug(fmt.Sprintf("MakerNote serial number -> %s", makerNoteIFD.MakerNoteSerialNumber))
+	}
+}
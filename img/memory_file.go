@@ -0,0 +1,63 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+//MemoryFile is an ImageFile held in memory, for images which don't come from a file on disk, like uploads
+type MemoryFile struct {
+	*bytes.Reader
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+//NewMemoryFile creates a MemoryFile of the data, the name is only used to label it
+func NewMemoryFile(name string, data []byte) *MemoryFile {
+	return &MemoryFile{Reader: bytes.NewReader(data), name: name, size: int64(len(data)), modTime: time.Now()}
+}
+
+func (mf *MemoryFile) Name() string {
+	return mf.name
+}
+
+func (mf *MemoryFile) Stat() (os.FileInfo, error) {
+	return memoryFileInfo{mf}, nil
+}
+
+func (mf *MemoryFile) Close() error {
+	return nil
+}
+
+//memoryFileInfo describes a MemoryFile as if it were a regular file
+type memoryFileInfo struct {
+	mf *MemoryFile
+}
+
+func (mfi memoryFileInfo) Name() string       { return path.Base(mfi.mf.name) }
+func (mfi memoryFileInfo) Size() int64        { return mfi.mf.size }
+func (mfi memoryFileInfo) Mode() os.FileMode  { return 0444 }
+func (mfi memoryFileInfo) ModTime() time.Time { return mfi.mf.modTime }
+func (mfi memoryFileInfo) IsDir() bool        { return false }
+func (mfi memoryFileInfo) Sys() interface{}   { return nil }
+
+//OpenBytes creates the image type registered under the file extension from data already in memory, the image is
+//named "image" with the extension, so outputs named after it are image.jpg and so on. Load has to be called as with
+//any other image
+func OpenBytes(ext string, data []byte) (TiffImage, error) {
+	ext = normaliseExtension(ext)
+	ti, ok := NewImage(ext, RawImage{File: NewMemoryFile("image"+ext, data)})
+	if !ok {
+		return nil, fmt.Errorf("Image type %s not registered", ext)
+	}
+	return ti, nil
+}
+
+//NewNefImageFromBytes creates a NefImage from data already in memory, named image.nef
+func NewNefImageFromBytes(data []byte) *NefImage {
+	return &NefImage{RawImage: RawImage{File: NewMemoryFile("image.nef", data), loadCache: &loadCache{}}}
+}
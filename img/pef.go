@@ -0,0 +1,145 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+//Pentax MakerNote tag values
+const (
+	pentaxPreviewImageLengthTag uint16 = 0x0003
+	pentaxPreviewImageStartTag  uint16 = 0x0004
+	pentaxModelIDTag            uint16 = 0x0005
+)
+
+//PefImage is a Pentax raw, which is TIFF based, with its largest JPEG preview referenced from the Pentax MakerNote
+type PefImage struct {
+	RawImage
+	PentaxModelID      uint32
+	PreviewImageStart  uint64
+	PreviewImageLength uint32
+}
+
+func (pi *PefImage) GetRawImage() RawImage {
+	return pi.RawImage
+}
+
+func (pi *PefImage) Load() error {
+	return pi.loadOnce(pi.load)
+}
+
+func (pi *PefImage) load() error {
+	if err := pi.RawImage.load(); err != nil {
+		return err
+	}
+	pi.PentaxModelID, pi.PreviewImageStart, pi.PreviewImageLength = 0, 0, 0
+	makerNoteIFD := pi.GetMakerNoteIFD()
+	if makerNoteIFD == nil {
+		return nil
+	}
+	pi.parsePentaxMakerNote(makerNoteIFD.MakerNoteOffset, makerNoteIFD.MakerNoteLength)
+
+	//the standard model tag is occasionally blank, the MakerNote's model ID is always set
+	if len(pi.Ifds) > 0 && len(bytes.Trim(pi.Ifds[0].ImageModelTag, "\x00 ")) == 0 && pi.PentaxModelID != 0 {
+		pi.Ifds[0].ImageModelTag = []byte(fmt.Sprintf("PENTAX model 0x%05x", pi.PentaxModelID))
+	}
+	return nil
+}
+
+func (pi *PefImage) Decode() (image.Image, error) {
+	if err := pi.Load(); err != nil {
+		return nil, err
+	}
+	previewIFD := pi.GetLargestPreviewIFD()
+	//the MakerNote's preview is usually the largest
+	if pi.PreviewImageLength > 0 && (previewIFD == nil || pi.PreviewImageLength > previewIFD.JpegFromRawLength) {
+		previewIFD = &TiffIFD{JpegFromRawStart: pi.PreviewImageStart, JpegFromRawLength: pi.PreviewImageLength}
+	}
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	return pi.decodePreview(previewIFD)
+}
+
+func (pi *PefImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := pi.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (pi *PefImage) WritePNG(w io.Writer) error {
+	decodedImage, err := pi.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (pi *PefImage) ConvertToJPEG(outputPath string) error {
+	defer pi.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return pi.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (pi *PefImage) ConvertToPNG(outputPath string) error {
+	defer pi.RawImage.File.Close()
+	return writeImageFile(outputPath, pi.WritePNG)
+}
+
+//parsePentaxMakerNote reads the model ID and preview location from the MakerNote, which starts with either
+//"AOC\0" and has offsets from the TIFF header, or "PENTAX \0" and has offsets from the MakerNote itself
+func (pi *PefImage) parsePentaxMakerNote(makerNoteOffset uint64, makerNoteLength uint32) {
+	prefix := make([]byte, 10)
+	if _, err := pi.File.ReadAt(prefix, int64(makerNoteOffset)); err != nil || makerNoteLength < uint32(len(prefix)) {
+		logging.Debug("Unable to read Pentax MakerNote")
+		return
+	}
+
+	makerNoteHeader := TiffHeader{EndianOrder: pi.Header.EndianOrder}
+	var ifdOffset, baseOffset uint64
+	switch {
+	case bytes.HasPrefix(prefix, []byte("AOC\x00")):
+		if endianOrder, err := utils.DetectEndian(prefix[4:6]); err == nil {
+			makerNoteHeader.EndianOrder = endianOrder
+		}
+		ifdOffset = makerNoteOffset + 6
+	case bytes.HasPrefix(prefix, []byte("PENTAX \x00")):
+		if endianOrder, err := utils.DetectEndian(prefix[8:10]); err == nil {
+			makerNoteHeader.EndianOrder = endianOrder
+		}
+		ifdOffset, baseOffset = makerNoteOffset+10, makerNoteOffset
+	default:
+		logging.Debug("Pentax MakerNote header not recognised")
+		return
+	}
+
+	entries := readMakerNoteEntries(pi.File, ifdOffset, makerNoteHeader)
+	if entry, ok := entries[pentaxModelIDTag]; ok {
+		if modelID, err := entry.unsignedValue(makerNoteHeader.EndianOrder); err == nil {
+			logging.Debug(fmt.Sprintf("Pentax model ID -> 0x%05x", modelID))
+			pi.PentaxModelID = uint32(modelID)
+		}
+	}
+	previewStartEntry, hasStart := entries[pentaxPreviewImageStartTag]
+	previewLengthEntry, hasLength := entries[pentaxPreviewImageLengthTag]
+	if !hasStart || !hasLength {
+		return
+	}
+	previewStart, startErr := previewStartEntry.unsignedValue(makerNoteHeader.EndianOrder)
+	previewLength, lengthErr := previewLengthEntry.unsignedValue(makerNoteHeader.EndianOrder)
+	if startErr == nil && lengthErr == nil {
+		logging.Debug(fmt.Sprintf("Pentax preview start -> %d length -> %d", baseOffset+previewStart, previewLength))
+		pi.PreviewImageStart = baseOffset + previewStart
+		pi.PreviewImageLength = uint32(previewLength)
+	}
+}
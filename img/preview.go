@@ -0,0 +1,103 @@
+package img
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"io"
+)
+
+//ErrNoPreview is returned when an image has no embedded JPEG preview or thumbnail
+var ErrNoPreview = errors.New("No embedded preview image found")
+
+//Preview is a JPEG embedded in an image, along with its dimensions
+type Preview struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+//GetThumbnail returns the smallest JPEG embedded in the image, which is usually the thumbnail in IFD1, or
+//ErrNoPreview if it has none. Load must have been called first
+func (ri *RawImage) GetThumbnail() ([]byte, error) {
+	fileStats, err := ri.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readThumbnail(ri.File, fileStats.Size(), ri.Ifds)
+}
+
+//GetPreviews returns every JPEG embedded in the image, in IFD order, or ErrNoPreview if it has none. Load must
+//have been called first
+func (ri *RawImage) GetPreviews() ([]Preview, error) {
+	fileStats, err := ri.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readPreviews(ri.File, fileStats.Size(), ri.Ifds)
+}
+
+//readThumbnail reads the smallest valid JPEG referenced by the IFDs, whose offsets are counted from the start of reader
+func readThumbnail(reader io.ReaderAt, size int64, ifds []TiffIFD) ([]byte, error) {
+	var thumbnail []byte
+	for _, ifd := range previewRefs(size, ifds) {
+		if thumbnail != nil && int(ifd.JpegFromRawLength) >= len(thumbnail) {
+			continue
+		}
+		if data, err := readPreviewData(reader, ifd); err == nil {
+			thumbnail = data
+		}
+	}
+	if thumbnail == nil {
+		return nil, ErrNoPreview
+	}
+	return thumbnail, nil
+}
+
+//readPreviews reads the valid JPEGs referenced by the IFDs, whose offsets are counted from the start of reader
+func readPreviews(reader io.ReaderAt, size int64, ifds []TiffIFD) ([]Preview, error) {
+	var previews []Preview
+	for _, ifd := range previewRefs(size, ifds) {
+		data, err := readPreviewData(reader, ifd)
+		if err != nil {
+			continue
+		}
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		previews = append(previews, Preview{Width: config.Width, Height: config.Height, Data: data})
+	}
+	if len(previews) == 0 {
+		return nil, ErrNoPreview
+	}
+	return previews, nil
+}
+
+//previewRefs returns the IFDs referencing an embedded JPEG which fits inside size, skipping any which point at
+//one already returned
+func previewRefs(size int64, ifds []TiffIFD) []*TiffIFD {
+	var refs []*TiffIFD
+	seenStarts := map[uint64]bool{}
+	for i := range ifds {
+		ifd := &ifds[i]
+		if ifd.JpegFromRawLength == 0 || seenStarts[ifd.JpegFromRawStart] || ifd.JpegFromRawStart+uint64(ifd.JpegFromRawLength) > uint64(size) {
+			continue
+		}
+		seenStarts[ifd.JpegFromRawStart] = true
+		refs = append(refs, ifd)
+	}
+	return refs
+}
+
+//readPreviewData reads the JPEG referenced by the IFD, checking it starts with an SOI marker
+func readPreviewData(reader io.ReaderAt, ifd *TiffIFD) ([]byte, error) {
+	data := make([]byte, ifd.JpegFromRawLength)
+	if _, err := reader.ReadAt(data, int64(ifd.JpegFromRawStart)); err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != jpegMarkerPrefix || data[1] != jpegSOIMarker {
+		return nil, errors.New("Embedded preview isn't a JPEG")
+	}
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package img
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	imageTypesMutex sync.RWMutex
+	imageTypes      = map[string]func(RawImage) TiffImage{}
+)
+
+func init() {
+	Register(".nef", func(ri RawImage) TiffImage { return &NefImage{RawImage: ri} })
+	Register(".nrw", func(ri RawImage) TiffImage { return &NrwImage{RawImage: ri} })
+	Register(".crw", func(ri RawImage) TiffImage { return &CrwImage{RawImage: ri} })
+	Register(".x3f", func(ri RawImage) TiffImage { return &X3fImage{RawImage: ri} })
+	Register(".pef", func(ri RawImage) TiffImage { return &PefImage{RawImage: ri} })
+	Register(".srw", func(ri RawImage) TiffImage { return &SrwImage{RawImage: ri} })
+	Register(".3fr", func(ri RawImage) TiffImage { return &HasselbladImage{RawImage: ri} })
+	Register(".jpg", func(ri RawImage) TiffImage { return &JpegImage{RawImage: ri} })
+	Register(".jpeg", func(ri RawImage) TiffImage { return &JpegImage{RawImage: ri} })
+	Register(".tif", func(ri RawImage) TiffImage { return &TiffFileImage{RawImage: ri} })
+	Register(".tiff", func(ri RawImage) TiffImage { return &TiffFileImage{RawImage: ri} })
+}
+
+//Register makes an image type available under the file extension, so the tools pick up files with it, newFn is
+//given a RawImage with just its File set. Packages outside of clover call this from an init function to add their
+//own formats. Like database/sql's Register, it panics if newFn is nil or the extension is already registered
+func Register(ext string, newFn func(RawImage) TiffImage) {
+	ext = normaliseExtension(ext)
+	if newFn == nil {
+		panic("img: Register image type constructor is nil")
+	}
+	imageTypesMutex.Lock()
+	defer imageTypesMutex.Unlock()
+	if _, dup := imageTypes[ext]; dup {
+		panic(fmt.Sprintf("img: Register called twice for image type %s", ext))
+	}
+	imageTypes[ext] = newFn
+}
+
+//NewImage creates the image type registered under the file extension, returning false if there isn't one
+func NewImage(ext string, ri RawImage) (TiffImage, bool) {
+	imageTypesMutex.RLock()
+	newFn, ok := imageTypes[normaliseExtension(ext)]
+	imageTypesMutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	//given its cache up front, so loading it from more than one goroutine at once can't race to create it
+	ri.loadCache = &loadCache{}
+	return newFn(ri), true
+}
+
+//RegisteredTypes returns the sorted file extensions of all the registered image types
+func RegisteredTypes() []string {
+	imageTypesMutex.RLock()
+	defer imageTypesMutex.RUnlock()
+	exts := make([]string, 0, len(imageTypes))
+	for ext := range imageTypes {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+func normaliseExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
@@ -0,0 +1,112 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/tacusci/logging"
+)
+
+//Samsung MakerNote tag values
+const (
+	samsungModelIDTag  uint16 = 0x0003
+	samsungLensTypeTag uint16 = 0xa003
+)
+
+//SrwImage is a Samsung raw, which is TIFF based, the MakerNote fills in the model and lens when the standard
+//tags are left blank
+type SrwImage struct {
+	RawImage
+	SamsungModelID uint32
+	LensType       uint16
+}
+
+func (si *SrwImage) GetRawImage() RawImage {
+	return si.RawImage
+}
+
+func (si *SrwImage) Load() error {
+	return si.loadOnce(si.load)
+}
+
+func (si *SrwImage) load() error {
+	if err := si.RawImage.load(); err != nil {
+		return err
+	}
+	si.SamsungModelID, si.LensType = 0, 0
+	makerNoteIFD := si.GetMakerNoteIFD()
+	if makerNoteIFD == nil {
+		return nil
+	}
+	si.parseSamsungMakerNote(makerNoteIFD.MakerNoteOffset)
+
+	if len(si.Ifds) > 0 && len(bytes.Trim(si.Ifds[0].ImageModelTag, "\x00 ")) == 0 && si.SamsungModelID != 0 {
+		si.Ifds[0].ImageModelTag = []byte(fmt.Sprintf("SAMSUNG model 0x%07x", si.SamsungModelID))
+	}
+	if len(bytes.Trim(makerNoteIFD.LensModelTag, "\x00 ")) == 0 && si.LensType != 0 {
+		makerNoteIFD.LensModelTag = []byte(fmt.Sprintf("Samsung lens type %d", si.LensType))
+	}
+	return nil
+}
+
+func (si *SrwImage) Decode() (image.Image, error) {
+	if err := si.Load(); err != nil {
+		return nil, err
+	}
+	previewIFD := si.GetLargestPreviewIFD()
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	return si.decodePreview(previewIFD)
+}
+
+func (si *SrwImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := si.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (si *SrwImage) WritePNG(w io.Writer) error {
+	decodedImage, err := si.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (si *SrwImage) ConvertToJPEG(outputPath string) error {
+	defer si.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return si.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (si *SrwImage) ConvertToPNG(outputPath string) error {
+	defer si.RawImage.File.Close()
+	return writeImageFile(outputPath, si.WritePNG)
+}
+
+//parseSamsungMakerNote reads the model ID and lens type from the MakerNote, which is a bare IFD in the file's
+//byte order
+func (si *SrwImage) parseSamsungMakerNote(makerNoteOffset uint64) {
+	makerNoteHeader := TiffHeader{EndianOrder: si.Header.EndianOrder}
+	entries := readMakerNoteEntries(si.File, makerNoteOffset, makerNoteHeader)
+	if entry, ok := entries[samsungModelIDTag]; ok {
+		if modelID, err := entry.unsignedValue(makerNoteHeader.EndianOrder); err == nil {
+			logging.Debug(fmt.Sprintf("Samsung model ID -> 0x%07x", modelID))
+			si.SamsungModelID = uint32(modelID)
+		}
+	}
+	if entry, ok := entries[samsungLensTypeTag]; ok {
+		if lensType, err := entry.unsignedValue(makerNoteHeader.EndianOrder); err == nil {
+			logging.Debug(fmt.Sprintf("Samsung lens type -> %d", lensType))
+			si.LensType = uint16(lensType)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package img
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+//TiffFileImage is a plain TIFF file, such as one exported from an editor, only its EXIF and any embedded JPEG
+//preview can be read
+type TiffFileImage struct {
+	RawImage
+}
+
+func (ti *TiffFileImage) GetRawImage() RawImage {
+	return ti.RawImage
+}
+
+func (ti *TiffFileImage) Load() error {
+	return ti.RawImage.Load()
+}
+
+func (ti *TiffFileImage) Decode() (image.Image, error) {
+	if err := ti.Load(); err != nil {
+		return nil, err
+	}
+	previewIFD := ti.GetLargestPreviewIFD()
+	if previewIFD == nil {
+		return nil, errors.New("TIFF decoding not supported and no embedded preview image found")
+	}
+	return ti.decodePreview(previewIFD)
+}
+
+func (ti *TiffFileImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := ti.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (ti *TiffFileImage) WritePNG(w io.Writer) error {
+	decodedImage, err := ti.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (ti *TiffFileImage) ConvertToJPEG(outputPath string) error {
+	defer ti.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return ti.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (ti *TiffFileImage) ConvertToPNG(outputPath string) error {
+	defer ti.RawImage.File.Close()
+	return writeImageFile(outputPath, ti.WritePNG)
+}
@@ -0,0 +1,231 @@
+package img
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+//Grayscale converts the image to luminance weighted grayscale, using the ITU-R BT.601 weights of color.GrayModel
+func Grayscale(src image.Image) *image.Gray {
+	bounds := src.Bounds()
+	gray := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.SetGray(x, y, color.GrayModel.Convert(src.At(x, y)).(color.Gray))
+		}
+	}
+	return gray
+}
+
+//AdjustBrightnessContrast shifts the brightness and scales the contrast of the image around mid gray, both are
+//from -100 to 100 where 0 leaves the image as it was, -100 contrast flattens it to gray and 100 doubles it
+func AdjustBrightnessContrast(src image.Image, brightness int, contrast int) image.Image {
+	brightness, contrast = clampInt(brightness, -100, 100), clampInt(contrast, -100, 100)
+	offset := float64(brightness) / 100 * 0xffff
+	factor := 1 + float64(contrast)/100
+	//every channel value maps the same way, so work them all out once
+	lookup := make([]uint16, 0x10000)
+	for value := range lookup {
+		adjusted := (float64(value)-0x8000)*factor + 0x8000 + offset
+		lookup[value] = uint16(clampFloat(adjusted, 0, 0xffff) + 0.5)
+	}
+
+	bounds := src.Bounds()
+	if gray, ok := src.(*image.Gray); ok {
+		adjustedGray := image.NewGray(bounds)
+		for i, value := range gray.Pix {
+			adjustedGray.Pix[i] = uint8(lookup[uint16(value)*0x101] >> 8)
+		}
+		return adjustedGray
+	}
+
+	adjusted := image.NewNRGBA64(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(src.At(x, y)).(color.NRGBA64)
+			adjusted.SetNRGBA64(x, y, color.NRGBA64{R: lookup[c.R], G: lookup[c.G], B: lookup[c.B], A: c.A})
+		}
+	}
+	return adjusted
+}
+
+//Rotate turns the image clockwise by the degrees, which must be 0, 90, 180 or 270
+func Rotate(src image.Image, degrees int) (image.Image, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var rotated draw.Image
+	var mapPoint func(x, y int) (int, int)
+	switch degrees {
+	case 0:
+		return src, nil
+	case 90:
+		rotated = newImageLike(src, image.Rect(0, 0, height, width))
+		mapPoint = func(x, y int) (int, int) { return height - 1 - y, x }
+	case 180:
+		rotated = newImageLike(src, image.Rect(0, 0, width, height))
+		mapPoint = func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }
+	case 270:
+		rotated = newImageLike(src, image.Rect(0, 0, height, width))
+		mapPoint = func(x, y int) (int, int) { return y, width - 1 - x }
+	default:
+		return nil, fmt.Errorf("Rotation of %d degrees not supported, must be 0, 90, 180 or 270", degrees)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rx, ry := mapPoint(x, y)
+			rotated.Set(rx, ry, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return rotated, nil
+}
+
+//Flip mirrors the image, left to right if horizontal, otherwise top to bottom
+func Flip(src image.Image, horizontal bool) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	flipped := newImageLike(src, image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := x, height-1-y
+			if horizontal {
+				fx, fy = width-1-x, y
+			}
+			flipped.Set(fx, fy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return flipped
+}
+
+//CropToAspectRatio center crops the image to the largest rectangle with the ratio of ratioWidth to ratioHeight
+func CropToAspectRatio(src image.Image, ratioWidth int, ratioHeight int) (image.Image, error) {
+	if ratioWidth <= 0 || ratioHeight <= 0 {
+		return nil, fmt.Errorf("Aspect ratio %d:%d not supported, both sides must be above 0", ratioWidth, ratioHeight)
+	}
+	bounds := src.Bounds()
+	width, height := int64(bounds.Dx()), int64(bounds.Dy())
+	cropWidth, cropHeight := width, height
+	if width*int64(ratioHeight) > height*int64(ratioWidth) {
+		cropWidth = (height*int64(ratioWidth) + int64(ratioHeight)/2) / int64(ratioHeight)
+	} else {
+		cropHeight = (width*int64(ratioHeight) + int64(ratioWidth)/2) / int64(ratioWidth)
+	}
+	if cropWidth < 1 {
+		cropWidth = 1
+	}
+	if cropHeight < 1 {
+		cropHeight = 1
+	}
+	minX := bounds.Min.X + int((width-cropWidth)/2)
+	minY := bounds.Min.Y + int((height-cropHeight)/2)
+	cropBounds := image.Rect(minX, minY, minX+int(cropWidth), minY+int(cropHeight))
+	if subImager, ok := src.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return subImager.SubImage(cropBounds), nil
+	}
+	cropped := newImageLike(src, image.Rect(0, 0, cropBounds.Dx(), cropBounds.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), src, cropBounds.Min, draw.Src)
+	return cropped, nil
+}
+
+//AddBorder surrounds the image with a border of the color, which is borderWidth pixels wide on every side
+func AddBorder(src image.Image, borderWidth int, borderColor color.Color) image.Image {
+	if borderWidth <= 0 {
+		return src
+	}
+	bounds := src.Bounds()
+	canvasBounds := image.Rect(0, 0, bounds.Dx()+borderWidth*2, bounds.Dy()+borderWidth*2)
+	var canvas draw.Image
+	//grayscale images only stay grayscale if the border is an opaque gray too
+	if gray := color.GrayModel.Convert(borderColor); color.RGBA64Model.Convert(gray) == color.RGBA64Model.Convert(borderColor) {
+		canvas = newImageLike(src, canvasBounds)
+	} else {
+		canvas = image.NewRGBA64(canvasBounds)
+	}
+	draw.Draw(canvas, canvasBounds, image.NewUniform(borderColor), image.Point{}, draw.Src)
+	draw.Draw(canvas, bounds.Sub(bounds.Min).Add(image.Pt(borderWidth, borderWidth)), src, bounds.Min, draw.Src)
+	return canvas
+}
+
+//Downscale shrinks the image so neither side is longer than maxDimension, keeping its aspect ratio, by averaging
+//the pixels each output pixel covers. Images which already fit are returned as they are
+func Downscale(src image.Image, maxDimension int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return src
+	}
+	scaledWidth, scaledHeight := maxDimension, maxDimension
+	if width > height {
+		scaledHeight = int((int64(height)*int64(maxDimension) + int64(width)/2) / int64(width))
+	} else {
+		scaledWidth = int((int64(width)*int64(maxDimension) + int64(height)/2) / int64(height))
+	}
+	scaledWidth, scaledHeight = clampInt(scaledWidth, 1, maxDimension), clampInt(scaledHeight, 1, maxDimension)
+
+	scaled := newImageLike(src, image.Rect(0, 0, scaledWidth, scaledHeight))
+	for sy := 0; sy < scaledHeight; sy++ {
+		minY, maxY := sy*height/scaledHeight, (sy+1)*height/scaledHeight
+		for sx := 0; sx < scaledWidth; sx++ {
+			minX, maxX := sx*width/scaledWidth, (sx+1)*width/scaledWidth
+			var r, g, b, a, count uint64
+			for y := minY; y < maxY; y++ {
+				for x := minX; x < maxX; x++ {
+					pr, pg, pb, pa := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					r, g, b, a, count = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), count+1
+				}
+			}
+			scaled.Set(sx, sy, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: uint16(a / count)})
+		}
+	}
+	return scaled
+}
+
+//ParseHexColor parses a color in hex, in the 3 digit RGB, 6 digit RRGGBB or 8 digit RRGGBBAA forms, with or
+//without a leading #
+func ParseHexColor(hex string) (color.NRGBA, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) == 6 {
+		digits += "ff"
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if len(digits) != 8 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("Color %s not recognised, make sure it matches <RGB|RRGGBB|RRGGBBAA> in hex", hex)
+	}
+	return color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+//newImageLike creates an empty image with the bounds, keeping grayscale images grayscale
+func newImageLike(src image.Image, bounds image.Rectangle) draw.Image {
+	if _, ok := src.(*image.Gray); ok {
+		return image.NewGray(bounds)
+	}
+	return image.NewRGBA64(bounds)
+}
+
+func clampInt(value int, min int, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func clampFloat(value float64, min float64, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,260 @@
+package img
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf16"
+
+	"github.com/tacusci/clover/utils"
+	"github.com/tacusci/logging"
+)
+
+const (
+	x3fFileMagic            = "FOVb"
+	x3fDirectoryMagic       = "SECd"
+	x3fImageSectionMagic    = "SECi"
+	x3fPropertySectionMagic = "SECp"
+	//the header's columns and rows come after the magic, version, unique ID and mark bits
+	x3fColumnsOffset = 28
+	//image section data starts after its magic, version, type, format, columns, rows and row size
+	x3fImageHeaderSize = 28
+	//property section entries start after its magic, version, entry count, char format, reserved and total length
+	x3fPropertyHeaderSize = 24
+	x3fImageFormatJPEG    = 18
+	//stops a malformed directory from making us allocate for millions of entries
+	x3fMaxDirectoryEntries = 1024
+)
+
+//X3fImage is a Sigma Foveon raw, which uses its own FOVb container, only the embedded JPEG preview and the
+//property list are read, into a single IFD so everything else can treat it like any other raw
+type X3fImage struct {
+	RawImage
+	Properties map[string]string
+}
+
+type x3fDirectoryEntry struct {
+	offset      uint32
+	length      uint32
+	sectionType string
+}
+
+func (xi *X3fImage) GetRawImage() RawImage {
+	return xi.RawImage
+}
+
+func (xi *X3fImage) Load() error {
+	return xi.loadOnce(xi.load)
+}
+
+func (xi *X3fImage) load() error {
+	logging.Debug(fmt.Sprintf("\nParsing %s X3F image data", xi.File.Name()))
+	fileStats, err := xi.File.Stat()
+	if err != nil {
+		return err
+	}
+	headerBytes, err := readHeaderBytes(xi.File, fileStats.Size())
+	if err != nil {
+		return err
+	}
+	if string(headerBytes[:4]) != x3fFileMagic {
+		return errors.New("Not an X3F image, missing FOVb magic")
+	}
+
+	//X3F is always little endian
+	endianReader := utils.NewEndianReader(xi.File, utils.LittleEndian)
+	xi.Header = TiffHeader{EndianOrder: utils.LittleEndian}
+	//loading again re-reads the sections rather than adding to them
+	xi.Ifds = nil
+	xi.Properties = map[string]string{}
+	ifd := TiffIFD{}
+	if ifd.ImageWidth, err = endianReader.Uint32(x3fColumnsOffset); err != nil {
+		return err
+	}
+	if ifd.ImageHeight, err = endianReader.Uint32(x3fColumnsOffset + 4); err != nil {
+		return err
+	}
+
+	directoryEntries, err := readX3fDirectory(xi.File, fileStats.Size())
+	if err != nil {
+		return err
+	}
+	for _, entry := range directoryEntries {
+		if int64(entry.offset)+int64(entry.length) > fileStats.Size() {
+			logging.Debug(fmt.Sprintf("Skipping X3F %s section, it runs past the end of the file", entry.sectionType))
+			continue
+		}
+		switch entry.sectionType {
+		case "IMAG", "IMA2":
+			if string(readX3fMagic(xi.File, int64(entry.offset))) != x3fImageSectionMagic || entry.length <= x3fImageHeaderSize {
+				continue
+			}
+			imageFormat, err := endianReader.Uint32(int64(entry.offset) + 12)
+			if err != nil {
+				return err
+			}
+			//keep the largest of the JPEG previews
+			if imageFormat == x3fImageFormatJPEG && entry.length-x3fImageHeaderSize > ifd.JpegFromRawLength {
+				ifd.JpegFromRawStart = uint64(entry.offset) + x3fImageHeaderSize
+				ifd.JpegFromRawLength = entry.length - x3fImageHeaderSize
+			}
+		case "PROP":
+			if err := readX3fProperties(xi.File, int64(entry.offset), int64(entry.length), xi.Properties); err != nil {
+				logging.Debug(fmt.Sprintf("Unable to read X3F properties (%s)", err.Error()))
+			}
+		}
+	}
+
+	ifd.ImageMakeTag = []byte(xi.Properties["CAMMANUF"])
+	ifd.ImageModelTag = []byte(xi.Properties["CAMMODEL"])
+	ifd.SoftwareTextData = []byte(xi.Properties["FIRMVERS"])
+	//the capture time is seconds since the epoch on the camera's clock, so it's local time with no time zone like EXIF's
+	if timeStamp, err := strconv.ParseInt(xi.Properties["TIME"], 10, 64); err == nil {
+		ifd.DateTimeOriginalText = []byte(time.Unix(timeStamp, 0).UTC().Format(exifDateTimeLayout))
+	}
+	xi.Ifds = append(xi.Ifds, ifd)
+	return nil
+}
+
+func (xi *X3fImage) Decode() (image.Image, error) {
+	if err := xi.Load(); err != nil {
+		return nil, err
+	}
+	previewIFD := xi.GetLargestPreviewIFD()
+	if previewIFD == nil {
+		return nil, ErrNoPreview
+	}
+	return xi.decodePreview(previewIFD)
+}
+
+func (xi *X3fImage) WriteJPEG(w io.Writer, quality int) error {
+	decodedImage, err := xi.Decode()
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, decodedImage, &jpeg.Options{Quality: quality})
+}
+
+func (xi *X3fImage) WritePNG(w io.Writer) error {
+	decodedImage, err := xi.Decode()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, decodedImage)
+}
+
+func (xi *X3fImage) ConvertToJPEG(outputPath string) error {
+	defer xi.RawImage.File.Close()
+	return writeImageFile(outputPath, func(w io.Writer) error {
+		return xi.WriteJPEG(w, jpeg.DefaultQuality)
+	})
+}
+
+func (xi *X3fImage) ConvertToPNG(outputPath string) error {
+	defer xi.RawImage.File.Close()
+	return writeImageFile(outputPath, xi.WritePNG)
+}
+
+//readX3fDirectory reads the section directory, whose offset is stored in the file's last four bytes
+func readX3fDirectory(reader io.ReaderAt, fileSize int64) ([]x3fDirectoryEntry, error) {
+	endianReader := utils.NewEndianReader(reader, utils.LittleEndian)
+	directoryOffset, err := endianReader.Uint32(fileSize - 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(readX3fMagic(reader, int64(directoryOffset))) != x3fDirectoryMagic {
+		return nil, errors.New("X3F directory missing SECd magic")
+	}
+	entryCount, err := endianReader.Uint32(int64(directoryOffset) + 8)
+	if err != nil {
+		return nil, err
+	}
+	if entryCount > x3fMaxDirectoryEntries {
+		return nil, fmt.Errorf("X3F directory has too many entries (%d)", entryCount)
+	}
+
+	directoryEntries := make([]x3fDirectoryEntry, 0, entryCount)
+	for i := 0; i < int(entryCount); i++ {
+		entryStart := int64(directoryOffset) + 12 + int64(i*12)
+		entry := x3fDirectoryEntry{}
+		if entry.offset, err = endianReader.Uint32(entryStart); err != nil {
+			return nil, err
+		}
+		if entry.length, err = endianReader.Uint32(entryStart + 4); err != nil {
+			return nil, err
+		}
+		entry.sectionType = string(readX3fMagic(reader, entryStart+8))
+		directoryEntries = append(directoryEntries, entry)
+	}
+	return directoryEntries, nil
+}
+
+//readX3fProperties reads the name/value pairs of a property list section, which are stored as UTF-16 text
+func readX3fProperties(reader io.ReaderAt, sectionOffset int64, sectionLength int64, properties map[string]string) error {
+	if string(readX3fMagic(reader, sectionOffset)) != x3fPropertySectionMagic {
+		return errors.New("property section missing SECp magic")
+	}
+	endianReader := utils.NewEndianReader(reader, utils.LittleEndian)
+	entryCount, err := endianReader.Uint32(sectionOffset + 8)
+	if err != nil {
+		return err
+	}
+	charFormat, err := endianReader.Uint32(sectionOffset + 12)
+	if err != nil {
+		return err
+	}
+	if charFormat != 0 {
+		return fmt.Errorf("unsupported property character format %d", charFormat)
+	}
+	charDataStart := x3fPropertyHeaderSize + int64(entryCount)*8
+	if charDataStart > sectionLength {
+		return errors.New("property entries run past the end of the section")
+	}
+
+	charData := make([]byte, sectionLength-charDataStart)
+	if _, err := reader.ReadAt(charData, sectionOffset+charDataStart); err != nil && err != io.EOF {
+		return err
+	}
+	chars := make([]uint16, len(charData)/2)
+	for i := range chars {
+		chars[i] = utils.ConvertBytesSliceToUInt16(charData[i*2:i*2+2], utils.LittleEndian)
+	}
+
+	for i := 0; i < int(entryCount); i++ {
+		nameOffset, err := endianReader.Uint32(sectionOffset + x3fPropertyHeaderSize + int64(i*8))
+		if err != nil {
+			return err
+		}
+		valueOffset, err := endianReader.Uint32(sectionOffset + x3fPropertyHeaderSize + int64(i*8) + 4)
+		if err != nil {
+			return err
+		}
+		properties[x3fPropertyString(chars, nameOffset)] = x3fPropertyString(chars, valueOffset)
+	}
+	return nil
+}
+
+//x3fPropertyString returns the null terminated string starting offset chars into the property character data
+func x3fPropertyString(chars []uint16, offset uint32) string {
+	if int(offset) >= len(chars) {
+		return ""
+	}
+	end := int(offset)
+	for end < len(chars) && chars[end] != 0 {
+		end++
+	}
+	return string(utf16.Decode(chars[offset:end]))
+}
+
+func readX3fMagic(reader io.ReaderAt, offset int64) []byte {
+	magic := make([]byte, 4)
+	if _, err := reader.ReadAt(magic, offset); err != nil {
+		return nil
+	}
+	return magic
+}
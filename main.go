@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
 
+	"github.com/fatih/color"
 	"github.com/tacusci/clover/cltools"
+	"github.com/tacusci/clover/utils"
 	"github.com/tacusci/logging"
 )
 
@@ -18,7 +25,12 @@ func outputUsage() {
 	println("Usage: " + os.Args[0] + " </TOOLFLAG>")
 	fmt.Printf("\t/sdc (StorageDeviceChecker) - Tool for checking size of storage devices.\n")
 	fmt.Printf("\t/rtc (RawToCompressed) - Tool for batch compressing raw images.\n")
-	fmt.Printf("\t/tee (TIFFEXIFExport) - Tool for batch exporting of raw images EXIF data.")
+	fmt.Printf("\t/tee (TIFFEXIFExport) - Tool for batch exporting of raw images EXIF data.\n")
+	fmt.Printf("\t/gpx (GPXExport) - Tool for exporting raw images GPS locations as a GPX file.\n")
+	fmt.Printf("\t/stat (ImageStatistics) - Tool for printing counts of raw images per camera, lens and ISO.\n")
+	fmt.Printf("\t/serve (Serve) - Tool for converting raw images posted to a HTTP server.\n")
+	fmt.Printf("\tcompletion <bash|zsh|fish> - Generate a shell completion script for the tools and their flags.\n")
+	fmt.Printf("Exit codes: 0 success, 1 bad arguments, 2 some images failed, 3 all images failed (/rtc, /tee and /stat).\n")
 }
 
 func outputUsageAndClose() {
@@ -28,8 +40,11 @@ func outputUsageAndClose() {
 
 func setLoggingLevel() {
 	debugLevel := flag.Bool("debug", false, "Set logging to debug")
+	colorMode := flag.String("color", "auto", "When to color output <auto|always|never>, auto colors it if stdout is a terminal.")
 	flag.Parse()
 
+	setColorMode(*colorMode)
+
 	loggingLevel := logging.InfoLevel
 
 	if *debugLevel {
@@ -39,45 +54,283 @@ func setLoggingLevel() {
 	logging.SetLevel(loggingLevel)
 }
 
+//setColorMode turns colored output on or off for every tool, auto leaves it to the color package, which only colors
+//output written to a terminal
+func setColorMode(colorMode string) {
+	switch strings.ToLower(colorMode) {
+	case "auto":
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		logging.ErrorAndExit(fmt.Sprintf("Color mode %s not supported, must be auto, always or never", colorMode))
+	}
+}
+
+//startProfiling starts CPU profiling into the directory if it's set, returning a function which stops
+//it and writes a heap profile, profiling is skipped if the directory is empty
+func startProfiling(pprofDirectory string) func() {
+	if len(pprofDirectory) == 0 {
+		return func() {}
+	}
+
+	if err := os.MkdirAll(pprofDirectory, os.ModePerm); err != nil {
+		logging.Error(fmt.Sprintf("Unable to create profile directory -> %v", err))
+		return func() {}
+	}
+
+	cpuProfile, err := os.Create(filepath.Join(pprofDirectory, "cpu.pprof"))
+	if err != nil {
+		logging.Error(fmt.Sprintf("Unable to create CPU profile -> %v", err))
+		return func() {}
+	}
+	if err := pprof.StartCPUProfile(cpuProfile); err != nil {
+		logging.Error(fmt.Sprintf("Unable to start CPU profile -> %v", err))
+		cpuProfile.Close()
+		return func() {}
+	}
+
+	return func() {
+		pprof.StopCPUProfile()
+		cpuProfile.Close()
+
+		heapProfile, err := os.Create(filepath.Join(pprofDirectory, "heap.pprof"))
+		if err != nil {
+			logging.Error(fmt.Sprintf("Unable to create heap profile -> %v", err))
+			return
+		}
+		defer heapProfile.Close()
+		//get up to date allocation statistics
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(heapProfile); err != nil {
+			logging.Error(fmt.Sprintf("Unable to write heap profile -> %v", err))
+		}
+	}
+}
+
+//startSyslog sends the tool's output to the system logger if enabled, returning a function which sends whatever's
+//left and puts the output back, if the system logger can't be used the output is left as it is
+func startSyslog(enabled bool) func() {
+	if !enabled {
+		return func() {}
+	}
+	stop, err := utils.RedirectOutputToSyslog("clover")
+	if err != nil {
+		logging.Error(fmt.Sprintf("Unable to send output to syslog, writing it to stdout instead -> %v", err))
+		return func() {}
+	}
+	//colored output is written to the stdout there was when the color package started, not the current one
+	output, noColor := color.Output, color.NoColor
+	color.Output, color.NoColor = os.Stdout, true
+	return func() {
+		stop()
+		color.Output, color.NoColor = output, noColor
+	}
+}
+
 func main() {
 
 	if len(os.Args) == 1 {
 		outputUsageAndClose()
 	}
 
-	runTool(os.Args[1])
+	//not an image tool, so it's kept out of runTool's flags
+	if os.Args[1] == "completion" {
+		os.Exit(runCompletion(os.Args[2:]))
+	}
+
+	os.Exit(int(runTool(os.Args[1])))
 }
 
-func runTool(toolFlag string) {
+//runTool runs the tool picked by the flag, returning the code to exit with, which is only returned rather than
+//exited with straight away so profiling can be stopped first
+func runTool(toolFlag string) cltools.ExitCode {
 	//kind of hack to force flag parser to find tool argument flags correctly
 	os.Args = os.Args[1:]
+	pprofDirectory := flag.String("pprof", "", "Location to save CPU and heap profiles to.")
+	useSyslog := flag.Bool("syslog", false, "Send output to the system logger instead of stdout and stderr.")
 	switch toolFlag {
 	case "/sdc":
-		locationPath := flag.String("l", "", "Location to write data to.")
+		locationPath := flag.String("l", "", "Locations to write data to, comma separated to check several devices at once.")
+		workers := flag.Int("j", 0, "Number of locations to write to at once (0 for all of them).")
 		sizeToWrite := flag.Int("s", 0, "Size of total data to write.")
 		skipFileIntegrityCheck := flag.Bool("sic", false, "Skip verifying output file integrity.")
 		dontDeleteFiles := flag.Bool("nd", false, "Don't delete outputted files.")
+		fill := flag.Bool("fill", false, "Ignore size and keep writing data until the device is full.")
+		verifyOnly := flag.Bool("verify-only", false, "Skip writing and verify data files left by a previous run.")
+		pattern := flag.String("pattern", "mixed", "Data pattern to write and verify <mixed|zero|one|random|counting|alt>.")
+		csvPath := flag.String("csv", "", "Location to save CSV of per file write/read speeds.")
+		histogram := flag.Bool("hist", false, "Output a histogram of per file write speeds.")
+		retries := flag.Int("retries", 3, "Number of times to retry writing a file after a transient error.")
+		clean := flag.Bool("clean", false, "Skip writing and delete data files left by previous runs.")
+		recursive := flag.Bool("rs", false, "Clean data files in all sub folders of location recursively.")
+		assumeYes := flag.Bool("y", false, "Don't ask for confirmation before filling or cleaning.")
+		flag.BoolVar(assumeYes, "yes", false, "Same as -y.")
+		manifestPath := flag.String("manifest", "", "Location to save SHA-256 checksums of written files (use with -nd).")
+		verifyManifestPath := flag.String("verify-manifest", "", "Skip writing and verify data files against a saved manifest.")
+		force := flag.Bool("force", false, "Write even if size is larger than the location's free space.")
+		summary := flag.String("summary", "", "Location to save a JSON summary of the run, or - to write it to stderr.")
 		setLoggingLevel()
 
 		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		defer startSyslog(*useSyslog)()
 
-		cltools.RunSdc(*locationPath, *sizeToWrite, *skipFileIntegrityCheck, *dontDeleteFiles)
+		err := cltools.RunSdc(cltools.SdcOptions{
+			LocationPath:           *locationPath,
+			SizeToWrite:            *sizeToWrite,
+			SkipFileIntegrityCheck: *skipFileIntegrityCheck,
+			DontDeleteFiles:        *dontDeleteFiles,
+			Fill:                   *fill,
+			VerifyOnly:             *verifyOnly,
+			Pattern:                cltools.FillPattern(*pattern),
+			CsvPath:                *csvPath,
+			Histogram:              *histogram,
+			Retries:                *retries,
+			Clean:                  *clean,
+			Recursive:              *recursive,
+			AssumeYes:              *assumeYes,
+			ManifestPath:           *manifestPath,
+			VerifyManifestPath:     *verifyManifestPath,
+			Force:                  *force,
+			Summary:                *summary,
+			Workers:                *workers,
+		})
+		//nothing is written or deleted unless the options are valid and confirmed
+		if errors.Is(err, cltools.ErrMissingSdcOptions) {
+			flag.PrintDefaults()
+			return cltools.ExitBadArguments
+		} else if err != nil {
+			logging.Error(err.Error())
+			return cltools.ExitBadArguments
+		}
 	case "/rtc":
-		sourceDirectory := flag.String("id", "", "Location containing raw images to convert.")
+		sourceDirectory := flag.String("id", "", "Locations or zip archives containing raw images to convert, comma separated, or - to read a single raw image from stdin (use with -it and -stdout).")
 		outputDirectory := flag.String("od", "", "Location to save compressed images.")
 		inputType := flag.String("it", "", "Extension of image type to convert.")
-		outputType := flag.String("ot", "", "Extension of image type to output to.")
-		overwrite := flag.Bool("ow", false, "Overwrite existing images in output location.")
+		outputType := flag.String("ot", "", "Extensions of image types to output to, comma separated.")
+		onExist := flag.String("onexist", "skip", "What to do with existing images in output location <skip|overwrite|newer|rename|backup|smaller|larger>.")
+		overwrite := flag.Bool("ow", false, "Deprecated, same as -onexist overwrite.")
 		recursive := flag.Bool("rs", false, "Scan all sub folders in root recursively.")
 		retainFolderStructure := flag.Bool("fs", false, "Retain folder structure in output.")
 		showConversionOutput := flag.Bool("so", false, "Show conversion output.")
 		timeStamp := flag.Bool("ts", false, "Adds time stamp to show process duration in milliseconds in console output.")
+		since := flag.String("since", "", "Only convert images modified since a time, e.g. 2018-06-01, or the time saved in a state file.")
+		watch := flag.Bool("watch", false, "Keep converting new images as they're written to the location until interrupted.")
+		workers := flag.Int("jcpu", runtime.NumCPU(), "Number of images to decode and encode at once.")
+		flag.IntVar(workers, "j", runtime.NumCPU(), "Same as -jcpu.")
+		ioWorkers := flag.Int("jio", runtime.NumCPU(), "Number of images to open and read the metadata of at once, ahead of converting them.")
+		maxMemory := flag.String("maxmem", "0", "Cap on estimated memory used decoding images at once, e.g. 2G (0 for no cap).")
+		aspect := flag.String("aspect", "", "Center crop images to a width to height ratio, e.g. 16:9.")
+		gray := flag.Bool("gray", false, "Convert images to grayscale.")
+		brightness := flag.Int("brightness", 0, "Adjust image brightness, from -100 to 100.")
+		contrast := flag.Int("contrast", 0, "Adjust image contrast, from -100 to 100.")
+		rotate := flag.Int("rotate", 0, "Rotate images clockwise by 0, 90, 180 or 270 degrees.")
+		flip := flag.String("flip", "", "Flip images horizontally (h) or vertically (v).")
+		border := flag.Int("border", 0, "Width in pixels of a border to add around images.")
+		borderColor := flag.String("bordercolor", "fff", "Color of the border in hex, e.g. fff, 1e1e1e or 1e1e1eff.")
+		zipPath := flag.String("zip", "", "Path of zip archive to write images into instead of the output location.")
+		dpi := flag.Int("dpi", 0, "Resolution to write into images in DPI (0 to carry over the raw image's).")
+		progressive := flag.Bool("prog", false, "Write progressive JPEGs.")
+		noScan := flag.Bool("noscan", false, "Skip counting the images to convert before converting them.")
+		verifyOutput := flag.Bool("verify-output", false, "Decode each output after writing it, failing the image if it doesn't decode.")
+		verifyRetries := flag.Int("verify-retries", 0, "Number of times to write an output again after it doesn't decode (use with -verify-output).")
+		name := flag.String("name", "", "Template to name outputs with, {name} is the raw image's name and {seq} its number in path order, e.g. trip_{seq}.")
+		previewMax := flag.Int("preview-max", 0, "Convert the embedded preview instead of the raw data, downscaled to this many pixels on its longest side (0 to decode the raw data).")
+		minWidth := flag.Int("minw", 0, "Skip images narrower than this many pixels, e.g. stray thumbnails (0 for no minimum).")
+		minHeight := flag.Int("minh", 0, "Skip images shorter than this many pixels (0 for no minimum).")
+		toStdout := flag.Bool("stdout", false, "Write the single raw image given with -id to stdout as the one output type, e.g. -id photo.nef -ot .jpg -stdout > photo.jpg.")
+		copyProfile := flag.Bool("cp", false, "Embed the ICC color profile of raw images into outputs.")
+		copyGPS := flag.Bool("cg", false, "Copy the GPS location and time of raw images into JPEG outputs.")
+		list := flag.Bool("list", false, "Print the path of each image which would be converted and exit without converting.")
+		failFast := flag.Bool("fail-fast", false, "Stop converting once an image fails.")
+		summary := flag.String("summary", "", "Location to save a JSON summary of the run, or - to write it to stderr.")
+		from := flag.String("from", "", "File of newline separated images to convert instead of a location, or - to read them from stdin.")
+		maxSize := flag.String("maxsize", "0", "Largest size of JPEG outputs, e.g. 2M, quality is lowered to fit (0 for no limit).")
 		logging.OutputDateTime, logging.OutputPath, logging.OutputLogLevelFlag, logging.OutputArrowSuffix = false, false, false, false
 		setLoggingLevel()
 
 		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		if *toStdout && *useSyslog {
+			logging.ErrorAndExit("Writing images to stdout can't be combined with sending output to the system logger")
+		}
+		defer startSyslog(*useSyslog)()
+
+		if *overwrite {
+			//logged as an error as that goes to stderr, so it can't end up in an image written to stdout
+			logging.Error("-ow is deprecated, use -onexist overwrite instead")
+			//an -onexist given alongside it has to agree, as skip is the default it's only known to be given by
+			//visiting the flags which were set
+			onExistSet := false
+			flag.Visit(func(f *flag.Flag) {
+				onExistSet = onExistSet || f.Name == "onexist"
+			})
+			if onExistSet && *onExist != string(cltools.OnExistOverwrite) {
+				logging.ErrorAndExit(fmt.Sprintf("-ow can't be combined with -onexist %s", *onExist))
+			}
+			*onExist = string(cltools.OnExistOverwrite)
+		}
+
+		maxMemoryBytes, err := utils.ParseBytes(*maxMemory)
+		if err != nil {
+			logging.ErrorAndExit(err.Error())
+		}
 
-		cltools.RunRtc(*timeStamp, *sourceDirectory, *outputDirectory, *inputType, *outputType, *showConversionOutput, *overwrite, *recursive, *retainFolderStructure)
+		maxSizeBytes, err := utils.ParseBytes(*maxSize)
+		if err != nil {
+			logging.ErrorAndExit(err.Error())
+		}
+
+		results, err := cltools.RunRtc(cltools.RtcOptions{
+			TimeStamp:             *timeStamp,
+			LocationPath:          *sourceDirectory,
+			OutputDirectory:       *outputDirectory,
+			InputType:             *inputType,
+			OutputType:            *outputType,
+			ShowConversionOutput:  *showConversionOutput,
+			OnExist:               cltools.OnExistPolicy(*onExist),
+			Recursive:             *recursive,
+			RetainFolderStructure: *retainFolderStructure,
+			Since:                 *since,
+			Watch:                 *watch,
+			Workers:               *workers,
+			IOWorkers:             *ioWorkers,
+			MaxMemory:             maxMemoryBytes,
+			Aspect:                *aspect,
+			Gray:                  *gray,
+			Brightness:            *brightness,
+			Contrast:              *contrast,
+			Rotate:                *rotate,
+			Flip:                  *flip,
+			Border:                *border,
+			BorderColor:           *borderColor,
+			ZipPath:               *zipPath,
+			DPI:                   *dpi,
+			MaxSize:               maxSizeBytes,
+			Progressive:           *progressive,
+			List:                  *list,
+			From:                  *from,
+			FailFast:              *failFast,
+			Summary:               *summary,
+			VerifyOutput:          *verifyOutput,
+			VerifyRetries:         *verifyRetries,
+			Name:                  *name,
+			PreviewMax:            *previewMax,
+			MinWidth:              *minWidth,
+			MinHeight:             *minHeight,
+			Stdout:                *toStdout,
+			CopyProfile:           *copyProfile,
+			CopyGPS:               *copyGPS,
+			NoScan:                *noScan,
+		})
+		if errors.Is(err, cltools.ErrMissingRtcOptions) {
+			flag.PrintDefaults()
+		} else if err != nil {
+			logging.Error(err.Error())
+		}
+		return cltools.RtcExitCode(results, err)
 	case "/tee":
 		sourceDirectory := flag.String("id", "", "Location containing images from which to export EXIF data.")
 		outputDirectory := flag.String("od", "", "Location to save exported EXIF data.")
@@ -86,13 +339,94 @@ func runTool(toolFlag string) {
 		recursive := flag.Bool("rs", false, "Scan all sub folders in root recursively.")
 		showConversionOutput := flag.Bool("so", false, "Show exporting output.")
 		timeStamp := flag.Bool("ts", false, "Adds time stamp to show process duration in milliseconds in console output.")
+		since := flag.String("since", "", "Only export images modified since a time, e.g. 2018-06-01, or the time saved in a state file.")
+		fields := flag.String("fields", "", "Comma separated fields to export, e.g. model,make,gps (empty for all).")
+		outputFormat := flag.String("of", "txt", "Format to export EXIF data as, txt, json or xmp (sidecar files).")
+		list := flag.Bool("list", false, "Print the path of each image which would be exported and exit without exporting.")
+		failFast := flag.Bool("fail-fast", false, "Stop exporting once an image fails.")
+		hash := flag.String("hash", "", "Add a digest of each raw image to exports, md5 or sha256.")
+		hexDump := flag.Bool("hexdump", false, "Add the stored bytes of every IFD entry to txt exports.")
+		summary := flag.String("summary", "", "Location to save a JSON summary of the run, or - to write it to stderr.")
+		names := flag.String("names", "clover", "Names to key JSON exports by, clover or exiftool (e.g. EXIF:Model, GPS:GPSLatitude).")
+		logging.OutputDateTime, logging.OutputPath, logging.OutputLogLevelFlag, logging.OutputArrowSuffix = false, false, false, false
+		setLoggingLevel()
+
+		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		defer startSyslog(*useSyslog)()
+
+		return cltools.RunTee(cltools.TeeOptions{
+			TimeStamp:        *timeStamp,
+			LocationPath:     *sourceDirectory,
+			OutputDirectory:  *outputDirectory,
+			InputType:        *inputType,
+			ShowExportOutput: *showConversionOutput,
+			Overwrite:        *overwrite,
+			Recursive:        *recursive,
+			Fields:           *fields,
+			OutputFormat:     *outputFormat,
+			Names:            *names,
+			Since:            *since,
+			List:             *list,
+			FailFast:         *failFast,
+			Summary:          *summary,
+			HexDump:          *hexDump,
+			Hash:             *hash,
+		})
+	case "/gpx":
+		sourceDirectory := flag.String("id", "", "Location containing images from which to export GPS locations.")
+		outputPath := flag.String("o", "", "Path of GPX file to save.")
+		inputType := flag.String("it", "", "Extension of image type to export GPS locations from.")
+		recursive := flag.Bool("rs", false, "Scan all sub folders in root recursively.")
+		timeStamp := flag.Bool("ts", false, "Adds time stamp to show process duration in milliseconds in console output.")
 		logging.OutputDateTime, logging.OutputPath, logging.OutputLogLevelFlag, logging.OutputArrowSuffix = false, false, false, false
 		setLoggingLevel()
 
 		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		defer startSyslog(*useSyslog)()
+
+		cltools.RunGpx(*timeStamp, *sourceDirectory, *outputPath, *inputType, *recursive)
+	case "/stat":
+		sourceDirectory := flag.String("id", "", "Locations containing images to gather statistics over, comma separated directories or zip archives.")
+		inputType := flag.String("it", "", "Extension of image type to gather statistics over.")
+		recursive := flag.Bool("rs", false, "Scan all sub folders in root recursively.")
+		outputFormat := flag.String("of", "txt", "Format to print statistics as, txt or json.")
+		logging.OutputDateTime, logging.OutputPath, logging.OutputLogLevelFlag, logging.OutputArrowSuffix = false, false, false, false
+		setLoggingLevel()
+
+		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		defer startSyslog(*useSyslog)()
+
+		return cltools.RunStat(cltools.StatOptions{
+			LocationPath: *sourceDirectory,
+			InputType:    *inputType,
+			Recursive:    *recursive,
+			OutputFormat: *outputFormat,
+		})
+	case "/serve":
+		address := flag.String("addr", ":8080", "Host and port to listen on.")
+		maxBodySize := flag.String("maxbody", "256M", "Largest raw image which can be posted, e.g. 100M (0 for no limit).")
+		concurrency := flag.Int("j", runtime.NumCPU(), "Number of images to convert at once.")
+		setLoggingLevel()
+
+		flag.Parse()
+		defer startProfiling(*pprofDirectory)()
+		defer startSyslog(*useSyslog)()
+
+		maxBodySizeBytes, err := utils.ParseBytes(*maxBodySize)
+		if err != nil {
+			logging.ErrorAndExit(err.Error())
+		}
 
-		cltools.RunTee(*timeStamp, *sourceDirectory, *outputDirectory, *inputType, *showConversionOutput, *overwrite, *recursive)
+		cltools.RunServe(cltools.ServeOptions{
+			Address:     *address,
+			MaxBodySize: maxBodySizeBytes,
+			Concurrency: *concurrency,
+		})
 	default:
 		outputUsageAndClose()
 	}
+	return cltools.ExitOK
 }
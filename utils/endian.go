@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var nativeEndian = detectNativeEndian()
+
+//DetectEndian maps a TIFF style two byte order mark to its endian order, "MM" is big endian and "II" is little endian
+func DetectEndian(mark []byte) (EndianOrder, error) {
+	if len(mark) >= 2 {
+		if mark[0] == 'M' && mark[1] == 'M' {
+			return BigEndian, nil
+		} else if mark[0] == 'I' && mark[1] == 'I' {
+			return LittleEndian, nil
+		}
+	}
+	return BigEndian, errors.New("unknown byte order mark")
+}
+
+//NativeEndian returns the endian order of the machine we're running on
+func NativeEndian() EndianOrder {
+	return nativeEndian
+}
+
+func detectNativeEndian() EndianOrder {
+	var check uint16 = 0x0001
+	//on a little endian machine the least significant byte is stored first
+	if *(*byte)(unsafe.Pointer(&check)) == 0x01 {
+		return LittleEndian
+	}
+	return BigEndian
+}
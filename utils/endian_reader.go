@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+)
+
+//Rational is a fraction made up of two unsigned longs, as stored in TIFF and EXIF data
+type Rational struct {
+	Numerator   uint32
+	Denominator uint32
+}
+
+//Float64 returns the rational's value, or 0 if its denominator is 0
+func (r Rational) Float64() float64 {
+	if r.Denominator == 0 {
+		return 0
+	}
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+//String returns the rational as numerator/denominator, the way EXIF tools show them
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Numerator, r.Denominator)
+}
+
+//EndianReader reads sized unsigned ints at offsets of the underlying reader in a fixed endian order
+type EndianReader struct {
+	r  io.ReaderAt
+	eo EndianOrder
+}
+
+//NewEndianReader creates an EndianReader reading from r in the endian order eo
+func NewEndianReader(r io.ReaderAt, eo EndianOrder) EndianReader {
+	return EndianReader{r: r, eo: eo}
+}
+
+//Uint16 reads the two bytes at the offset as a uint16
+func (er EndianReader) Uint16(off int64) (uint16, error) {
+	btc, err := er.read(off, 2)
+	if err != nil {
+		return 0, err
+	}
+	return ConvertBytesSliceToUInt16(btc, er.eo), nil
+}
+
+//Uint32 reads the four bytes at the offset as a uint32
+func (er EndianReader) Uint32(off int64) (uint32, error) {
+	btc, err := er.read(off, 4)
+	if err != nil {
+		return 0, err
+	}
+	return ConvertBytesSliceToUInt32(btc, er.eo), nil
+}
+
+//Uint64 reads the eight bytes at the offset as a uint64
+func (er EndianReader) Uint64(off int64) (uint64, error) {
+	btc, err := er.read(off, 8)
+	if err != nil {
+		return 0, err
+	}
+	return ConvertBytesSliceToUInt64(btc, er.eo), nil
+}
+
+//RationalAt reads the eight bytes at the offset as a numerator followed by a denominator
+func (er EndianReader) RationalAt(off int64) (Rational, error) {
+	btc, err := er.read(off, 8)
+	if err != nil {
+		return Rational{}, err
+	}
+	return Rational{
+		Numerator:   ConvertBytesSliceToUInt32(btc[:4], er.eo),
+		Denominator: ConvertBytesSliceToUInt32(btc[4:], er.eo),
+	}, nil
+}
+
+func (er EndianReader) read(off int64, size int) ([]byte, error) {
+	btc := make([]byte, size)
+	n, err := er.r.ReadAt(btc, off)
+	//ReadAt can return io.EOF alongside a full read at the end of the data
+	if n == size {
+		return btc, nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var binaryByteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+var siByteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+//FormatBytes formats a byte count with binary units, e.g. "1.5 GiB" or "512 MiB"
+func FormatBytes(n uint64) string {
+	return formatWithUnits(float64(n), 1024, binaryByteUnits)
+}
+
+//FormatBytesSI formats a byte count with decimal units, e.g. "1.5 GB" or "512 MB"
+func FormatBytesSI(n uint64) string {
+	return formatWithUnits(float64(n), 1000, siByteUnits)
+}
+
+//FormatRate formats a transfer rate with decimal units, as storage devices are rated, e.g. "95.2 MB/s"
+func FormatRate(bytesPerSec float64) string {
+	return formatWithUnits(bytesPerSec, 1000, siByteUnits) + "/s"
+}
+
+func formatWithUnits(value float64, base float64, units []string) string {
+	unitIndex := 0
+	for value >= base && unitIndex < len(units)-1 {
+		value /= base
+		unitIndex++
+	}
+	if unitIndex == 0 {
+		return strconv.FormatFloat(value, 'f', -1, 64) + " " + units[0]
+	}
+	//rounding can push the value up to the base, e.g. 1023.96 KiB to "1024.0 KiB"
+	formatted := strconv.FormatFloat(value, 'f', 1, 64)
+	if formatted == strconv.FormatFloat(base, 'f', 1, 64) && unitIndex < len(units)-1 {
+		formatted = "1.0"
+		unitIndex++
+	}
+	return strings.TrimSuffix(formatted, ".0") + " " + units[unitIndex]
+}
+
+//ParseBytes parses a byte size such as "512", "1.5G", "2GiB" or "500MB", single letter and "iB" suffixes
+//are binary multiples, "B" suffixes are decimal multiples
+func ParseBytes(size string) (uint64, error) {
+	trimmed := strings.TrimSpace(size)
+	numEnd := 0
+	for numEnd < len(trimmed) && (trimmed[numEnd] == '.' || (trimmed[numEnd] >= '0' && trimmed[numEnd] <= '9')) {
+		numEnd++
+	}
+	value, err := strconv.ParseFloat(trimmed[:numEnd], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	unit := strings.ToUpper(strings.TrimSpace(trimmed[numEnd:]))
+	multiplier := float64(1)
+	if len(unit) > 0 && unit != "B" {
+		unitIndex := strings.IndexByte("KMGTPE", unit[0])
+		if unitIndex < 0 {
+			return 0, fmt.Errorf("invalid size unit in %q", size)
+		}
+		var base float64
+		switch unit[1:] {
+		case "", "IB":
+			base = 1024
+		case "B":
+			base = 1000
+		default:
+			return 0, fmt.Errorf("invalid size unit in %q", size)
+		}
+		multiplier = math.Pow(base, float64(unitIndex+1))
+	}
+	return uint64(value * multiplier), nil
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !freebsd && !linux && !windows
+// +build !darwin,!freebsd,!linux,!windows
+
+package utils
+
+import (
+	"errors"
+	"runtime"
+)
+
+//FreeSpace isn't supported on this platform and always returns an error
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space lookup not supported on " + runtime.GOOS)
+}
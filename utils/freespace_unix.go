@@ -0,0 +1,15 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package utils
+
+import "syscall"
+
+//FreeSpace returns the number of bytes available to the current user on the file system containing path
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !freebsd && !linux
+// +build !darwin,!freebsd,!linux
+
+package utils
+
+import (
+	"errors"
+	"runtime"
+)
+
+//RedirectOutputToSyslog isn't supported on this platform and always returns an error, leaving output as it is
+func RedirectOutputToSyslog(tag string) (func(), error) {
+	return nil, errors.New("syslog not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,72 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package utils
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log/syslog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//ansiEscapes matches the escape codes terminal colors are written with, which mean nothing in the system log
+var ansiEscapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+//RedirectOutputToSyslog sends everything written to stdout to the system logger at info priority, and everything
+//written to stderr at error priority, a line at a time without terminal colors, under the tag. The returned function
+//puts stdout and stderr back once every line written so far has been sent
+func RedirectOutputToSyslog(tag string) (func(), error) {
+	syslogWriter, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	stdoutWriter, err := sendLinesTo(&wg, syslogWriter.Info)
+	if err != nil {
+		syslogWriter.Close()
+		return nil, err
+	}
+	stderrWriter, err := sendLinesTo(&wg, syslogWriter.Err)
+	if err != nil {
+		stdoutWriter.Close()
+		syslogWriter.Close()
+		return nil, err
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutWriter, stderrWriter
+	return func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		wg.Wait()
+		syslogWriter.Close()
+	}, nil
+}
+
+//sendLinesTo returns a pipe whose non blank lines are each sent with send, wg is done once the pipe's closed and
+//everything written to it has been sent
+func sendLinesTo(wg *sync.WaitGroup, send func(string) error) (*os.File, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer reader.Close()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			if line := ansiEscapes.ReplaceAllString(scanner.Text(), ""); len(strings.TrimSpace(line)) > 0 {
+				send(line)
+			}
+		}
+		//a line too long to scan stops the scanner, so keep emptying the pipe or writing to it would block forever
+		io.Copy(ioutil.Discard, reader)
+	}()
+	return writer, nil
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -14,15 +17,37 @@ const (
 
 //TranslatePath to translate file location paths cross OS
 func TranslatePath(path string) string {
-	if runtime.GOOS == "windows" {
-		path = strings.Replace(path, ":/", ":\\", -1)
-		path = strings.Replace(path, "/", "\\", -1)
-	} else if runtime.GOOS == "darwin" {
-		path = strings.Replace(path, "\\", "/", -1)
+	return translatePathForOS(path, runtime.GOOS)
+}
+
+//translatePathForOS does the translation for the given OS rather than the one we're running on,
+//filepath.FromSlash/ToSlash can't be used here as they only know about the OS they were built for
+func translatePathForOS(path string, goos string) string {
+	switch goos {
+	case "windows":
+		//drive letters need no special handling, "C:/a" and "C:\a" both end up as "C:\a"
+		return strings.Replace(path, "/", "\\", -1)
+	case "darwin":
+		return strings.Replace(path, "\\", "/", -1)
 	}
+	//backslash is a valid file name character on linux so paths are left alone
 	return path
 }
 
+//RemoveExtension strips the last extension from the file name, "a.b.NEF" becomes "a.b"
+func RemoveExtension(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+//ReplaceExtension swaps the last extension of the file name for the new one whatever its case,
+//the new extension can be given with or without its leading dot
+func ReplaceExtension(name string, newExt string) string {
+	if len(newExt) > 0 && !strings.HasPrefix(newExt, ".") {
+		newExt = "." + newExt
+	}
+	return RemoveExtension(name) + newExt
+}
+
 //ConvertBytesSliceToUInt16 takes a slice of two bytes and converts them to a uint16
 func ConvertBytesSliceToUInt16(btc []byte, eo EndianOrder) uint16 {
 	if len(btc) != 2 {
@@ -102,6 +127,29 @@ func ConvertBytesToUInt64(byte1 byte, byte2 byte, byte3 byte, byte4 byte, byte5
 	return resultInt
 }
 
+//BytesToUint converts a 1, 2, 4 or 8 byte slice to an unsigned int, returning an error
+//rather than 0 for any other length so a bad read isn't mistaken for a real value
+func BytesToUint(btc []byte, eo EndianOrder) (uint64, error) {
+	return ConvertBytesSliceToUInt(btc, eo)
+}
+
+//ConvertBytesSliceToUInt takes a slice of one, two, four or eight bytes and converts them with the matching
+//fixed width function, so a value can be decoded by its declared width in one call
+func ConvertBytesSliceToUInt(btc []byte, eo EndianOrder) (uint64, error) {
+	switch len(btc) {
+	case 1:
+		return uint64(btc[0]), nil
+	case 2:
+		return uint64(ConvertBytesSliceToUInt16(btc, eo)), nil
+	case 4:
+		return uint64(ConvertBytesSliceToUInt32(btc, eo)), nil
+	case 8:
+		return ConvertBytesSliceToUInt64(btc, eo), nil
+	}
+	return 0, fmt.Errorf("unsupported unsigned int length of %d bytes", len(btc))
+}
+
+//ConvertBytesSliceToFloat32 takes a slice of four bytes and converts them to a float32
 func ConvertBytesSliceToFloat32(btc []byte, eo EndianOrder) float32 {
 	if len(btc) != 4 {
 		return 0.0
@@ -109,8 +157,41 @@ func ConvertBytesSliceToFloat32(btc []byte, eo EndianOrder) float32 {
 	return ConvertBytesToFloat32(btc[0], btc[1], btc[2], btc[3], eo)
 }
 
+//ConvertBytesToFloat32 takes four byte values holding an IEEE 754 single and converts them to a float32
 func ConvertBytesToFloat32(byte1 byte, byte2 byte, byte3 byte, byte4 byte, endianOrder EndianOrder) float32 {
-	return 0.0
+	return math.Float32frombits(ConvertBytesToUInt32(byte1, byte2, byte3, byte4, endianOrder))
+}
+
+//ConvertBytesSliceToFloat64 takes a slice of eight bytes holding an IEEE 754 double and converts them to a float64
+func ConvertBytesSliceToFloat64(btc []byte, eo EndianOrder) float64 {
+	if len(btc) != 8 {
+		return 0.0
+	}
+	return math.Float64frombits(ConvertBytesSliceToUInt64(btc, eo))
+}
+
+//Float32ToBytes converts a float32 to its four IEEE 754 bytes in the given endian order
+func Float32ToBytes(value float32, endianOrder EndianOrder) []byte {
+	return uintToBytes(uint64(math.Float32bits(value)), 4, endianOrder)
+}
+
+//Float64ToBytes converts a float64 to its eight IEEE 754 bytes in the given endian order
+func Float64ToBytes(value float64, endianOrder EndianOrder) []byte {
+	return uintToBytes(math.Float64bits(value), 8, endianOrder)
+}
+
+//uintToBytes splits the lowest size bytes of value into a slice in the given endian order
+func uintToBytes(value uint64, size int, endianOrder EndianOrder) []byte {
+	result := make([]byte, size)
+	for i := 0; i < size; i++ {
+		b := byte(value >> (8 * uint(i)))
+		if endianOrder == BigEndian {
+			result[size-1-i] = b
+		} else {
+			result[i] = b
+		}
+	}
+	return result
 }
 
 func SSliceContains(ls []string, itf string) bool {
@@ -121,3 +202,13 @@ func SSliceContains(ls []string, itf string) bool {
 	}
 	return false
 }
+
+//SSliceContainsFold is SSliceContains ignoring case, so ".JPG" matches ".jpg"
+func SSliceContainsFold(ls []string, itf string) bool {
+	for i := 0; i < len(ls); i++ {
+		if strings.EqualFold(ls[i], itf) {
+			return true
+		}
+	}
+	return false
+}
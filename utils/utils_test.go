@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestTranslatePathForOS(t *testing.T) {
+	for _, test := range []struct {
+		goos     string
+		path     string
+		expected string
+	}{
+		{"windows", "C:/Users/a/b", "C:\\Users\\a\\b"},
+		{"windows", "C:\\already\\windows", "C:\\already\\windows"},
+		{"windows", "relative/dir/", "relative\\dir\\"},
+		{"windows", "//server/share", "\\\\server\\share"},
+		{"darwin", "Users\\a\\b", "Users/a/b"},
+		{"darwin", "/Users/a/b", "/Users/a/b"},
+		{"linux", "/home/a/b", "/home/a/b"},
+		//backslash is a valid file name character on linux
+		{"linux", "/home/a\\b", "/home/a\\b"},
+		{"freebsd", "/usr/home/a", "/usr/home/a"},
+		{"linux", "", ""},
+	} {
+		if translated := translatePathForOS(test.path, test.goos); translated != test.expected {
+			t.Errorf("%s on %s translated to %s, expected %s", test.path, test.goos, translated, test.expected)
+		}
+	}
+}
+
+func TestConvertBytesSliceToUInt(t *testing.T) {
+	for _, test := range []struct {
+		btc          []byte
+		bigEndian    uint64
+		littleEndian uint64
+	}{
+		{[]byte{0x00}, 0, 0},
+		{[]byte{0xab}, 0xab, 0xab},
+		{[]byte{0x01, 0x02}, 0x0102, 0x0201},
+		{[]byte{0xff, 0x00}, 0xff00, 0x00ff},
+		{[]byte{0x01, 0x02, 0x03, 0x04}, 0x01020304, 0x04030201},
+		{[]byte{0x00, 0x00, 0x01, 0x00}, 256, 65536},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, 0x0102030405060708, 0x0807060504030201},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, math.MaxUint64, math.MaxUint64},
+	} {
+		for _, order := range []struct {
+			eo       EndianOrder
+			expected uint64
+		}{{BigEndian, test.bigEndian}, {LittleEndian, test.littleEndian}} {
+			value, err := ConvertBytesSliceToUInt(test.btc, order.eo)
+			if err != nil {
+				t.Errorf("%x -> %v", test.btc, err)
+			} else if value != order.expected {
+				t.Errorf("%x in endian order %d converted to %#x, expected %#x", test.btc, order.eo, value, order.expected)
+			}
+		}
+	}
+	for _, length := range []int{0, 3, 5, 6, 7, 9, 16} {
+		if value, err := ConvertBytesSliceToUInt(make([]byte, length), BigEndian); err == nil {
+			t.Errorf("%d bytes converted to %d, expected an error", length, value)
+		}
+	}
+}
+
+//addByteSeeds seeds the corpus with all zero and all 0xFF values of each length, in both endian orders
+func addByteSeeds(f *testing.F, lengths ...int) {
+	for _, length := range lengths {
+		for _, fill := range []byte{0x00, 0xFF} {
+			f.Add(bytes.Repeat([]byte{fill}, length), false)
+			f.Add(bytes.Repeat([]byte{fill}, length), true)
+		}
+	}
+}
+
+func fuzzEndianOrder(littleEndian bool) EndianOrder {
+	if littleEndian {
+		return LittleEndian
+	}
+	return BigEndian
+}
+
+func FuzzConvertBytesSliceToUInt16(f *testing.F) {
+	addByteSeeds(f, 0, 1, 2, 3)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value := ConvertBytesSliceToUInt16(btc, eo)
+		if len(btc) != 2 {
+			if value != 0 {
+				t.Errorf("%d bytes converted to %d, expected 0", len(btc), value)
+			}
+			return
+		}
+		if encoded := uintToBytes(uint64(value), 2, eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %d, which encodes back to %x", btc, value, encoded)
+		}
+	})
+}
+
+func FuzzConvertBytesSliceToUInt32(f *testing.F) {
+	addByteSeeds(f, 0, 3, 4, 5)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value := ConvertBytesSliceToUInt32(btc, eo)
+		if len(btc) != 4 {
+			if value != 0 {
+				t.Errorf("%d bytes converted to %d, expected 0", len(btc), value)
+			}
+			return
+		}
+		if encoded := uintToBytes(uint64(value), 4, eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %d, which encodes back to %x", btc, value, encoded)
+		}
+	})
+}
+
+func FuzzConvertBytesSliceToUInt64(f *testing.F) {
+	addByteSeeds(f, 0, 7, 8, 9)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value := ConvertBytesSliceToUInt64(btc, eo)
+		if len(btc) != 8 {
+			if value != 0 {
+				t.Errorf("%d bytes converted to %d, expected 0", len(btc), value)
+			}
+			return
+		}
+		if encoded := uintToBytes(value, 8, eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %d, which encodes back to %x", btc, value, encoded)
+		}
+	})
+}
+
+func FuzzConvertBytesSliceToUInt(f *testing.F) {
+	addByteSeeds(f, 0, 1, 2, 3, 4, 8)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value, err := ConvertBytesSliceToUInt(btc, eo)
+		supported := len(btc) == 1 || len(btc) == 2 || len(btc) == 4 || len(btc) == 8
+		if (err == nil) != supported {
+			t.Fatalf("%d bytes gave error %v", len(btc), err)
+		}
+		if err != nil {
+			return
+		}
+		if encoded := uintToBytes(value, len(btc), eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %d, which encodes back to %x", btc, value, encoded)
+		}
+	})
+}
+
+func FuzzConvertBytesSliceToFloat32(f *testing.F) {
+	addByteSeeds(f, 0, 3, 4, 5)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value := ConvertBytesSliceToFloat32(btc, eo)
+		if len(btc) != 4 {
+			if value != 0 {
+				t.Errorf("%d bytes converted to %v, expected 0", len(btc), value)
+			}
+			return
+		}
+		//compared as bytes, so NaNs are checked too
+		if encoded := Float32ToBytes(value, eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %v, which encodes back to %x", btc, value, encoded)
+		}
+		if decoded := ConvertBytesSliceToFloat32(Float32ToBytes(value, eo), eo); math.Float32bits(decoded) != math.Float32bits(value) {
+			t.Errorf("%v encoded and converted back to %v", value, decoded)
+		}
+	})
+}
+
+func FuzzConvertBytesSliceToFloat64(f *testing.F) {
+	addByteSeeds(f, 0, 7, 8, 9)
+	f.Fuzz(func(t *testing.T, btc []byte, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		value := ConvertBytesSliceToFloat64(btc, eo)
+		if len(btc) != 8 {
+			if value != 0 {
+				t.Errorf("%d bytes converted to %v, expected 0", len(btc), value)
+			}
+			return
+		}
+		if encoded := Float64ToBytes(value, eo); !bytes.Equal(encoded, btc) {
+			t.Errorf("%x converted to %v, which encodes back to %x", btc, value, encoded)
+		}
+		if decoded := ConvertBytesSliceToFloat64(Float64ToBytes(value, eo), eo); math.Float64bits(decoded) != math.Float64bits(value) {
+			t.Errorf("%v encoded and converted back to %v", value, decoded)
+		}
+	})
+}
+
+func FuzzFloat64ToBytes(f *testing.F) {
+	f.Add(0.0, false)
+	f.Add(math.Float64frombits(math.MaxUint64), true)
+	f.Add(math.Inf(-1), false)
+	f.Fuzz(func(t *testing.T, value float64, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		if decoded := ConvertBytesSliceToFloat64(Float64ToBytes(value, eo), eo); math.Float64bits(decoded) != math.Float64bits(value) {
+			t.Errorf("%v encoded and converted back to %v", value, decoded)
+		}
+	})
+}
+
+func FuzzFloat32ToBytes(f *testing.F) {
+	f.Add(float32(0), false)
+	f.Add(math.Float32frombits(math.MaxUint32), true)
+	f.Add(float32(math.Inf(1)), false)
+	f.Fuzz(func(t *testing.T, value float32, littleEndian bool) {
+		eo := fuzzEndianOrder(littleEndian)
+		if decoded := ConvertBytesSliceToFloat32(Float32ToBytes(value, eo), eo); math.Float32bits(decoded) != math.Float32bits(value) {
+			t.Errorf("%v encoded and converted back to %v", value, decoded)
+		}
+	})
+}